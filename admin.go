@@ -0,0 +1,343 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/dbms"
+)
+
+// The admin console is a web page on the http monitor port (/admin)
+// with a JSON API (/admin/api/...) to list the client connections,
+// kill sessions, abort transactions, and check the database.
+//
+// If the database has users, an admin logs in with a token from
+// Database.Token().ToHex() for a user that is not restricted by permissions.
+// Otherwise the console is only available from the local machine.
+//
+// API requests must have an X-Admin header.
+// Browsers don't allow this cross-site (without CORS),
+// which along with the SameSite cookie prevents cross-site requests.
+
+const adminCookie = "gsuneido_admin"
+const adminTimeout = time.Hour
+
+var adminSessions = struct {
+	lock sync.Mutex
+	list map[string]*adminSession // cookie value => session
+}{list: make(map[string]*adminSession)}
+
+type adminSession struct {
+	user    string
+	expires time.Time
+}
+
+// adminHandlers is called by startHttpStatus
+func adminHandlers() {
+	http.HandleFunc("/admin", httpAdmin)
+	http.HandleFunc("/admin/login", httpAdminLogin)
+	http.HandleFunc("/admin/logout", httpAdminLogout)
+	http.HandleFunc("/admin/api/connections", adminApi("GET", apiConnections))
+	http.HandleFunc("/admin/api/kill", adminApi("POST", apiKill))
+	http.HandleFunc("/admin/api/abort", adminApi("POST", apiAbort))
+	http.HandleFunc("/admin/api/check", adminApi("POST", apiCheck))
+}
+
+// adminUser returns the user for the request
+// and false if it is not authorized
+func adminUser(req *http.Request) (string, bool) {
+	if dbmsLocal == nil {
+		return "", false
+	}
+	if !dbmsLocal.HaveUsers() {
+		host, _, _ := net.SplitHostPort(req.RemoteAddr)
+		ip := net.ParseIP(host)
+		return "", ip != nil && ip.IsLoopback()
+	}
+	c, err := req.Cookie(adminCookie)
+	if err != nil {
+		return "", false
+	}
+	adminSessions.lock.Lock()
+	defer adminSessions.lock.Unlock()
+	as := adminSessions.list[c.Value]
+	if as == nil {
+		return "", false
+	}
+	if time.Now().After(as.expires) {
+		delete(adminSessions.list, c.Value)
+		return "", false
+	}
+	as.expires = time.Now().Add(adminTimeout)
+	return as.user, true
+}
+
+func httpAdmin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, ok := adminUser(req); !ok {
+		if dbmsLocal == nil || !dbmsLocal.HaveUsers() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, adminLoginPage)
+		return
+	}
+	io.WriteString(w, adminPage)
+}
+
+func httpAdminLogin(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if dbmsLocal == nil {
+		http.Error(w, "Not a server", http.StatusServiceUnavailable)
+		return
+	}
+	addr := req.RemoteAddr
+	token, err := hex.DecodeString(req.FormValue("token"))
+	user, ok := "", false
+	if err == nil {
+		user, ok = dbmsLocal.ConsoleAuth(string(token))
+	}
+	if !ok {
+		dbmsLocal.ConsoleAudit(addr, user, "Login", "", "failed")
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	dbmsLocal.ConsoleAudit(addr, user, "Login", "", "ok")
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := hex.EncodeToString(buf)
+	adminSessions.lock.Lock()
+	adminSessions.list[id] = &adminSession{user: user,
+		expires: time.Now().Add(adminTimeout)}
+	adminSessions.lock.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Value: id,
+		Path: "/admin", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, req, "/admin", http.StatusSeeOther)
+}
+
+func httpAdminLogout(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c, err := req.Cookie(adminCookie); err == nil {
+		adminSessions.lock.Lock()
+		delete(adminSessions.list, c.Value)
+		adminSessions.lock.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Path: "/admin",
+		MaxAge: -1})
+	http.Redirect(w, req, "/admin", http.StatusSeeOther)
+}
+
+type adminRequest struct {
+	w    http.ResponseWriter
+	req  *http.Request
+	user string
+}
+
+// adminApi wraps an api function with the method and authorization checks
+// and converts the result (or a panic) to JSON
+func adminApi(method string, fn func(ar *adminRequest) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if req.Header.Get("X-Admin") == "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		user, ok := adminUser(req)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		result := func() (result any) {
+			defer func() {
+				if e := recover(); e != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					result = map[string]any{"error": errStr(e)}
+				}
+			}()
+			return fn(&adminRequest{w: w, req: req, user: user})
+		}()
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func errStr(e any) string {
+	if s, ok := e.(string); ok {
+		return s
+	}
+	if err, ok := e.(error); ok {
+		return err.Error()
+	}
+	return "unknown error"
+}
+
+// audit logs an admin action and records it in the audit table (if any)
+func (ar *adminRequest) audit(cmd, args, outcome string) {
+	log.Println("admin console:", ar.user, cmd, args, outcome)
+	dbmsLocal.ConsoleAudit(ar.req.RemoteAddr, ar.user, cmd, args, outcome)
+}
+
+func apiConnections(*adminRequest) any {
+	return map[string]any{"mode": dbms.ServerMode(),
+		"connections": dbms.ConsoleConnections()}
+}
+
+func apiKill(ar *adminRequest) any {
+	sid := ar.req.FormValue("session")
+	if sid == "" {
+		panic("kill: session required")
+	}
+	n := dbmsLocal.Kill(sid)
+	ar.audit("Kill", sid, "killed "+strconv.Itoa(n))
+	return map[string]any{"killed": n}
+}
+
+func apiAbort(ar *adminRequest) any {
+	tn, err := strconv.Atoi(ar.req.FormValue("tran"))
+	if err != nil {
+		panic("abort: invalid transaction number")
+	}
+	aborted := dbms.ConsoleAbort(tn)
+	ar.audit("Abort", strconv.Itoa(tn), strconv.FormatBool(aborted))
+	return map[string]any{"aborted": aborted}
+}
+
+func apiCheck(ar *adminRequest) any {
+	t := time.Now()
+	result := dbmsLocal.Check()
+	outcome := result
+	if outcome == "" {
+		outcome = "ok"
+	}
+	ar.audit("Check", "", outcome)
+	return map[string]any{"result": outcome,
+		"seconds": time.Since(t).Seconds()}
+}
+
+const adminLoginPage = `<html>
+<head><title>Suneido Admin</title></head>
+<body>
+<h1>Suneido Admin</h1>
+<form method="post" action="/admin/login">
+<p>Token (from Database.Token().ToHex()):
+<input type="password" name="token" size="40" />
+<input type="submit" value="Login" /></p>
+</form>
+</body>
+</html>`
+
+const adminPage = `<html>
+<head>
+<title>Suneido Admin</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 3px 6px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Suneido Admin</h1>
+<form method="post" action="/admin/logout"><input type="submit" value="Logout" />
+<button type="button" onclick="check()">Check Database</button>
+<span id="check"></span></form>
+<p id="mode"></p>
+<table>
+<thead><tr><th>Address</th><th>User</th><th>Session</th><th>Idle</th>
+<th>Cursors</th><th>Transactions</th><th></th></tr></thead>
+<tbody id="conns"></tbody>
+</table>
+<script>
+function api(method, path, params) {
+	var body = params ? new URLSearchParams(params) : undefined;
+	return fetch("/admin/api/" + path, { method: method, body: body,
+		headers: { "X-Admin": "1" }, credentials: "same-origin" }).
+		then(function(r) { return r.json(); }).
+		then(function(j) { if (j.error) alert(j.error); return j; });
+}
+function text(s) {
+	var span = document.createElement("span");
+	span.textContent = s;
+	return span;
+}
+function button(label, fn) {
+	var b = document.createElement("button");
+	b.textContent = label;
+	b.onclick = fn;
+	return b;
+}
+function secs(n) {
+	return n < 60 ? n.toFixed(0) + "s" : (n / 60).toFixed(1) + "m";
+}
+function refresh() {
+	api("GET", "connections").then(function(j) {
+		document.getElementById("mode").textContent = j.mode ? "Mode: " + j.mode : "";
+		var tbody = document.getElementById("conns");
+		tbody.innerHTML = "";
+		j.connections.forEach(function(c) {
+			c.sessions.forEach(function(s) {
+				var tr = tbody.insertRow();
+				tr.insertCell().appendChild(text(c.address));
+				tr.insertCell().appendChild(text(c.user || ""));
+				tr.insertCell().appendChild(text(s.session_id));
+				tr.insertCell().appendChild(text(secs(s.idle_seconds)));
+				tr.insertCell().appendChild(text(s.cursors));
+				var td = tr.insertCell();
+				s.transactions.forEach(function(t) {
+					var div = document.createElement("div");
+					div.appendChild(text((t.update ? "update " : "read ") + t.num +
+						" age " + secs(t.age_seconds) + " read " + t.rows_read +
+						" written " + t.rows_written + " "));
+					if (t.update)
+						div.appendChild(button("Abort", function() {
+							if (confirm("Abort transaction " + t.num + "?"))
+								api("POST", "abort", { tran: t.num }).then(refresh);
+						}));
+					td.appendChild(div);
+				});
+				tr.insertCell().appendChild(button("Kill", function() {
+					if (confirm("Kill session " + s.session_id + "?"))
+						api("POST", "kill", { session: s.session_id }).then(refresh);
+				}));
+			});
+		});
+	});
+}
+function check() {
+	var span = document.getElementById("check");
+	span.textContent = "checking...";
+	api("POST", "check").then(function(j) {
+		span.textContent = "check: " + j.result;
+	});
+}
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>`
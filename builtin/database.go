@@ -33,6 +33,12 @@ func db_Auth(th *Thread, args []Value) Value {
 	return SuBool(th.Dbms().Auth(th, ToStr(args[0])))
 }
 
+var _ = staticMethod(db_Backup, "(to = 'backup.db', base = '')")
+
+func db_Backup(th *Thread, args []Value) Value {
+	return Int64Val(int64(th.Dbms().Backup(ToStr(args[0]), ToStr(args[1]))))
+}
+
 var _ = staticMethod(db_Check, "()")
 
 func db_Check(th *Thread, args []Value) Value {
@@ -57,6 +63,13 @@ func db_Cursors(th *Thread, args []Value) Value {
 	return IntVal(th.Dbms().Cursors())
 }
 
+var _ = staticMethod(db_Drain, "(timeout = 60)")
+
+func db_Drain(th *Thread, args []Value) Value {
+	th.Dbms().Drain(ToInt(args[0]))
+	return nil
+}
+
 var _ = staticMethod(db_Dump, "(table = '', to = '', publicKey = '')")
 
 func db_Dump(th *Thread, args []Value) Value {
@@ -72,12 +85,32 @@ func db_Dump(th *Thread, args []Value) Value {
 		SuObjectOf(SuStr("Database.Dump"), args[0], args[1], args[2]))
 }
 
+var _ = staticMethod(db_Export, "(table, to = '', format = 'csv')")
+
+func db_Export(th *Thread, args []Value) Value {
+	if dbms, ok := th.Dbms().(*dbms.DbmsLocal); ok {
+		return IntVal(dbms.Export(ToStr(args[0]), ToStr(args[1]), ToStr(args[2])))
+	}
+	return th.Dbms().Exec(th,
+		SuObjectOf(SuStr("Database.Export"), args[0], args[1], args[2]))
+}
+
 var _ = staticMethod(db_Final, "()")
 
 func db_Final(th *Thread, args []Value) Value {
 	return IntVal(th.Dbms().Final())
 }
 
+var _ = staticMethod(db_Import, "(table, from = '', format = 'csv')")
+
+func db_Import(th *Thread, args []Value) Value {
+	if dbms, ok := th.Dbms().(*dbms.DbmsLocal); ok {
+		return IntVal(dbms.Import(ToStr(args[0]), ToStr(args[1]), ToStr(args[2])))
+	}
+	return th.Dbms().Exec(th,
+		SuObjectOf(SuStr("Database.Import"), args[0], args[1], args[2]))
+}
+
 var _ = staticMethod(db_Info, "()")
 
 func db_Info(th *Thread, args []Value) Value {
@@ -100,6 +133,13 @@ func db_Load(th *Thread, args []Value) Value {
 		SuObjectOf(SuStr("Database.Load"), args[0], args[1], args[2], args[3]))
 }
 
+var _ = staticMethod(db_Maintenance, "(on = true)")
+
+func db_Maintenance(th *Thread, args []Value) Value {
+	th.Dbms().Maintenance(ToBool(args[0]))
+	return nil
+}
+
 var _ = staticMethod(db_Nonce, "()")
 
 func db_Nonce(th *Thread, args []Value) Value {
@@ -170,3 +210,49 @@ func DoWithoutTriggers(th *Thread, args []Value) Value {
 	}
 	return th.Call(args[1])
 }
+
+var _ = builtin(DbChanges, "(tables, block, from = 0)")
+
+// DbChanges calls block with each committed change (output, update, delete)
+// to the tables (or all tables if empty) in commit order,
+// starting from the from position.
+// It returns the position to continue from.
+// The feed is in memory, not durable, and changes are only recorded
+// while it is being polled, so after a restart or an idle period
+// it will throw if from is no longer available.
+func DbChanges(th *Thread, args []Value) (result Value) {
+	dbms := th.Dbms()
+	var tables []string
+	ob := ToContainer(args[0])
+	for i := 0; i < ob.ListSize(); i++ {
+		tables = append(tables, ToStr(ob.ListGet(i)))
+	}
+	from := ToInt64(args[2])
+	defer func() {
+		if e := recover(); e != nil {
+			if e != BlockBreak {
+				panic(e)
+			}
+			result = Int64Val(from)
+		}
+	}()
+	for {
+		list, next := dbms.Changes(tables, from)
+		for i := 0; i < list.ListSize(); i++ {
+			c := list.ListGet(i)
+			from = ToInt64(c.Get(th, SuStr("seq"))) + 1
+			func() {
+				defer func() {
+					if e := recover(); e != nil && e != BlockContinue {
+						panic(e)
+					}
+				}()
+				th.Call(args[1], c)
+			}()
+		}
+		from = next
+		if list.ListSize() == 0 {
+			return Int64Val(from)
+		}
+	}
+}
@@ -4,14 +4,13 @@
 package builtin
 
 import (
-	"log"
-
 	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/util/logging"
 )
 
 var _ = builtin(ErrorLog, "(string)")
 
-func ErrorLog(arg Value) Value {
-	log.Println(ToStrOrString(arg))
+func ErrorLog(th *Thread, args []Value) Value {
+	logging.Println("suneido", th.Session(), ToStrOrString(args[0]))
 	return nil
 }
@@ -0,0 +1,221 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package builtin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"golang.org/x/exp/maps"
+)
+
+// Http is a builtin class for making HTTP(S) requests.
+// It returns an object with status, headers, and body.
+// Chunked responses are handled automatically.
+// If toFile is a file name or a File opened for writing,
+// the response body is streamed to it and the returned body is "".
+// caFile is a PEM file of additional certificate authorities to trust.
+// Redirects are followed up to maxRedirects,
+// if maxRedirects is 0 the redirect response is returned.
+// timeout (in seconds) covers the whole request,
+// except when streaming to toFile where it only covers
+// connecting and receiving the response headers
+// so large downloads are not cut off.
+// A timeout of 0 means no timeout.
+
+type suHttp struct {
+	staticClass[suHttp]
+}
+
+func init() {
+	Global.Builtin("Http", &suHttp{})
+}
+
+func (*suHttp) String() string {
+	return "Http /* builtin class */"
+}
+
+func (h *suHttp) Equal(other any) bool {
+	return h == other
+}
+
+func (*suHttp) Lookup(_ *Thread, method string) Callable {
+	return httpMethods[method]
+}
+
+var httpMethods = methods()
+
+var _ = staticMethod(http_Members, "()")
+
+func http_Members() Value {
+	return SuObjectOfStrs(maps.Keys(httpMethods))
+}
+
+var _ = staticMethod(http_Get, "(url, headers = #(), timeout = 60, "+
+	"toFile = false, caFile = '', maxRedirects = 10)")
+
+func http_Get(url, headers, timeout, toFile, caFile, maxRedirects Value) Value {
+	return httpRequest("GET", url, headers, EmptyStr, timeout, toFile, caFile,
+		maxRedirects)
+}
+
+var _ = staticMethod(http_Post, "(url, headers = #(), body = '', timeout = 60, "+
+	"toFile = false, caFile = '', maxRedirects = 10)")
+
+func http_Post(url, headers, body, timeout, toFile, caFile,
+	maxRedirects Value) Value {
+	return httpRequest("POST", url, headers, body, timeout, toFile, caFile,
+		maxRedirects)
+}
+
+var _ = staticMethod(http_Request, "(method, url, headers = #(), body = '', "+
+	"timeout = 60, toFile = false, caFile = '', maxRedirects = 10)")
+
+func http_Request(_ *Thread, args []Value) Value {
+	return httpRequest(strings.ToUpper(ToStr(args[0])),
+		args[1], args[2], args[3], args[4], args[5], args[6], args[7])
+}
+
+func httpRequest(method string, url, headers, body, timeout, toFile,
+	caFile, maxRedirects Value) Value {
+	req, err := http.NewRequest(method, ToStr(url),
+		strings.NewReader(AsStr(body)))
+	if err != nil {
+		panic("Http: " + err.Error())
+	}
+	if hdrs, ok := headers.ToContainer(); ok {
+		iter := hdrs.ToObject().Iter2(false, true)
+		for k, v := iter(); k != nil; k, v = iter() {
+			req.Header.Set(ToStr(k), AsStr(v))
+		}
+	}
+	maxr := ToInt(maxRedirects)
+	limit := time.Duration(ToInt(timeout)) * time.Second
+	var total time.Duration
+	// state is set to 1 when the response arrives or 2 if the timer fires,
+	// whichever is first, so a response that arrived is never cancelled
+	var state atomic.Int32
+	timed := false
+	if toFile == False {
+		total = limit
+	} else if limit > 0 {
+		// only limit getting the response, not streaming the body
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		timer := time.AfterFunc(limit, func() {
+			if state.CompareAndSwap(0, 2) {
+				cancel()
+			}
+		})
+		defer timer.Stop()
+		req = req.WithContext(ctx)
+		timed = true
+	}
+	client := &http.Client{
+		Transport: httpTransport(ToStr(caFile)),
+		Timeout:   total,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if maxr == 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxr {
+				return errors.New("stopped after " + strconv.Itoa(maxr) +
+					" redirects")
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if timed && !state.CompareAndSwap(0, 1) {
+		if err == nil {
+			resp.Body.Close()
+		}
+		panic("Http: timeout")
+	}
+	if err != nil {
+		panic("Http: " + err.Error())
+	}
+	defer resp.Body.Close()
+	result := &SuObject{}
+	result.Set(SuStr("status"), IntVal(resp.StatusCode))
+	hdrs := &SuObject{}
+	for k, v := range resp.Header {
+		hdrs.Set(SuStr(strings.ToLower(k)), SuStr(strings.Join(v, ", ")))
+	}
+	result.Set(SuStr("headers"), hdrs)
+	result.Set(SuStr("body"), httpBody(resp.Body, toFile))
+	return result
+}
+
+// httpBody reads the response body, or streams it to toFile
+func httpBody(r io.Reader, toFile Value) Value {
+	if toFile == False {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			panic("Http: " + err.Error())
+		}
+		return SuStr(string(body))
+	}
+	var err error
+	if sf, ok := toFile.(*suFile); ok {
+		sfOpenWrite(sf)
+		var n int64
+		n, err = io.Copy(sf.w, r)
+		sf.tell += n
+	} else {
+		var f *os.File
+		f, err = os.Create(ToStr(toFile))
+		if err == nil {
+			_, err = io.Copy(f, r)
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}
+	}
+	if err != nil {
+		panic("Http: " + err.Error())
+	}
+	return EmptyStr
+}
+
+// httpTransports caches transports by caFile
+// so connections can be reused
+var httpTransports = map[string]*http.Transport{}
+var httpLock sync.Mutex
+
+func httpTransport(caFile string) *http.Transport {
+	httpLock.Lock()
+	defer httpLock.Unlock()
+	if t, ok := httpTransports[caFile]; ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			panic("Http: " + err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			panic("Http: no certificates found in " + caFile)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	httpTransports[caFile] = t
+	return t
+}
@@ -0,0 +1,125 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package builtin
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestHttp(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Test", r.Header.Get("X-Test"))
+		w.Write(body)
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range []string{"one ", "two ", "three"} {
+			w.Write([]byte(s))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("slow "))
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		w.Write([]byte("body"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/chunked", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	url := SuStr(srv.URL)
+	get := func(path string, maxRedirects int) *SuObject {
+		return http_Get(url+SuStr(path), &SuObject{}, IntVal(10), False,
+			EmptyStr, IntVal(maxRedirects)).(*SuObject)
+	}
+	str := func(ob *SuObject, mem string) string {
+		return ToStrOrString(ob.Get(nil, SuStr(mem)))
+	}
+
+	hdrs := &SuObject{}
+	hdrs.Set(SuStr("X-Test"), SuStr("hello"))
+	result := http_Request(nil, []Value{SuStr("put"), url + "/echo", hdrs,
+		SuStr("some data"), IntVal(10), False, EmptyStr, IntVal(10)}).(*SuObject)
+	assert.T(t).This(str(result, "status")).Is("200")
+	assert.T(t).This(str(result, "body")).Is("some data")
+	resphdrs := result.Get(nil, SuStr("headers")).(*SuObject)
+	assert.T(t).This(str(resphdrs, "x-method")).Is("PUT")
+	assert.T(t).This(str(resphdrs, "x-test")).Is("hello")
+
+	result = get("/chunked", 10)
+	assert.T(t).This(str(result, "body")).Is("one two three")
+
+	result = get("/redirect", 10)
+	assert.T(t).This(str(result, "status")).Is("200")
+	assert.T(t).This(str(result, "body")).Is("one two three")
+	result = get("/redirect", 0)
+	assert.T(t).This(str(result, "status")).Is("302")
+	assert.T(t).This(func() { get("/loop", 3) }).Panics("stopped after 3")
+
+	// streaming to a file
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.txt")
+	result = http_Get(url+"/chunked", &SuObject{}, IntVal(10), SuStr(file),
+		EmptyStr, IntVal(10)).(*SuObject)
+	assert.T(t).This(str(result, "body")).Is("")
+	data, _ := os.ReadFile(file)
+	assert.T(t).This(string(data)).Is("one two three")
+	// a timeout of zero is no timeout
+	http_Get(url+"/chunked", &SuObject{}, IntVal(0), SuStr(file),
+		EmptyStr, IntVal(10))
+	data, _ = os.ReadFile(file)
+	assert.T(t).This(string(data)).Is("one two three")
+	// the timeout does not cover streaming the body to a file
+	result = http_Get(url+"/slow", &SuObject{}, IntVal(1), SuStr(file),
+		EmptyStr, IntVal(10)).(*SuObject)
+	data, _ = os.ReadFile(file)
+	assert.T(t).This(string(data)).Is("slow body")
+	assert.T(t).This(func() {
+		http_Get(url+"/slow", &SuObject{}, IntVal(1), False,
+			EmptyStr, IntVal(10))
+	}).Panics("Client.Timeout")
+	sf := newSuFile(file, "a")
+	http_Post(url+"/echo", &SuObject{}, SuStr(" four"), IntVal(10), sf,
+		EmptyStr, IntVal(10))
+	sf.close()
+	data, _ = os.ReadFile(file)
+	assert.T(t).This(string(data)).Is("slow body four")
+}
+
+func TestHttpTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("secure"))
+		}))
+	defer srv.Close()
+	get := func(caFile string) Value {
+		return http_Get(SuStr(srv.URL), &SuObject{}, IntVal(10), False,
+			SuStr(caFile), IntVal(10))
+	}
+	assert.T(t).This(func() { get("") }).Panics("certificate")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: srv.Certificate().Raw})
+	os.WriteFile(caFile, cert, 0644)
+	result := get(caFile).(*SuObject)
+	assert.T(t).This(result.Get(nil, SuStr("body"))).Is(SuStr("secure"))
+}
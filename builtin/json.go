@@ -0,0 +1,24 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package builtin
+
+import (
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+var _ = builtin(jsonEncode, "(value, pretty = false, dateFormat = false)")
+
+func jsonEncode(x, pretty, dateFormat Value) Value {
+	df := ""
+	if dateFormat != False {
+		df = ToStr(dateFormat)
+	}
+	return SuStr(JsonEncodeWith(x, ToBool(pretty), df))
+}
+
+var _ = builtin(jsonDecode, "(string)")
+
+func jsonDecode(arg Value) Value {
+	return JsonDecode(ToStr(arg))
+}
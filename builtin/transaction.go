@@ -87,7 +87,7 @@ var _ = method(tran_QueryDo, "(@args)")
 
 func tran_QueryDo(th *Thread, as *ArgSpec, this Value, args []Value) Value {
 	query, _ := extractQuery(th, &queryParams, as, args)
-	return IntVal(this.(*SuTran).Action(th, query))
+	return this.(*SuTran).Action(th, query)
 }
 
 var _ = method(tran_Query1, "(@args)")
@@ -173,54 +173,65 @@ func TestQueryKeyword(t *testing.T) {
 }
 
 var queryKeywords = map[string]tok.Token{
-	"alter":     tok.Alter,
-	"and":       tok.And,
-	"average":   tok.Average,
-	"by":        tok.By,
-	"cascade":   tok.Cascade,
-	"class":     tok.Class,
-	"count":     tok.Count,
-	"create":    tok.Create,
-	"delete":    tok.Delete,
-	"destroy":   tok.Drop,
-	"drop":      tok.Drop,
-	"ensure":    tok.Ensure,
-	"extend":    tok.Extend,
-	"false":     tok.False,
-	"function":  tok.Function,
-	"history":   tok.History,
-	"in":        tok.In,
-	"index":     tok.Index,
-	"insert":    tok.Insert,
-	"intersect": tok.Intersect,
-	"into":      tok.Into,
-	"is":        tok.Is,
-	"isnt":      tok.Isnt,
-	"join":      tok.Join,
-	"key":       tok.Key,
-	"leftjoin":  tok.Leftjoin,
-	"list":      tok.List,
-	"max":       tok.Max,
-	"min":       tok.Min,
-	"minus":     tok.Minus,
-	"not":       tok.Not,
-	"or":        tok.Or,
-	"project":   tok.Project,
-	"remove":    tok.Remove,
-	"rename":    tok.Rename,
-	"reverse":   tok.Reverse,
-	"set":       tok.Set,
-	"sort":      tok.Sort,
-	"summarize": tok.Summarize,
-	"sview":     tok.Sview,
-	"tempindex": tok.TempIndex,
-	"times":     tok.Times,
-	"to":        tok.To,
-	"total":     tok.Total,
-	"true":      tok.True,
-	"union":     tok.Union,
-	"unique":    tok.Unique,
-	"update":    tok.Update,
-	"view":      tok.View,
-	"where":     tok.Where,
+	"alter":         tok.Alter,
+	"and":           tok.And,
+	"antijoin":      tok.Antijoin,
+	"average":       tok.Average,
+	"by":            tok.By,
+	"cascade":       tok.Cascade,
+	"class":         tok.Class,
+	"concat":        tok.Concat,
+	"count":         tok.Count,
+	"countdistinct": tok.Countdistinct,
+	"create":        tok.Create,
+	"delete":        tok.Delete,
+	"destroy":       tok.Drop,
+	"drop":          tok.Drop,
+	"ensure":        tok.Ensure,
+	"extend":        tok.Extend,
+	"false":         tok.False,
+	"function":      tok.Function,
+	"history":       tok.History,
+	"in":            tok.In,
+	"index":         tok.Index,
+	"insert":        tok.Insert,
+	"intersect":     tok.Intersect,
+	"into":          tok.Into,
+	"is":            tok.Is,
+	"isnt":          tok.Isnt,
+	"join":          tok.Join,
+	"key":           tok.Key,
+	"leftjoin":      tok.Leftjoin,
+	"list":          tok.List,
+	"max":           tok.Max,
+	"median":        tok.Median,
+	"min":           tok.Min,
+	"minus":         tok.Minus,
+	"not":           tok.Not,
+	"or":            tok.Or,
+	"outerjoin":     tok.Outerjoin,
+	"percentile":    tok.Percentile,
+	"project":       tok.Project,
+	"remove":        tok.Remove,
+	"rename":        tok.Rename,
+	"reverse":       tok.Reverse,
+	"semijoin":      tok.Semijoin,
+	"set":           tok.Set,
+	"sort":          tok.Sort,
+	"stddev":        tok.Stddev,
+	"summarize":     tok.Summarize,
+	"sview":         tok.Sview,
+	"tempindex":     tok.TempIndex,
+	"times":         tok.Times,
+	"to":            tok.To,
+	"total":         tok.Total,
+	"true":          tok.True,
+	"union":         tok.Union,
+	"unique":        tok.Unique,
+	"update":        tok.Update,
+	"upsert":        tok.Upsert,
+	"variance":      tok.Variance,
+	"view":          tok.View,
+	"where":         tok.Where,
+	"window":        tok.Window,
 }
@@ -108,6 +108,9 @@ func queryKeyword(s string) (tok.Token, string) {
 			return tok.Where, s
 		}
 	case 6:
+		if s == "concat" {
+			return tok.Concat, s
+		}
 		if s == "create" {
 			return tok.Create, s
 		}
@@ -120,6 +123,12 @@ func queryKeyword(s string) (tok.Token, string) {
 		if s == "insert" {
 			return tok.Insert, s
 		}
+		if s == "median" {
+			return tok.Median, s
+		}
+		if s == "stddev" {
+			return tok.Stddev, s
+		}
 		if s == "extend" {
 			return tok.Extend, s
 		}
@@ -135,6 +144,12 @@ func queryKeyword(s string) (tok.Token, string) {
 		if s == "update" {
 			return tok.Update, s
 		}
+		if s == "upsert" {
+			return tok.Upsert, s
+		}
+		if s == "window" {
+			return tok.Window, s
+		}
 	case 7:
 		if s == "average" {
 			return tok.Average, s
@@ -158,10 +173,22 @@ func queryKeyword(s string) (tok.Token, string) {
 		if s == "function" {
 			return tok.Function, s
 		}
+		if s == "antijoin" {
+			return tok.Antijoin, s
+		}
 		if s == "leftjoin" {
 			return tok.Leftjoin, s
 		}
+		if s == "semijoin" {
+			return tok.Semijoin, s
+		}
+		if s == "variance" {
+			return tok.Variance, s
+		}
 	case 9:
+		if s == "outerjoin" {
+			return tok.Outerjoin, s
+		}
 		if s == "intersect" {
 			return tok.Intersect, s
 		}
@@ -171,6 +198,14 @@ func queryKeyword(s string) (tok.Token, string) {
 		if s == "tempindex" {
 			return tok.TempIndex, s
 		}
+	case 10:
+		if s == "percentile" {
+			return tok.Percentile, s
+		}
+	case 13:
+		if s == "countdistinct" {
+			return tok.Countdistinct, s
+		}
 	}
 	return tok.Identifier, s
 }
@@ -107,52 +107,63 @@ func _() {
 	_ = x[QueryStart-96]
 	_ = x[SummarizeStart-97]
 	_ = x[Average-98]
-	_ = x[Count-99]
-	_ = x[List-100]
-	_ = x[Max-101]
-	_ = x[Min-102]
-	_ = x[Total-103]
-	_ = x[SummarizeEnd-104]
-	_ = x[Alter-105]
-	_ = x[By-106]
-	_ = x[Cascade-107]
-	_ = x[Create-108]
-	_ = x[Delete-109]
-	_ = x[Drop-110]
-	_ = x[Ensure-111]
-	_ = x[Extend-112]
-	_ = x[History-113]
-	_ = x[Index-114]
-	_ = x[Insert-115]
-	_ = x[Intersect-116]
-	_ = x[Into-117]
-	_ = x[Join-118]
-	_ = x[Key-119]
-	_ = x[Leftjoin-120]
-	_ = x[Lower-121]
-	_ = x[Minus-122]
-	_ = x[Project-123]
-	_ = x[Remove-124]
-	_ = x[Rename-125]
-	_ = x[Reverse-126]
-	_ = x[Set-127]
-	_ = x[Sort-128]
-	_ = x[Summarize-129]
-	_ = x[Sview-130]
-	_ = x[TempIndex-131]
-	_ = x[Times-132]
-	_ = x[To-133]
-	_ = x[Union-134]
-	_ = x[Unique-135]
-	_ = x[Update-136]
-	_ = x[View-137]
-	_ = x[Where-138]
-	_ = x[Ntokens-139]
+	_ = x[Concat-99]
+	_ = x[Count-100]
+	_ = x[Countdistinct-101]
+	_ = x[List-102]
+	_ = x[Max-103]
+	_ = x[Median-104]
+	_ = x[Min-105]
+	_ = x[Percentile-106]
+	_ = x[Stddev-107]
+	_ = x[Total-108]
+	_ = x[Variance-109]
+	_ = x[SummarizeEnd-110]
+	_ = x[Alter-111]
+	_ = x[Antijoin-112]
+	_ = x[By-113]
+	_ = x[Cascade-114]
+	_ = x[Create-115]
+	_ = x[Delete-116]
+	_ = x[Drop-117]
+	_ = x[Ensure-118]
+	_ = x[Extend-119]
+	_ = x[History-120]
+	_ = x[Index-121]
+	_ = x[Insert-122]
+	_ = x[Intersect-123]
+	_ = x[Into-124]
+	_ = x[Join-125]
+	_ = x[Key-126]
+	_ = x[Leftjoin-127]
+	_ = x[Lower-128]
+	_ = x[Minus-129]
+	_ = x[Outerjoin-130]
+	_ = x[Project-131]
+	_ = x[Remove-132]
+	_ = x[Rename-133]
+	_ = x[Reverse-134]
+	_ = x[Semijoin-135]
+	_ = x[Set-136]
+	_ = x[Sort-137]
+	_ = x[Summarize-138]
+	_ = x[Sview-139]
+	_ = x[TempIndex-140]
+	_ = x[Times-141]
+	_ = x[To-142]
+	_ = x[Union-143]
+	_ = x[Unique-144]
+	_ = x[Update-145]
+	_ = x[Upsert-146]
+	_ = x[View-147]
+	_ = x[Where-148]
+	_ = x[Window-149]
+	_ = x[Ntokens-150]
 }
 
-const _Token_name = "NilEofErrorIdentifierNumberStringSymbolWhitespaceCommentNewlineHashCommaSemicolonAtLParenRParenLBracketRBracketLCurlyRCurlyRangeToRangeLenOpsStartNotBitNotNewDotCompareStartIsIsntMatchMatchNotLtLteGtGteCompareEndQMarkColonAssocStartAndOrBitOrBitAndBitXorAddSubCatMulDivAssocEndModLShiftRShiftIncDecStartIncPostIncDecPostDecIncDecEndAssignStartEqAddEqSubEqCatEqMulEqDivEqModEqLShiftEqRShiftEqBitOrEqBitAndEqBitXorEqAssignEndInBreakCaseCatchClassContinueDefaultDoElseFalseForForeverFunctionIfReturnSwitchSuperThisThrowTrueTryWhileQueryStartSummarizeStartAverageCountListMaxMinTotalSummarizeEndAlterByCascadeCreateDeleteDropEnsureExtendHistoryIndexInsertIntersectIntoJoinKeyLeftjoinLowerMinusProjectRemoveRenameReverseSetSortSummarizeSviewTempIndexTimesToUnionUniqueUpdateViewWhereNtokens"
+const _Token_name = "NilEofErrorIdentifierNumberStringSymbolWhitespaceCommentNewlineHashCommaSemicolonAtLParenRParenLBracketRBracketLCurlyRCurlyRangeToRangeLenOpsStartNotBitNotNewDotCompareStartIsIsntMatchMatchNotLtLteGtGteCompareEndQMarkColonAssocStartAndOrBitOrBitAndBitXorAddSubCatMulDivAssocEndModLShiftRShiftIncDecStartIncPostIncDecPostDecIncDecEndAssignStartEqAddEqSubEqCatEqMulEqDivEqModEqLShiftEqRShiftEqBitOrEqBitAndEqBitXorEqAssignEndInBreakCaseCatchClassContinueDefaultDoElseFalseForForeverFunctionIfReturnSwitchSuperThisThrowTrueTryWhileQueryStartSummarizeStartAverageConcatCountCountdistinctListMaxMedianMinPercentileStddevTotalVarianceSummarizeEndAlterAntijoinByCascadeCreateDeleteDropEnsureExtendHistoryIndexInsertIntersectIntoJoinKeyLeftjoinLowerMinusOuterjoinProjectRemoveRenameReverseSemijoinSetSortSummarizeSviewTempIndexTimesToUnionUniqueUpdateUpsertViewWhereWindowNtokens"
 
-var _Token_index = [...]uint16{0, 3, 6, 11, 21, 27, 33, 39, 49, 56, 63, 67, 72, 81, 83, 89, 95, 103, 111, 117, 123, 130, 138, 146, 149, 155, 158, 161, 173, 175, 179, 184, 192, 194, 197, 199, 202, 212, 217, 222, 232, 235, 237, 242, 248, 254, 257, 260, 263, 266, 269, 277, 280, 286, 292, 303, 306, 313, 316, 323, 332, 343, 345, 350, 355, 360, 365, 370, 375, 383, 391, 398, 406, 414, 423, 425, 430, 434, 439, 444, 452, 459, 461, 465, 470, 473, 480, 488, 490, 496, 502, 507, 511, 516, 520, 523, 528, 538, 552, 559, 564, 568, 571, 574, 579, 591, 596, 598, 605, 611, 617, 621, 627, 633, 640, 645, 651, 660, 664, 668, 671, 679, 684, 689, 696, 702, 708, 715, 718, 722, 731, 736, 745, 750, 752, 757, 763, 769, 773, 778, 785}
+var _Token_index = [...]uint16{0, 3, 6, 11, 21, 27, 33, 39, 49, 56, 63, 67, 72, 81, 83, 89, 95, 103, 111, 117, 123, 130, 138, 146, 149, 155, 158, 161, 173, 175, 179, 184, 192, 194, 197, 199, 202, 212, 217, 222, 232, 235, 237, 242, 248, 254, 257, 260, 263, 266, 269, 277, 280, 286, 292, 303, 306, 313, 316, 323, 332, 343, 345, 350, 355, 360, 365, 370, 375, 383, 391, 398, 406, 414, 423, 425, 430, 434, 439, 444, 452, 459, 461, 465, 470, 473, 480, 488, 490, 496, 502, 507, 511, 516, 520, 523, 528, 538, 552, 559, 565, 570, 583, 587, 590, 596, 599, 609, 615, 620, 628, 640, 645, 653, 655, 662, 668, 674, 678, 684, 690, 697, 702, 708, 717, 721, 725, 728, 736, 741, 746, 755, 762, 768, 774, 781, 789, 792, 796, 805, 810, 819, 824, 826, 831, 837, 843, 849, 853, 858, 864, 871}
 
 func (i Token) String() string {
 	if i >= Token(len(_Token_index)-1) {
@@ -113,13 +113,20 @@ const (
 	QueryStart
 	SummarizeStart
 	Average
+	Concat
 	Count
+	Countdistinct
 	List
 	Max
+	Median
 	Min
+	Percentile
+	Stddev
 	Total
+	Variance
 	SummarizeEnd
 	Alter
+	Antijoin
 	By
 	Cascade
 	Create
@@ -137,10 +144,12 @@ const (
 	Leftjoin
 	Lower
 	Minus
+	Outerjoin
 	Project
 	Remove
 	Rename
 	Reverse
+	Semijoin
 	Set
 	Sort
 	Summarize
@@ -151,8 +160,10 @@ const (
 	Union
 	Unique
 	Update
+	Upsert
 	View
 	Where
+	Window
 	Ntokens
 )
 
@@ -12,6 +12,18 @@ type IDbms interface {
 	// Auth authorizes the connection with the server
 	Auth(*Thread, string) bool
 
+	// Backup copies the database to a new database file,
+	// without blocking other activity.
+	// If base is not "" it only writes the changes since base,
+	// a previous full or incremental backup.
+	// It returns the size of the database as of the backup.
+	Backup(to, base string) uint64
+
+	// Changes returns a list of committed changes to the given tables
+	// (all tables if empty) starting from the from position,
+	// and the position to continue from
+	Changes(tables []string, from int64) (*SuObject, int64)
+
 	// Check checks the database like -check
 	// It returns "" or an error message.
 	Check() string
@@ -29,6 +41,13 @@ type IDbms interface {
 	Cursors() int
 
 	DisableTrigger(table string)
+
+	// Drain stops the server accepting new connections and transactions,
+	// waits up to timeout seconds for transactions to finish,
+	// and then shuts down the server.
+	// While draining, Info has mode "draining" and the shutdown date.
+	Drain(timeout int)
+
 	EnableTrigger(table string)
 
 	// Exec is used by the new style ServerEval(...)
@@ -59,6 +78,10 @@ type IDbms interface {
 	// Log writes to the server's error.log
 	Log(string)
 
+	// Maintenance turns maintenance mode on or off.
+	// In maintenance mode the server only allows admin connections.
+	Maintenance(on bool)
+
 	// Nonce returns a random string from the server
 	Nonce(*Thread) string
 
@@ -117,9 +140,10 @@ type ITran interface {
 	// Query starts a query
 	Query(query string, sv *Sviews) IQuery
 
-	// Action executes an insert, update, or delete
-	// and returns the number of records processed
-	Action(th *Thread, action string) int
+	// Action executes an insert, update, upsert, or delete
+	// and returns the number of records processed,
+	// or for upsert, #(inserted: n, updated: n)
+	Action(th *Thread, action string) Value
 
 	// Update modifies a record
 	Update(th *Thread, table string, off uint64, rec Record) uint64
@@ -0,0 +1,430 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apmckinlay/gsuneido/core/types"
+)
+
+// JsonEncode returns the JSON for a value.
+// Objects and records with only list members become arrays,
+// otherwise they become JSON objects with list members keyed by index.
+// Numbers are converted without losing precision.
+// Dates become strings in JsonDateFormat.
+func JsonEncode(x Value) string {
+	return JsonEncodeWith(x, false, "")
+}
+
+// JsonEncodeWith is JsonEncode with options.
+// If pretty is true the output is indented, one member per line.
+// If dateFormat is not "" it is used (with SuDate Format) for dates.
+func JsonEncodeWith(x Value, pretty bool, dateFormat string) string {
+	je := jsonEncoder{pretty: pretty, dateFormat: dateFormat}
+	je.encode(x, 0)
+	return je.sb.String()
+}
+
+// JsonDateFormat is the ISO 8601 layout (without a time zone)
+// used for dates by JsonEncode and IsoDate
+const JsonDateFormat = "2006-01-02T15:04:05.000"
+
+// IsoDate returns a date as a string in JsonDateFormat
+func IsoDate(d SuDate) string {
+	return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d.%03d", d.Year(), d.Month(),
+		d.Day(), d.Hour(), d.Minute(), d.Second(), d.Millisecond())
+}
+
+// ParseIsoDate converts a string in JsonDateFormat to a date.
+// It returns NilDate if the string is not in that format.
+func ParseIsoDate(s string) SuDate {
+	if len(s) != len(JsonDateFormat) || s[10] != 'T' {
+		return NilDate
+	}
+	t, err := time.Parse(JsonDateFormat, s)
+	if err != nil {
+		return NilDate
+	}
+	return NewDate(t.Year(), int(t.Month()), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1_000_000)
+}
+
+const jsonMaxDepth = 100
+
+type jsonEncoder struct {
+	sb         strings.Builder
+	pretty     bool
+	dateFormat string
+}
+
+func (je *jsonEncoder) encode(x Value, depth int) {
+	if depth > jsonMaxDepth {
+		panic("JsonEncode: nesting too deep")
+	}
+	sb := &je.sb
+	if x == True {
+		sb.WriteString("true")
+	} else if x == False {
+		sb.WriteString("false")
+	} else if s, ok := x.ToStr(); ok {
+		jsonString(sb, s)
+	} else if x.Type() == types.Number {
+		sb.WriteString(JsonNumber(x))
+	} else if d, ok := x.(SuDate); ok {
+		if je.dateFormat != "" {
+			jsonString(sb, d.Format(je.dateFormat))
+		} else {
+			jsonString(sb, IsoDate(d))
+		}
+	} else if ob, ok := x.ToContainer(); ok {
+		je.object(ob.ToObject(), depth)
+	} else {
+		panic("JsonEncode: can't convert " + ErrType(x))
+	}
+}
+
+// JsonNumber returns the JSON text for a number, with a leading zero
+// before the decimal point where Suneido would omit it
+func JsonNumber(x Value) string {
+	dn := ToDnum(x)
+	if dn.IsInf() {
+		panic("JsonEncode: can't convert infinite number")
+	}
+	s := dn.String()
+	if strings.HasPrefix(s, ".") {
+		s = "0" + s
+	} else if strings.HasPrefix(s, "-.") {
+		s = "-0" + s[1:]
+	}
+	return s
+}
+
+func (je *jsonEncoder) object(ob *SuObject, depth int) {
+	sb := &je.sb
+	if ob.NamedSize() == 0 {
+		if ob.ListSize() == 0 {
+			sb.WriteString("[]")
+			return
+		}
+		sb.WriteByte('[')
+		for i := 0; i < ob.ListSize(); i++ {
+			je.separator(i, depth)
+			je.encode(ob.ListGet(i), depth+1)
+		}
+		je.newline(depth)
+		sb.WriteByte(']')
+		return
+	}
+	sb.WriteByte('{')
+	iter := ob.Iter2(true, true)
+	i := 0
+	for k, v := iter(); k != nil; k, v = iter() {
+		je.separator(i, depth)
+		i++
+		jsonString(sb, ToStrOrString(k))
+		sb.WriteByte(':')
+		if je.pretty {
+			sb.WriteByte(' ')
+		}
+		je.encode(v, depth+1)
+	}
+	je.newline(depth)
+	sb.WriteByte('}')
+}
+
+// separator writes the comma (if not the first member)
+// and, if pretty, the newline and indent
+func (je *jsonEncoder) separator(i int, depth int) {
+	if i > 0 {
+		je.sb.WriteByte(',')
+	}
+	je.newline(depth + 1)
+}
+
+func (je *jsonEncoder) newline(depth int) {
+	if je.pretty {
+		je.sb.WriteByte('\n')
+		for range depth {
+			je.sb.WriteString("    ")
+		}
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+// jsonString writes a quoted string.
+// Suneido strings are bytes. Valid UTF-8 is written as is,
+// other than escaping quotes, backslashes, and control characters.
+// Bytes that are not valid UTF-8 are written as \ufffd
+// so the result is still valid JSON.
+func jsonString(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				sb.WriteString(s[start:i])
+				sb.WriteString(`\ufffd`)
+				start = i + 1
+			} else {
+				i += n - 1
+			}
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
+		}
+		sb.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteString(`\u00`)
+			sb.WriteByte(hexDigits[c>>4])
+			sb.WriteByte(hexDigits[c&0xf])
+		}
+		start = i + 1
+	}
+	sb.WriteString(s[start:])
+	sb.WriteByte('"')
+}
+
+//-------------------------------------------------------------------
+
+// JsonDecode converts JSON to a Suneido value.
+// Arrays become list objects and objects become objects with named members.
+// Numbers are converted without losing precision.
+// null members of objects are omitted, null array elements are "".
+func JsonDecode(s string) Value {
+	jd := jsonDecoder{s: s}
+	jd.skipSpace()
+	x := jd.value(0)
+	jd.skipSpace()
+	if jd.i < len(jd.s) {
+		jd.error("unexpected " + strconv.Quote(jd.s[jd.i:jd.i+1]))
+	}
+	if x == nil {
+		return EmptyStr
+	}
+	return x
+}
+
+type jsonDecoder struct {
+	s string
+	i int
+}
+
+func (jd *jsonDecoder) error(msg string) {
+	panic(fmt.Sprint("JsonDecode: ", msg, " at position ", jd.i))
+}
+
+func (jd *jsonDecoder) skipSpace() {
+	for jd.i < len(jd.s) {
+		switch jd.s[jd.i] {
+		case ' ', '\t', '\r', '\n':
+			jd.i++
+		default:
+			return
+		}
+	}
+}
+
+func (jd *jsonDecoder) peek() byte {
+	if jd.i >= len(jd.s) {
+		jd.error("unexpected end")
+	}
+	return jd.s[jd.i]
+}
+
+func (jd *jsonDecoder) match(c byte) {
+	jd.skipSpace()
+	if jd.peek() != c {
+		jd.error("expected " + strconv.Quote(string(c)))
+	}
+	jd.i++
+}
+
+// value returns nil for null
+func (jd *jsonDecoder) value(depth int) Value {
+	if depth > jsonMaxDepth {
+		jd.error("nesting too deep")
+	}
+	jd.skipSpace()
+	switch c := jd.peek(); {
+	case c == '{':
+		return jd.object(depth)
+	case c == '[':
+		return jd.array(depth)
+	case c == '"':
+		return SuStr(jd.string())
+	case c == '-' || ('0' <= c && c <= '9'):
+		return jd.number()
+	case strings.HasPrefix(jd.s[jd.i:], "true"):
+		jd.i += 4
+		return True
+	case strings.HasPrefix(jd.s[jd.i:], "false"):
+		jd.i += 5
+		return False
+	case strings.HasPrefix(jd.s[jd.i:], "null"):
+		jd.i += 4
+		return nil
+	}
+	jd.error("unexpected " + strconv.Quote(jd.s[jd.i:jd.i+1]))
+	return nil
+}
+
+func (jd *jsonDecoder) object(depth int) Value {
+	ob := &SuObject{}
+	jd.i++ // skip {
+	jd.skipSpace()
+	if jd.peek() == '}' {
+		jd.i++
+		return ob
+	}
+	for {
+		jd.skipSpace()
+		if jd.peek() != '"' {
+			jd.error("expected string")
+		}
+		key := jd.string()
+		jd.match(':')
+		if val := jd.value(depth + 1); val != nil {
+			ob.Set(SuStr(key), val)
+		}
+		jd.skipSpace()
+		if jd.peek() == '}' {
+			jd.i++
+			return ob
+		}
+		jd.match(',')
+	}
+}
+
+func (jd *jsonDecoder) array(depth int) Value {
+	ob := &SuObject{}
+	jd.i++ // skip [
+	jd.skipSpace()
+	if jd.peek() == ']' {
+		jd.i++
+		return ob
+	}
+	for {
+		val := jd.value(depth + 1)
+		if val == nil {
+			val = EmptyStr
+		}
+		ob.Add(val)
+		jd.skipSpace()
+		if jd.peek() == ']' {
+			jd.i++
+			return ob
+		}
+		jd.match(',')
+	}
+}
+
+func (jd *jsonDecoder) number() Value {
+	start := jd.i
+	for jd.i < len(jd.s) && strings.IndexByte("+-0123456789.eE", jd.s[jd.i]) != -1 {
+		jd.i++
+	}
+	return jsonNum(jd, jd.s[start:jd.i])
+}
+
+func jsonNum(jd *jsonDecoder, s string) (result Value) {
+	defer func() {
+		if e := recover(); e != nil {
+			jd.error("invalid number " + strconv.Quote(s))
+		}
+	}()
+	return NumFromString(s)
+}
+
+func (jd *jsonDecoder) string() string {
+	jd.i++ // skip opening quote
+	start := jd.i
+	// fast path for no escapes
+	for jd.i < len(jd.s) && jd.s[jd.i] != '"' && jd.s[jd.i] != '\\' {
+		jd.i++
+	}
+	if jd.peek() == '"' {
+		jd.i++
+		return jd.s[start : jd.i-1]
+	}
+	var sb strings.Builder
+	sb.WriteString(jd.s[start:jd.i])
+	for {
+		c := jd.peek()
+		jd.i++
+		if c == '"' {
+			return sb.String()
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		c = jd.peek()
+		jd.i++
+		switch c {
+		case '"', '\\', '/':
+			sb.WriteByte(c)
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			r := jd.hex4()
+			if utf16IsSurrogate(r) && strings.HasPrefix(jd.s[jd.i:], `\u`) {
+				jd.i += 2
+				r = utf16Decode(r, jd.hex4())
+			}
+			sb.WriteRune(r)
+		default:
+			jd.error("invalid escape")
+		}
+	}
+}
+
+func (jd *jsonDecoder) hex4() rune {
+	if jd.i+4 > len(jd.s) {
+		jd.error("invalid escape")
+	}
+	n, err := strconv.ParseUint(jd.s[jd.i:jd.i+4], 16, 32)
+	if err != nil {
+		jd.error("invalid escape")
+	}
+	jd.i += 4
+	return rune(n)
+}
+
+func utf16IsSurrogate(r rune) bool {
+	return 0xd800 <= r && r < 0xdc00
+}
+
+func utf16Decode(r1, r2 rune) rune {
+	if 0xdc00 <= r2 && r2 < 0xe000 {
+		return (r1-0xd800)<<10 | (r2 - 0xdc00) + 0x10000
+	}
+	return utf8.RuneError
+}
@@ -0,0 +1,91 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestJsonEncode(t *testing.T) {
+	assert := assert.T(t).This
+	test := func(x Value, expected string) {
+		t.Helper()
+		assert(JsonEncode(x)).Is(expected)
+	}
+	test(True, "true")
+	test(False, "false")
+	test(SuStr(`a"b\c`+"\n\x01é"), `"a\"b\\c\n\u0001é"`)
+	test(SuStr("a\xffb\xc3"), `"a\ufffdb\ufffd"`)
+	test(IntVal(123), "123")
+	test(NumFromString(".5"), "0.5")
+	test(NumFromString("-.25"), "-0.25")
+	test(NumFromString("1234567890123456"), "1234567890123456")
+	test(NumFromString("1e20"), "1e20")
+	test(NewDate(2023, 1, 2, 3, 4, 5, 6), `"2023-01-02T03:04:05.006"`)
+	test(&SuObject{}, "[]")
+	test(SuObjectOf(One, SuStr("a")), `[1,"a"]`)
+	ob := SuObjectOf(One)
+	ob.Set(SuStr("b"), SuObjectOf(True))
+	test(ob, `{"0":1,"b":[true]}`)
+	assert(func() { JsonEncode(&SuClass{}) }).Panics("can't convert")
+}
+
+func TestJsonEncodeWith(t *testing.T) {
+	assert := assert.T(t).This
+	ob := SuObjectOf(One, &SuObject{})
+	ob.Set(SuStr("d"), NewDate(2023, 1, 2, 3, 4, 5, 6))
+	assert(JsonEncodeWith(ob, false, "yyyy-MM-dd")).
+		Is(`{"0":1,"1":[],"d":"2023-01-02"}`)
+	assert(JsonEncodeWith(SuObjectOf(ob, SuStr("x")), true, "")).
+		Is(`[
+    {
+        "0": 1,
+        "1": [],
+        "d": "2023-01-02T03:04:05.006"
+    },
+    "x"
+]`)
+}
+
+func TestJsonDecode(t *testing.T) {
+	assert := assert.T(t).This
+	test := func(s string, expected Value) {
+		t.Helper()
+		assert(JsonDecode(s)).Is(expected)
+	}
+	test("true", True)
+	test(" false ", False)
+	test("null", EmptyStr)
+	test(`"a\"b\\c\né😀"`, SuStr("a\"b\\c\né😀"))
+	test("123", IntVal(123))
+	test("-0.5", NumFromString("-.5"))
+	test("12345678901234567", NumFromString("12345678901234567"))
+	test("1.5e-10", NumFromString("1.5e-10"))
+	test("[]", &SuObject{})
+	test(`[1, "a", null]`, SuObjectOf(One, SuStr("a"), EmptyStr))
+	ob := &SuObject{}
+	ob.Set(SuStr("a"), SuObjectOf(True))
+	test(`{"a": [true], "b": null}`, ob)
+	assert(func() { JsonDecode("[1,") }).Panics("unexpected end")
+	assert(func() { JsonDecode("[1] x") }).Panics("unexpected")
+	assert(func() { JsonDecode("{1:2}") }).Panics("expected string")
+	assert(func() { JsonDecode("1.2.3") }).Panics("invalid number")
+	assert(func() { JsonDecode("nul") }).Panics("unexpected")
+
+	x := SuObjectOf(SuStr("x"), NumFromString("1.25"))
+	x.Set(SuStr("d"), SuStr("é"))
+	assert(JsonDecode(JsonEncode(x)).(*SuObject).Get(nil, SuStr("d"))).
+		Is(SuStr("é"))
+}
+
+func TestIsoDate(t *testing.T) {
+	assert := assert.T(t).This
+	d := NewDate(2023, 12, 31, 23, 59, 58, 999)
+	assert(IsoDate(d)).Is("2023-12-31T23:59:58.999")
+	assert(ParseIsoDate(IsoDate(d))).Is(d)
+	assert(ParseIsoDate("2023-12-31")).Is(NilDate)
+	assert(ParseIsoDate("2023-13-31T23:59:58.999")).Is(NilDate)
+}
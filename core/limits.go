@@ -0,0 +1,103 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package core
+
+import (
+	"strconv"
+	"time"
+)
+
+// Limits are optional resource limits for a single request.
+// They are set by the dbms server (see dbms/limits.go)
+// and reset along with the rest of the Thread.
+// Zero means no limit.
+// Limits also count the rows read
+// and record the query strategy for the slow request log.
+type Limits struct {
+	// Deadline is the time limit for executing the request
+	Deadline time.Time
+	// MaxRows is the maximum number of rows read from tables
+	MaxRows int
+	// MaxTempIndex is the maximum size of temp index data (bytes)
+	MaxTempIndex int
+	rows         int
+	tempIndex    int
+	strategy     func() string
+}
+
+func (th *Thread) SetLimits(lim *Limits) {
+	th.limits = lim
+}
+
+// LimitRead is called by queries for each row read from a table.
+// It panics if the rows read or the time limit is exceeded.
+func (th *Thread) LimitRead() {
+	if th == nil || th.limits == nil {
+		return
+	}
+	lim := th.limits
+	lim.rows++
+	if lim.MaxRows > 0 && lim.rows > lim.MaxRows {
+		panic("query rows read limit exceeded (" +
+			strconv.Itoa(lim.MaxRows) + ")")
+	}
+	lim.checkTime()
+}
+
+// LimitTime panics if the time limit is exceeded.
+// It is called by query operations that can take significant time
+// without reading rows e.g. building temp indexes and summarize.
+func (th *Thread) LimitTime() {
+	if th == nil || th.limits == nil {
+		return
+	}
+	th.limits.checkTime()
+}
+
+func (lim *Limits) checkTime() {
+	if !lim.Deadline.IsZero() && time.Now().After(lim.Deadline) {
+		panic("query time limit exceeded")
+	}
+}
+
+// RowsRead returns the number of rows read from tables by the request
+func (th *Thread) RowsRead() int {
+	if th.limits == nil {
+		return 0
+	}
+	return th.limits.rows
+}
+
+// SetStrategy is called by queries that are not kept after the request
+// (e.g. GetOne) so the slow request log can get their strategy.
+// fn is only called if the request is slow.
+func (th *Thread) SetStrategy(fn func() string) {
+	if th != nil && th.limits != nil {
+		th.limits.strategy = fn
+	}
+}
+
+// Strategy returns the strategy recorded by SetStrategy, or ""
+func (th *Thread) Strategy() string {
+	if th.limits == nil || th.limits.strategy == nil {
+		return ""
+	}
+	return th.limits.strategy()
+}
+
+// LimitTempIndex is called by temp index for the data it adds.
+// nbytes is negative if the temp index drops data (e.g. top rows).
+// It panics if the temp index size or the time limit is exceeded.
+func (th *Thread) LimitTempIndex(nbytes int) {
+	if th == nil || th.limits == nil {
+		return
+	}
+	lim := th.limits
+	lim.tempIndex += nbytes
+	if lim.MaxTempIndex > 0 && lim.tempIndex > lim.MaxTempIndex {
+		panic("temp index size limit exceeded (" +
+			strconv.Itoa(lim.MaxTempIndex) + " bytes)")
+	}
+	lim.checkTime()
+}
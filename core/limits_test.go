@@ -0,0 +1,42 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestLimits(t *testing.T) {
+	assert := assert.T(t)
+	var th *Thread
+	th.LimitRead() // nil Thread is ok
+	th = &Thread{}
+	th.LimitRead() // no limits is ok
+	th.LimitTempIndex(1000)
+	th.LimitTime()
+	th.SetStrategy(func() string { return "ignored" }) // no limits is ok
+	assert.This(th.Strategy()).Is("")
+
+	th.SetLimits(&Limits{MaxRows: 2, MaxTempIndex: 100})
+	th.LimitRead()
+	th.LimitRead()
+	assert.This(th.LimitRead).Panics("rows read limit exceeded (2)")
+	th.SetStrategy(func() string { return "strategy" })
+	assert.This(th.Strategy()).Is("strategy")
+	th.LimitTempIndex(60)
+	assert.This(func() { th.LimitTempIndex(60) }).
+		Panics("temp index size limit exceeded (100 bytes)")
+
+	th.SetLimits(&Limits{Deadline: time.Now().Add(-time.Second)})
+	assert.This(th.LimitRead).Panics("query time limit exceeded")
+	assert.This(th.LimitTime).Panics("query time limit exceeded")
+	assert.This(func() { th.LimitTempIndex(1) }).
+		Panics("query time limit exceeded")
+
+	th.Reset()
+	th.LimitRead()
+}
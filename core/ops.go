@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"os"
 	"runtime"
 	"strings"
 
@@ -16,6 +15,7 @@ import (
 	"github.com/apmckinlay/gsuneido/options"
 	"github.com/apmckinlay/gsuneido/util/dbg"
 	"github.com/apmckinlay/gsuneido/util/dnum"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/regex"
 )
 
@@ -325,22 +325,26 @@ func ToSuExcept(th *Thread, e any) *SuExcept {
 	return se
 }
 
+// printSuStack writes the Suneido call stack to the log output
+// as a single write so it is one record if the log is JSON
 func printSuStack(th *Thread, e any) {
+	var sb strings.Builder
 	if th.Name != "" {
-		fmt.Fprintln(os.Stderr, th.Name)
+		fmt.Fprintln(&sb, th.Name)
 	}
 	if se, ok := e.(*SuExcept); ok {
-		PrintStack(se.Callstack)
+		printStack(&sb, se.Callstack)
 	} else {
-		th.PrintStack()
+		th.printStack(&sb, 20)
 	}
+	log.Writer().Write([]byte(sb.String()))
 }
 
 // LogInternalError logs the error and the call stacks, if an InternalError.
 // It is used by dbmsserver
 func LogInternalError(th *Thread, from string, e any) {
 	if isRuntimeError(e) {
-		log.Println("ERROR", from, e)
+		logging.Println("dbms", from, "ERROR", from, e)
 		dbg.PrintStack()
 		printSuStack(th, e)
 	} else if s, ok := e.(string); ok {
@@ -357,7 +361,8 @@ func logStringError(th *Thread, e string) {
 }
 
 func LogUncaught(th *Thread, where string, e any) {
-	log.Println("ERROR", "uncaught in", where+":", e)
+	logging.Println("suneido", th.Session(),
+		"ERROR", "uncaught in", where+":", e)
 	if isRuntimeError(e) {
 		dbg.PrintStack()
 	}
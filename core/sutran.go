@@ -119,7 +119,7 @@ func (st *SuTran) ReadCount() int {
 	return st.itran.ReadCount()
 }
 
-func (st *SuTran) Action(th *Thread, action string) int {
+func (st *SuTran) Action(th *Thread, action string) Value {
 	st.ckActive()
 	return st.itran.Action(th, action)
 }
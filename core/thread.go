@@ -91,6 +91,9 @@ type thread1 struct {
 	// Sviews are the session view definitions for this thread
 	sv *Sviews
 
+	// limits are optional resource limits set by the dbms server
+	limits *Limits
+
 	Rand *rand.Rand
 }
 
@@ -270,13 +273,17 @@ func (th *Thread) printStack(w io.Writer, levels int) {
 }
 
 func PrintStack(cs *SuObject) {
+	printStack(os.Stderr, cs)
+}
+
+func printStack(w io.Writer, cs *SuObject) {
 	if cs == nil {
 		return
 	}
 	for i := 0; i < cs.ListSize(); i++ {
 		frame := cs.ListGet(i)
 		fn := frame.Get(nil, SuStr("fn"))
-		fmt.Fprintln(os.Stderr, fn)
+		fmt.Fprintln(w, fn)
 	}
 }
 
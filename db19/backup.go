@@ -0,0 +1,245 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package db19
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/util/cksum"
+)
+
+// StateEnd returns the offset just past this state i.e. the size of a
+// database that ends with this state. It returns 0 if the state
+// has not been persisted.
+func (state *DbState) StateEnd() uint64 {
+	if state.Off == 0 {
+		return 0
+	}
+	return state.Off + uint64(stateLen)
+}
+
+// WriteSnapshot writes a valid database file containing the store
+// up to and including the given persisted state.
+// Since the store is append-only and persisted states are immutable
+// this can run concurrently with other database activity.
+// It returns the size of the resulting database.
+func WriteSnapshot(state *DbState, w io.Writer) (uint64, error) {
+	size := state.StateEnd()
+	if size == 0 {
+		return 0, errors.New("no persisted state")
+	}
+	hdr := make([]byte, len(magic)+stor.SmallOffsetLen)
+	copy(hdr, magic)
+	stor.WriteSmallOffset(hdr[len(magic):], size)
+	if _, err := w.Write(hdr); err != nil {
+		return 0, err
+	}
+	if err := copyStore(state.store, w, uint64(len(hdr)), size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// copyStore writes the store contents from the from offset
+// up to (but not including) the to offset.
+// Data is written chunk by chunk, as returned by Stor.Data,
+// so gaps at the end of chunks are preserved and offsets are unchanged.
+func copyStore(store *stor.Stor, w io.Writer, from, to uint64) error {
+	for off := from; off < to; {
+		buf := store.Data(off)
+		n := min(uint64(len(buf)), to-off)
+		if n == 0 {
+			return errors.New("copy: store too short")
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+		off += n
+	}
+	return nil
+}
+
+// incremental backups ----------------------------------------------
+
+// An increment is a manifest followed by the store contents
+// from the end of the base backup to the end of a newer state.
+// The base can be a full backup (a database file) or a previous increment.
+// The manifest records the base size, a checksum of the base's last state,
+// and the new size, so that increments can only be applied in order.
+
+const incrMagic = "gsincr01"
+const incrHdrLen = len(incrMagic) + stor.SmallOffsetLen + 4 +
+	stor.SmallOffsetLen + cksum.Len
+
+var crc32table = crc32.MakeTable(crc32.Castagnoli)
+
+// stateCksum validates the bytes of a state and returns a checksum of them
+func stateCksum(state []byte) (uint32, error) {
+	if len(state) != stateLen || string(state[:len(magic1)]) != magic1 ||
+		string(state[magic2at:]) != magic2 || !cksum.Check(state[:magic2at]) {
+		return 0, errors.New("invalid state")
+	}
+	return crc32.Checksum(state, crc32table), nil
+}
+
+// BackupEnd returns the size and the checksum of the last state
+// of a backup file, either a full backup or an increment.
+// This is the information required to make an increment from it.
+func BackupEnd(filename string) (size uint64, ck uint32, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	hdr := make([]byte, incrHdrLen)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		return 0, 0, err
+	}
+	var stateOff int64
+	if string(hdr[:len(incrMagic)]) == incrMagic {
+		var base uint64
+		var baseCk uint32
+		if base, baseCk, size, err = readIncrHdr(hdr); err != nil {
+			return 0, 0, err
+		}
+		if size == base {
+			return size, baseCk, nil // empty increment
+		}
+		stateOff = int64(incrHdrLen) + int64(size-base) - int64(stateLen)
+	} else if string(hdr[:len(magicBase)]) == magicBase {
+		size = stor.ReadSmallOffset(hdr[len(magic):])
+		stateOff = int64(size) - int64(stateLen)
+	} else {
+		return 0, 0, errors.New("not a database or increment: " + filename)
+	}
+	if stateOff < 0 {
+		return 0, 0, errors.New("invalid backup: " + filename)
+	}
+	state := make([]byte, stateLen)
+	if _, err := f.ReadAt(state, stateOff); err != nil {
+		return 0, 0, err
+	}
+	if ck, err = stateCksum(state); err != nil {
+		return 0, 0, errors.New("invalid backup: " + filename)
+	}
+	return size, ck, nil
+}
+
+// WriteIncrement writes an increment containing the store
+// from the end of a base backup (baseSize) up to and including
+// the given persisted state.
+// It verifies that the base matches the database.
+// It returns the size of the resulting database.
+func WriteIncrement(state *DbState, baseSize uint64, baseCk uint32,
+	w io.Writer) (uint64, error) {
+	size := state.StateEnd()
+	if size == 0 {
+		return 0, errors.New("no persisted state")
+	}
+	if baseSize < uint64(stateLen) || baseSize > size {
+		return 0, errors.New("base does not match database")
+	}
+	ck, err := stateCksum(state.store.Data(baseSize - uint64(stateLen))[:stateLen])
+	if err != nil || ck != baseCk {
+		return 0, errors.New("base does not match database")
+	}
+	if _, err := w.Write(incrHdr(baseSize, baseCk, size)); err != nil {
+		return 0, err
+	}
+	if err := copyStore(state.store, w, baseSize, size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func incrHdr(base uint64, ck uint32, size uint64) []byte {
+	hdr := make([]byte, 0, incrHdrLen)
+	hdr = append(hdr, incrMagic...)
+	hdr = stor.AppendSmallOffset(hdr, base)
+	hdr = binary.BigEndian.AppendUint32(hdr, ck)
+	hdr = stor.AppendSmallOffset(hdr, size)
+	hdr = hdr[:incrHdrLen]
+	cksum.Update(hdr)
+	return hdr
+}
+
+func readIncrHdr(hdr []byte) (base uint64, ck uint32, size uint64, err error) {
+	if string(hdr[:len(incrMagic)]) != incrMagic || !cksum.Check(hdr) {
+		return 0, 0, 0, errors.New("invalid increment")
+	}
+	i := len(incrMagic)
+	base = stor.ReadSmallOffset(hdr[i:])
+	i += stor.SmallOffsetLen
+	ck = binary.BigEndian.Uint32(hdr[i:])
+	i += 4
+	size = stor.ReadSmallOffset(hdr[i:])
+	if size < base {
+		return 0, 0, 0, errors.New("invalid increment")
+	}
+	return base, ck, size, nil
+}
+
+// ApplyIncrement appends an increment to a database file
+// after verifying that it follows on from the current contents.
+// The result is validated by reading the new final state.
+// It returns the new size of the database.
+func ApplyIncrement(dbfile, incr string) (uint64, error) {
+	size, ck, err := BackupEnd(dbfile)
+	if err != nil {
+		return 0, err
+	}
+	src, err := os.Open(incr)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	hdr := make([]byte, incrHdrLen)
+	if _, err := io.ReadFull(src, hdr); err != nil {
+		return 0, err
+	}
+	base, baseCk, newSize, err := readIncrHdr(hdr)
+	if err != nil {
+		return 0, errors.New(err.Error() + ": " + incr)
+	}
+	if base != size || baseCk != ck {
+		return 0, errors.New("increment does not follow database: " + incr)
+	}
+	if err := appendIncr(dbfile, src, size, newSize); err != nil {
+		return 0, err
+	}
+	db, err := OpenDb(dbfile, stor.Read, false) // reads the new state
+	if err != nil {
+		return 0, err
+	}
+	db.Close()
+	return newSize, nil
+}
+
+func appendIncr(dbfile string, src io.Reader, size, newSize uint64) error {
+	dst, err := os.OpenFile(dbfile, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := dst.Truncate(int64(size)); err != nil { // remove any padding
+		return err
+	}
+	if _, err := dst.Seek(int64(size), io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(dst, src, int64(newSize-size)); err != nil {
+		return err
+	}
+	buf := make([]byte, stor.SmallOffsetLen)
+	stor.WriteSmallOffset(buf, newSize)
+	if _, err := dst.WriteAt(buf, int64(len(magic))); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
@@ -0,0 +1,141 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package db19
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+// changes is a change data capture feed of committed row changes
+// (outputs, updates, and deletes) in commit order.
+// Update transactions accumulate their changes
+// and add them to the feed when they commit.
+//
+// This is NOT durable change data capture.
+// The feed is in memory and only retains the most recent changesMax changes.
+// It is lost when the database is closed.
+// To avoid the memory cost, changes are only retained while there is
+// a subscriber, i.e. Changes has been called within changesIdle.
+// Whether a transaction's changes are retained is decided when it commits,
+// so transactions that started before a subscriber are still included.
+//
+// Sequence numbers start from the time (in milliseconds * 1000)
+// when the feed is (re)started, so they increase across restarts,
+// and positions from a previous run (or from before the feed was idle)
+// will be reported as no longer available
+// rather than silently skipping changes.
+//
+// NOTE: Schema changes and table loads are not included.
+type changes struct {
+	lock sync.Mutex
+	// list is the retained changes, with contiguous sequence numbers
+	list []Change
+	// next is the sequence number for the next change
+	next int64
+	// polled is when Changes was last called (unix milli)
+	polled atomic.Int64
+}
+
+// changesMax is the number of changes retained
+const changesMax = 10000
+
+// changesIdle is how long changes are recorded after the last Changes call
+const changesIdle = time.Minute
+
+// Change is a committed output, update, or delete.
+// For an output Old is "", for a delete New is "".
+type Change struct {
+	Table   string
+	Columns []string
+	Old     Record
+	New     Record
+	Seq     int64
+	// Asof is when the commit added the change to the feed (unix milli).
+	// It is not the same as the database state asof.
+	Asof int64
+}
+
+// active returns whether there is a subscriber to the feed
+func (cs *changes) active() bool {
+	return time.Now().UnixMilli()-cs.polled.Load() < changesIdle.Milliseconds()
+}
+
+// add is called by UpdateTran.commit
+// which is single threaded so changes are added in commit order.
+// active is checked with the lock held so a commit is either
+// before a restart (and skipped) or after it (and retained).
+func (cs *changes) add(list []Change) {
+	if len(list) == 0 {
+		return
+	}
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if !cs.active() {
+		return
+	}
+	asof := time.Now().UnixMilli()
+	for _, c := range list {
+		c.Seq = cs.next
+		c.Asof = asof
+		cs.next++
+		cs.list = append(cs.list, c)
+	}
+	if len(cs.list) > 2*changesMax {
+		// trim periodically rather than on every add
+		cs.list = slices.Clone(cs.list[len(cs.list)-changesMax:])
+	}
+}
+
+// poll is called by Changes (with the lock held).
+// If the feed was idle, changes were not recorded,
+// so it restarts with a gap in the sequence numbers.
+func (cs *changes) poll() {
+	now := time.Now().UnixMilli()
+	if !cs.active() {
+		cs.list = nil
+		cs.next = max(cs.next+1, now*1000)
+	}
+	cs.polled.Store(now)
+}
+
+// Changes returns the committed changes to the given tables
+// (or to all tables if tables is empty) with sequence numbers from from,
+// and the sequence number to continue from.
+// A from of zero means the oldest change retained.
+// The records returned are limited to roughly maxSize bytes,
+// but at least one change is returned if there is one.
+// It panics if from is no longer available.
+func (db *Database) Changes(tables []string, from int64, maxSize int) (
+	list []Change, next int64) {
+	cs := &db.changes
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.poll()
+	oldest := cs.next - int64(len(cs.list))
+	if from == 0 {
+		from = oldest
+	} else if from < oldest {
+		panic("changes before " + Int64Val(oldest).String() +
+			" are no longer available")
+	} else if from > cs.next {
+		panic("invalid changes position: " + Int64Val(from).String())
+	}
+	size := 0
+	for _, c := range cs.list[from-oldest:] {
+		if size > 0 && size+len(c.Old)+len(c.New) > maxSize {
+			break
+		}
+		from = c.Seq + 1
+		if len(tables) == 0 || slices.Contains(tables, c.Table) {
+			list = append(list, c)
+			size += len(c.Old) + len(c.New) + 1
+		}
+	}
+	return list, from
+}
@@ -0,0 +1,119 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package db19
+
+import (
+	"testing"
+
+	"github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestChanges(t *testing.T) {
+	assert := assert.T(t)
+	db, err := CreateDb(stor.HeapStor(8192))
+	ck(err)
+	db.CheckerSync()
+	createTbl(db)
+
+	// not retained without a subscriber
+	ut := db.NewUpdateTran()
+	ut.Output(nil, "mytable", mkrec("x", "unsubscribed"))
+	db.CommitMerge(ut)
+
+	// started before subscribing but committed after
+	rec1 := mkrec("a", "one")
+	rec2 := mkrec("b", "two")
+	ut = db.NewUpdateTran()
+	ut.Output(nil, "mytable", rec1)
+
+	list, start := db.Changes(nil, 0, 1000)
+	assert.This(len(list)).Is(0)
+
+	ut.Output(nil, "mytable", rec2)
+	list, _ = db.Changes(nil, start, 1000)
+	assert.This(len(list)).Is(0) // not committed
+	db.CommitMerge(ut)
+
+	ut = db.NewUpdateTran()
+	key := ut.getSchema("mytable").Indexes[0].Ixspec.Key(rec1)
+	off := ut.Lookup("mytable", 0, key).Off
+	rec3 := mkrec("a", "three")
+	off = ut.Update(nil, "mytable", off, rec3)
+	ut.Delete(nil, "mytable", off)
+	db.CommitMerge(ut)
+
+	ut = db.NewUpdateTran()
+	ut.Output(nil, "mytable", mkrec("c", "aborted"))
+	ut.Abort()
+
+	list, next := db.Changes(nil, start, 1000)
+	assert.This(len(list)).Is(4)
+	assert.This(next).Is(start + 4)
+	assert.This(list[0].Seq).Is(start)
+	assert.This(list[0].Table).Is("mytable")
+	assert.This(list[0].Columns).Is([]string{"one", "two"})
+	assert.This(list[0].Old).Is(core.Record(""))
+	assert.This(list[0].New).Is(rec1)
+	assert.This(list[1].New).Is(rec2)
+	assert.This(list[2].Old).Is(rec1)
+	assert.This(list[2].New).Is(rec3)
+	assert.This(list[3].Old).Is(rec3)
+	assert.This(list[3].New).Is(core.Record(""))
+	assert.That(list[0].Asof <= list[2].Asof && list[2].Asof > 0)
+
+	// from zero is the oldest
+	list, _ = db.Changes(nil, 0, 1000)
+	assert.This(len(list)).Is(4)
+
+	// continue from next
+	list, next2 := db.Changes(nil, next, 1000)
+	assert.This(len(list)).Is(0)
+	assert.This(next2).Is(next)
+
+	// limited size, but at least one
+	list, next = db.Changes(nil, start, 1)
+	assert.This(len(list)).Is(1)
+	assert.This(next).Is(start + 1)
+
+	// filtered by table
+	list, next = db.Changes([]string{"other"}, start, 1000)
+	assert.This(len(list)).Is(0)
+	assert.This(next).Is(start + 4)
+
+	assert.This(func() { db.Changes(nil, start-1, 1000) }).
+		Panics("no longer available")
+	assert.This(func() { db.Changes(nil, next+1, 1000) }).
+		Panics("invalid changes position")
+}
+
+func TestChangesTrim(t *testing.T) {
+	var cs changes
+	cs.poll()
+	for i := 0; i < 3*changesMax; i++ {
+		cs.add([]Change{{Table: "tbl"}})
+	}
+	assert.T(t).That(len(cs.list) <= 2*changesMax)
+	assert.T(t).This(cs.list[len(cs.list)-1].Seq).Is(cs.next - 1)
+	assert.T(t).This(cs.list[0].Seq).Is(cs.next - int64(len(cs.list)))
+}
+
+func TestChangesIdle(t *testing.T) {
+	var cs changes
+	cs.poll()
+	cs.add([]Change{{Table: "tbl"}})
+	next := cs.next
+	assert.T(t).That(cs.active())
+
+	cs.polled.Store(0) // idle
+	assert.T(t).That(!cs.active())
+	cs.add([]Change{{Table: "tbl"}})
+	assert.T(t).This(cs.next).Is(next) // not recorded
+
+	cs.poll()
+	assert.T(t).That(cs.active())
+	assert.T(t).This(len(cs.list)).Is(0)
+	assert.T(t).That(cs.next > next) // old positions are no longer available
+}
@@ -4,13 +4,13 @@
 package db19
 
 import (
-	"log"
 	"math"
 	rand "math/rand/v2"
 	"strconv"
 
 	"github.com/apmckinlay/gsuneido/util/assert"
 	"github.com/apmckinlay/gsuneido/util/generic/atomics"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/ordset"
 	"github.com/apmckinlay/gsuneido/util/ranges"
 )
@@ -132,7 +132,8 @@ var logAt = 100
 
 func (ck *Check) StartTran() *CkTran {
 	if ck.count() > logAt {
-		log.Println("outstanding transactions reached", logAt)
+		logging.Println("checker", "",
+			"outstanding transactions reached", logAt)
 		logAt += 100
 	}
 	if ck.count() >= MaxTrans {
@@ -611,7 +612,8 @@ func (ck *Check) tick() {
 	for tn, t := range ck.actvTran {
 		if ck.clock-t.birth >= MaxAge {
 			traceln("abort", tn, "age", ck.clock-t.birth)
-			log.Println("aborted", t, "update transaction longer than", MaxAge, "seconds")
+			logging.Println("checker", "", "aborted", t,
+				"update transaction longer than", MaxAge, "seconds")
 			ck.abort(tn, "transaction exceeded max age")
 		}
 	}
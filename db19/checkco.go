@@ -5,11 +5,12 @@ package db19
 
 import (
 	"fmt"
-	"log"
+	"os"
 	"time"
 
 	"github.com/apmckinlay/gsuneido/util/dbg"
 	"github.com/apmckinlay/gsuneido/util/exit"
+	"github.com/apmckinlay/gsuneido/util/logging"
 )
 
 // CheckCo is the concurrent, channel based interface to Check
@@ -228,7 +229,8 @@ func checker(ck *Check, c chan any, mergeChan chan todo) {
 	defer func() {
 		if e := recover(); e != nil {
 			dbg.PrintStack()
-			log.Fatalln("FATAL ERROR in checker:", e)
+			logging.Println("checker", "", "FATAL ERROR in checker:", e)
+			os.Exit(1)
 		}
 	}()
 	ticker := time.NewTicker(time.Second)
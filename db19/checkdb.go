@@ -84,6 +84,18 @@ func (db *Database) MustCheck() {
 	}
 }
 
+// CheckTable does a full check of a single table.
+// It is used by load to verify tables that were loaded previously.
+func (db *Database) CheckTable(table string) (ec error) {
+	defer func() {
+		if e := recover(); e != nil {
+			ec = newErrCorrupt(e)
+		}
+	}()
+	checkTable(db.GetState(), table)
+	return nil
+}
+
 func checkTable(state *DbState, table string) {
 	info := state.Meta.GetRoInfo(table)
 	sc := state.Meta.GetRoSchema(table)
@@ -4,12 +4,13 @@
 package db19
 
 import (
-	"log"
+	"os"
 	"time"
 
 	"github.com/apmckinlay/gsuneido/db19/meta"
 	"github.com/apmckinlay/gsuneido/util/dbg"
 	"github.com/apmckinlay/gsuneido/util/exit"
+	"github.com/apmckinlay/gsuneido/util/logging"
 )
 
 type void = struct{}
@@ -39,7 +40,8 @@ func merger(db *Database, prevState *DbState, mergeChan chan todo,
 	defer func() {
 		if e := recover(); e != nil {
 			dbg.PrintStack()
-			log.Fatalln("FATAL ERROR in merger:", e)
+			logging.Println("merger", "", "FATAL ERROR in merger:", e)
+			os.Exit(1)
 		}
 	}()
 	em := startMergeWorkers()
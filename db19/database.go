@@ -5,7 +5,6 @@ package db19
 
 import (
 	"errors"
-	"log"
 	"os"
 	"sync/atomic"
 
@@ -17,10 +16,12 @@ import (
 	"github.com/apmckinlay/gsuneido/db19/meta/schema"
 	"github.com/apmckinlay/gsuneido/db19/stor"
 	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
 	"github.com/apmckinlay/gsuneido/util/cksum"
 	"github.com/apmckinlay/gsuneido/util/exit"
 	"github.com/apmckinlay/gsuneido/util/generic/set"
 	"github.com/apmckinlay/gsuneido/util/hacks"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/sortlist"
 )
 
@@ -30,6 +31,7 @@ import (
 type Database struct {
 	ck Checker
 	triggers
+	changes
 	Store *stor.Stor
 
 	// state is the central immutable state of the database.
@@ -37,6 +39,8 @@ type Database struct {
 	state stateHolder
 
 	mode stor.Mode
+	// standby is set by OpenStandby
+	standby bool
 	// schemaLock is used to prevent concurrent schema modification
 	schemaLock atomic.Bool
 
@@ -79,6 +83,17 @@ func OpenDatabase(filename string) (*Database, error) {
 	return OpenDb(filename, stor.Update, true)
 }
 
+// OpenDbTrimmed opens a database for update after discarding anything
+// following the size in its header, i.e. after the last Checkpoint.
+// It is used to resume an interrupted load.
+// NOTE: The returned Database does not have a checker.
+func OpenDbTrimmed(filename string) (*Database, error) {
+	if err := trimToHeader(filename); err != nil {
+		return nil, err
+	}
+	return OpenDatabase(filename)
+}
+
 // OpenDb opens the database in the named file.
 // NOTE: The returned Database does not have a checker.
 func OpenDb(filename string, mode stor.Mode, check bool) (db *Database, err error) {
@@ -163,6 +178,17 @@ func (db *Database) OverwriteTable(ts *meta.Schema, ti *meta.Info) {
 	})
 }
 
+// Checkpoint persists the current state and updates the size
+// in the file header, so if the process is interrupted,
+// OpenDbTrimmed can reopen the database as of the checkpoint.
+// It is used by load, which does not have a checker.
+func (db *Database) Checkpoint() {
+	assert.That(db.ck == nil)
+	if state := db.persist(&execPersistSingle{}); state != nil {
+		db.writeSize(state.StateEnd())
+	}
+}
+
 // CheckAllFkeys is used after loading an entire database.
 func (db *Database) CheckAllFkeys() {
 	state := db.GetState()
@@ -527,12 +553,15 @@ func (db *Database) Transactions() []int {
 	if db.corrupted.Load() {
 		return nil
 	}
+	if db.ck == nil { // standby
+		return []int{}
+	}
 	return db.ck.Transactions()
 }
 
 func (db *Database) Final() int {
 	db.ckOpen()
-	if db.corrupted.Load() {
+	if db.corrupted.Load() || db.ck == nil {
 		return 0
 	}
 	return db.ck.Final()
@@ -549,7 +578,7 @@ func (db *Database) Corrupt() {
 	if db.corrupted.Swap(true) {
 		return
 	}
-	log.Println("ERROR database corruption detected")
+	logging.Println("db19", "", "ERROR database corruption detected")
 	options.DbStatus.Store("corrupted")
 	buf := make([]byte, stor.SmallOffsetLen)
 	if db.mode != stor.Read {
@@ -0,0 +1,162 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package db19
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+// Replication ships the store contents from a primary to a standby.
+// Since the store is append-only, a standby is just a copy of a prefix
+// of the primary's file, ending with a persisted state.
+// Data is sent a piece at a time, each piece within a single chunk,
+// so allocating the same sizes on the standby reproduces the offsets.
+// A standby only advances to a new state once it has all the data up to it.
+// Data for a state that has not been completed is discarded on open.
+
+// ReplicaData returns the primary store contents for a standby,
+// starting at from, up to at most the end of the latest persisted state.
+// stateEnd and ck identify the standby's current state,
+// they are verified to ensure the standby is a prefix of this database.
+// The data does not cross a chunk boundary and is at most max bytes.
+// It also returns the end and time of the latest persisted state.
+func (db *Database) ReplicaData(from, stateEnd uint64, ck uint32, max int) (
+	data []byte, end uint64, asof int64, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("replicate: %v", e)
+		}
+	}()
+	state := db.GetState()
+	end = state.StateEnd()
+	if end == 0 {
+		return nil, 0, 0, errors.New("replicate: no persisted state")
+	}
+	if stateEnd < uint64(stateLen) || stateEnd > end || from < stateEnd ||
+		from > end {
+		return nil, 0, 0, errors.New("replicate: standby does not match")
+	}
+	c, err := stateCksum(db.Store.Data(stateEnd - uint64(stateLen))[:stateLen])
+	if err != nil || c != ck {
+		return nil, 0, 0, errors.New("replicate: standby does not match")
+	}
+	_, _, asof = readState(db.Store, state.Off)
+	if from == end {
+		return nil, end, asof, nil
+	}
+	data = db.Store.Data(from)
+	data = data[:min(uint64(len(data)), end-from, uint64(max))]
+	return data, end, asof, nil
+}
+
+// OpenStandby opens a database for a standby server.
+// The store is opened for update so replicated data can be appended,
+// but the database itself is read-only (stor.Read mode).
+// It does not write its own states and it has no checker,
+// so update transactions are not possible.
+// Any partial data following the last complete state is discarded.
+func OpenStandby(filename string) (*Database, error) {
+	if err := trimToHeader(filename); err != nil {
+		return nil, err
+	}
+	store, err := stor.MmapStor(filename, stor.Update)
+	if err != nil {
+		return nil, err
+	}
+	db, err := OpenDbStor(store, stor.Read, true)
+	if err != nil {
+		return nil, err
+	}
+	db.standby = true
+	return db, nil
+}
+
+// trimToHeader truncates a database file to the size in its header.
+// The header of a standby is only updated when it advances to a new state,
+// and the header of a database being loaded is only updated by Checkpoint,
+// so anything after that is incomplete.
+func trimToHeader(filename string) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hdr := make([]byte, len(magic)+stor.SmallOffsetLen)
+	if _, err := io.ReadFull(f, hdr); err != nil {
+		return err
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return errors.New("not a valid database file")
+	}
+	size := stor.ReadSmallOffset(hdr[len(magic):])
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size == 0 || uint64(fi.Size()) <= size {
+		return nil // let OpenDbStor handle it
+	}
+	return f.Truncate(int64(size))
+}
+
+// Standby returns whether the database was opened by OpenStandby
+func (db *Database) Standby() bool {
+	return db.standby
+}
+
+// ReplicaPos returns the position of a standby, the size of its store,
+// and the end, checksum, and time of its current state.
+// The size may be greater than the end
+// if it has received part of the data for the next state.
+func (db *Database) ReplicaPos() (size, end uint64, ck uint32, asof int64) {
+	state := db.GetState()
+	end = state.StateEnd()
+	ck, err := stateCksum(db.Store.Data(state.Off)[:stateLen])
+	if err != nil {
+		panic("replicate: " + err.Error())
+	}
+	return db.Store.Size(), end, ck, state.Asof
+}
+
+// ReplicaAppend appends a piece of data, as returned by ReplicaData,
+// to a standby. end is the end of the primary's latest state.
+// When the data reaches end, the standby advances to that state
+// and the new size is written to the file header,
+// so the file is a valid database as of that state.
+func (db *Database) ReplicaAppend(data []byte, end uint64) (err error) {
+	assert.That(db.standby)
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("replicate: %v", e)
+		}
+	}()
+	if len(data) > 0 {
+		expected := db.Store.Size()
+		off, buf := db.Store.Alloc(len(data))
+		if off != expected {
+			return errors.New("replicate: append offset mismatch")
+		}
+		copy(buf, data)
+	}
+	size := db.Store.Size()
+	if size > end {
+		return errors.New("replicate: append past end")
+	}
+	if size < end || end == db.GetState().StateEnd() {
+		return nil
+	}
+	state := ReadState(db.Store, end-uint64(stateLen))
+	db.state.updateState(func(s *DbState) { *s = *state })
+	db.Store.Flush()
+	buf := make([]byte, stor.SmallOffsetLen)
+	stor.WriteSmallOffset(buf, end)
+	db.Store.Write(uint64(len(magic)), buf)
+	return nil
+}
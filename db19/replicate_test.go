@@ -0,0 +1,76 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package db19
+
+import (
+	"os"
+	"testing"
+
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestReplicate(t *testing.T) {
+	db := createDb()
+	db.CheckerSync()
+	defer func() { db.Close(); os.Remove("tmp.db") }()
+	output := func(n int) {
+		for i := 0; i < n; i++ {
+			db.CommitMerge(output1(db))
+		}
+		db.PersistSync()
+	}
+	output(10)
+
+	const standby = "standby.tmp"
+	f, err := os.Create(standby)
+	ck(err)
+	_, err = WriteSnapshot(db.GetState(), f)
+	ck(err)
+	f.Close()
+	defer os.Remove(standby)
+	sdb, err := OpenStandby(standby)
+	ck(err)
+	assert.T(t).That(sdb.Standby())
+	assert.T(t).This(func() { sdb.NewUpdateTran() }).Panics("standby")
+
+	replicate := func(limit int) {
+		for ; limit > 0; limit-- {
+			size, end, ck2, _ := sdb.ReplicaPos()
+			data, pend, _, err := db.ReplicaData(size, end, ck2, 1000)
+			ck(err)
+			ck(sdb.ReplicaAppend(data, pend))
+			if len(data) == 0 {
+				return
+			}
+		}
+	}
+	nrows := func(db *Database) int {
+		return db.NewReadTran().meta.GetRoInfo("mytable").Nrows
+	}
+	replicate(99) // nothing to do
+	assert.T(t).This(nrows(sdb)).Is(10)
+	output(100)
+	output(100)
+	replicate(99)
+	assert.T(t).This(nrows(sdb)).Is(210)
+	assert.T(t).This(sdb.Store.Size()).Is(db.GetState().StateEnd())
+
+	// mismatched state is rejected
+	size, end, ck2, _ := sdb.ReplicaPos()
+	_, _, _, err = db.ReplicaData(size, end, ck2+1, 1000)
+	assert.T(t).That(err != nil)
+
+	// partial data is discarded on reopen
+	output(100)
+	replicate(2)
+	assert.T(t).This(nrows(sdb)).Is(210)
+	sdb.Close()
+	sdb, err = OpenStandby(standby)
+	ck(err)
+	assert.T(t).This(sdb.Store.Size()).Is(end)
+	replicate(99)
+	assert.T(t).This(nrows(sdb)).Is(310)
+	sdb.Close()
+	ck(CheckDatabase(standby))
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/apmckinlay/gsuneido/db19/stor"
 	"github.com/apmckinlay/gsuneido/util/assert"
 	"github.com/apmckinlay/gsuneido/util/cksum"
+	"github.com/apmckinlay/gsuneido/util/generic/atomics"
 	"github.com/apmckinlay/gsuneido/util/generic/cache"
 )
 
@@ -88,9 +89,13 @@ func (sh *stateHolder) updateState(fn func(*DbState)) {
 
 type mergefn func(*meta.Meta, *mergeList) []meta.MergeUpdate
 
+// MergeTimes and PersistTimes are used for metrics
+var MergeTimes, PersistTimes atomics.Durations
+
 // Merge updates the base ixbuf's with the ones from transactions
 // It is called by concur.go merger.
 func (db *Database) Merge(fn mergefn, merges *mergeList) {
+	defer MergeTimes.Since(time.Now())
 	updates := fn(db.GetState().Meta, merges) // outside UpdateState
 	db.UpdateState(func(state *DbState) {
 		m := *state.Meta // copy
@@ -118,6 +123,7 @@ func (db *Database) persist(exec execPersist) *DbState {
 		return nil
 	}
 	// fmt.Println("persist")
+	defer PersistTimes.Since(time.Now())
 	var newState *DbState
 	db.GetState().Meta.Persist(exec.Submit) // outside UpdateState
 	updates := exec.Results()
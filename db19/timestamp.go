@@ -4,12 +4,12 @@
 package db19
 
 import (
-	"log"
 	"sync"
 	"time"
 
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/util/generic/ints"
+	"github.com/apmckinlay/gsuneido/util/logging"
 )
 
 var timestamp SuDate
@@ -30,7 +30,7 @@ func ticker() {
 		time.Sleep(1 * time.Second)
 		t := Now().WithoutMs()
 		if d := t.MinusMs(prev); ints.Abs(d) > 5000 {
-			log.Println("ERROR: time skip from", prev, "to", t,
+			logging.Println("db19", "", "ERROR: time skip from", prev, "to", t,
 				"=", time.Duration(d)*time.Millisecond)
 		}
 		prev = t
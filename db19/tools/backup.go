@@ -0,0 +1,168 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/util/system"
+)
+
+// BackupDatabase copies a database file that is not in use.
+// If base is not "" it writes an increment from base.
+// It is used by -backup when there is no server running.
+func BackupDatabase(dbfile, to, base string) (size uint64, err error) {
+	db, err := OpenDb(dbfile, stor.Read, false)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return backup(db.GetState(), to, base)
+}
+
+// Backup copies the database, as of a newly persisted state, to a file.
+// Unlike dump, it copies the store directly rather than reading records,
+// so it is fast and it does not block other database activity.
+// If base is "" the result is a valid database file that can be used as is.
+// Otherwise base must be a previous full or incremental backup
+// and only the data added since then is written, as an increment.
+// Increments are applied to a full backup by RestoreIncremental.
+func Backup(db *Database, to, base string) (size uint64, err error) {
+	if db.Corrupted() {
+		return 0, fmt.Errorf("backup not allowed when database is locked")
+	}
+	return backup(db.Persist(), to, base)
+}
+
+func backup(state *DbState, to, base string) (uint64, error) {
+	size, err := writeBackup(state, to, base)
+	if err != nil {
+		return 0, fmt.Errorf("backup failed: %v", err)
+	}
+	return size, nil
+}
+
+func writeBackup(state *DbState, to, base string) (size uint64, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	to = strings.Replace(to, `\`, `/`, -1)
+	f, err := os.CreateTemp(path.Dir(to), "gs*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmpfile := f.Name()
+	defer func() { f.Close(); os.Remove(tmpfile) }()
+	w := bufio.NewWriterSize(f, 1024*1024)
+	if base == "" {
+		size, err = WriteSnapshot(state, w)
+	} else {
+		var baseSize uint64
+		var baseCk uint32
+		baseSize, baseCk, err = BackupEnd(base)
+		if err == nil {
+			size, err = WriteIncrement(state, baseSize, baseCk, w)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		return 0, err
+	}
+	f.Close()
+	if err := system.RenameBak(tmpfile, to); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// RestoreIncremental creates a database from a full backup
+// followed by a chain of increments, in order.
+// Each increment is validated as it is applied,
+// and the final result is fully checked.
+func RestoreIncremental(files []string, to string) (size uint64, err error) {
+	if len(files) < 1 {
+		return 0, fmt.Errorf("restore requires a full backup")
+	}
+	to = strings.Replace(to, `\`, `/`, -1)
+	f, err := os.CreateTemp(path.Dir(to), "gs*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmpfile := f.Name()
+	defer func() { f.Close(); os.Remove(tmpfile) }()
+	if err := copyFile(files[0], f); err != nil {
+		return 0, fmt.Errorf("restore failed: %v", err)
+	}
+	f.Close()
+	for _, incr := range files[1:] {
+		if _, err := ApplyIncrement(tmpfile, incr); err != nil {
+			return 0, fmt.Errorf("restore failed: %v", err)
+		}
+	}
+	if err := CheckDatabase(tmpfile); err != nil {
+		return 0, fmt.Errorf("restore failed: %v", err)
+	}
+	if size, _, err = BackupEnd(tmpfile); err != nil {
+		return 0, fmt.Errorf("restore failed: %v", err)
+	}
+	if err := system.RenameBak(tmpfile, to); err != nil {
+		return 0, fmt.Errorf("restore failed: %v", err)
+	}
+	return size, nil
+}
+
+// RestoreAsof creates a database file containing the database as of
+// the last state persisted at or before asof (unix milli).
+// Since the store is append-only, this is a prefix of the database file,
+// so it has exactly the tables, schema, and views as of that state.
+// It returns the time of the restored state.
+func RestoreAsof(dbfile string, asof int64, to string) (
+	stateAsof int64, size uint64, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("restore failed: %v", e)
+		}
+	}()
+	db, err := OpenDb(dbfile, stor.Read, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+	state := StateAsof(db.Store, asof)
+	if state.Asof > asof {
+		return 0, 0, fmt.Errorf("restore failed: no state as of %v",
+			time.UnixMilli(asof).Format(time.DateTime))
+	}
+	if size, err = writeBackup(state, to, ""); err != nil {
+		return 0, 0, fmt.Errorf("restore failed: %v", err)
+	}
+	return state.Asof, size, nil
+}
+
+func copyFile(from string, dst *os.File) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
@@ -0,0 +1,138 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package tools_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/tools"
+	"github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestBackup(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow TestBackup")
+	}
+	createDb()
+	defer os.Remove(dbName)
+	const bak = "backup_" + dbName
+	defer os.Remove(bak)
+	size, err := tools.BackupDatabase(dbName, bak, "")
+	ck(err)
+	fi, err := os.Stat(bak)
+	ck(err)
+	assert.T(t).This(uint64(fi.Size())).Is(size)
+	ck(db19.CheckDatabase(bak))
+	compareDb(dbName, bak)
+
+	// online
+	db, err := db19.OpenDatabase(dbName)
+	ck(err)
+	db19.StartConcur(db, 50*time.Millisecond)
+	ut := db.NewUpdateTran()
+	query.DoAction(nil, ut, "insert { one: 'x' } into foo")
+	ut.Commit()
+	_, err = tools.Backup(db, bak, "")
+	ck(err)
+	db.Close()
+	defer os.Remove(bak + ".bak")
+	ck(db19.CheckDatabase(bak))
+	compareDb(dbName, bak)
+	bdb, err := db19.OpenDatabase(bak)
+	ck(err)
+	defer bdb.Close()
+	rt := bdb.NewReadTran()
+	assert.T(t).This(rt.GetInfo("foo").Nrows).Is(len(data) + 1)
+}
+
+func TestBackupIncremental(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow TestBackupIncremental")
+	}
+	createDb()
+	defer os.Remove(dbName)
+	const full = "full_" + dbName
+	const incr1 = "incr1_" + dbName
+	const incr2 = "incr2_" + dbName
+	const restored = "restored_" + dbName
+	for _, f := range []string{full, incr1, incr2, restored} {
+		defer os.Remove(f)
+	}
+	_, err := tools.BackupDatabase(dbName, full, "")
+	ck(err)
+
+	db, err := db19.OpenDatabase(dbName)
+	ck(err)
+	db19.StartConcur(db, 50*time.Millisecond)
+	insert := func(key string) {
+		ut := db.NewUpdateTran()
+		query.DoAction(nil, ut, "insert { one: '"+key+"' } into foo")
+		ut.Commit()
+	}
+	insert("x")
+	_, err = tools.Backup(db, incr1, full)
+	ck(err)
+	insert("y")
+	size, err := tools.Backup(db, incr2, incr1)
+	ck(err)
+	_, err = tools.Backup(db, incr2+"x", full+"x") // nonexistent base
+	assert.T(t).That(err != nil)
+	db.Close()
+
+	// out of order
+	_, err = tools.RestoreIncremental([]string{full, incr2}, restored)
+	assert.T(t).That(err != nil)
+
+	n, err := tools.RestoreIncremental([]string{full, incr1, incr2}, restored)
+	ck(err)
+	assert.T(t).This(n).Is(size)
+	compareDb(dbName, restored)
+	rdb, err := db19.OpenDatabase(restored)
+	ck(err)
+	defer rdb.Close()
+	rt := rdb.NewReadTran()
+	assert.T(t).This(rt.GetInfo("foo").Nrows).Is(len(data) + 2)
+}
+
+func TestRestoreAsof(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow TestRestoreAsof")
+	}
+	createDb()
+	defer os.Remove(dbName)
+	const restored = "restored_" + dbName
+	defer os.Remove(restored)
+	db, err := db19.OpenDatabase(dbName)
+	ck(err)
+	db19.StartConcur(db, time.Minute)
+	insert := func(key string) {
+		ut := db.NewUpdateTran()
+		query.DoAction(nil, ut, "insert { one: '"+key+"' } into foo")
+		ut.Commit()
+		time.Sleep(5 * time.Millisecond)
+		db.Persist()
+		time.Sleep(5 * time.Millisecond)
+	}
+	insert("x")
+	asof := time.Now().UnixMilli()
+	insert("y")
+	db.Close()
+
+	stateAsof, _, err := tools.RestoreAsof(dbName, asof, restored)
+	ck(err)
+	assert.T(t).That(stateAsof <= asof)
+	ck(db19.CheckDatabase(restored))
+	rdb, err := db19.OpenDatabase(restored)
+	ck(err)
+	defer rdb.Close()
+	rt := rdb.NewReadTran()
+	assert.T(t).This(rt.GetInfo("foo").Nrows).Is(len(data) + 1)
+
+	_, _, err = tools.RestoreAsof(dbName, asof-time.Hour.Milliseconds(), restored)
+	assert.T(t).That(err != nil)
+}
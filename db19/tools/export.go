@@ -0,0 +1,229 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package tools
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/core/types"
+	. "github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/meta"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/util/system"
+)
+
+// Export and import convert between tables and CSV or JSON Lines (jsonl).
+//
+// Suneido table schemas do not have column types,
+// so the types are recorded in the export and import does not guess.
+//
+// CSV has a header line with the column names.
+// Columns that are not strings have a type suffix e.g. amount:number
+// Strings are written as is, numbers and true/false as text,
+// dates as ISO 8601, and objects and records as JSON.
+// A column with more than one type is :value
+// and the cells are Suneido constants e.g. "abc" or #20240102
+// On import, a column without a type is strings.
+// Empty cells are empty fields.
+//
+// JSON Lines has one JSON object per record with the non-empty fields.
+// Dates (as ISO 8601 strings) and records have a :date or :record suffix
+// on their name since JSON does not distinguish them.
+//
+// NOTE: Dates nested inside objects are exported as strings
+// and are not converted back on import.
+
+// ExportFormat checks the format and returns the default file name
+func ExportFormat(table, format string) string {
+	if format != "csv" && format != "jsonl" {
+		panic("export/import format must be csv or jsonl")
+	}
+	return table + "." + format
+}
+
+// ExportTable is used by -export
+func ExportTable(dbfile, table, format, to string) (nrecs int, err error) {
+	db, err := OpenDb(dbfile, stor.Read, false)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return ExportDbTable(db, table, format, to)
+}
+
+// ExportDbTable writes a table as CSV or JSON Lines.
+// It is used by Database.Export
+func ExportDbTable(db *Database, table, format, to string) (nrecs int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("export failed: %v", e)
+		}
+	}()
+	if to == "" {
+		to = ExportFormat(table, format)
+	}
+	state := db.Persist()
+	sc := state.Meta.GetRoSchema(table)
+	if sc == nil {
+		panic("can't find " + table)
+	}
+	f, err := os.CreateTemp(path.Dir(strings.ReplaceAll(to, `\`, `/`)), "gs*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmpfile := f.Name()
+	defer func() { f.Close(); os.Remove(tmpfile) }()
+	w := bufio.NewWriter(f)
+	if format == "csv" {
+		nrecs = exportCsv(db, state, sc, w)
+	} else if format == "jsonl" {
+		nrecs = exportJsonl(db, state, sc, w)
+	} else {
+		ExportFormat(table, format) // panics
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	f.Close()
+	if err := system.RenameBak(tmpfile, to); err != nil {
+		return 0, err
+	}
+	return nrecs, nil
+}
+
+// exportColumns returns the indexes of the columns that are not deleted
+func exportColumns(sc *meta.Schema) []int {
+	cols := make([]int, 0, len(sc.Columns))
+	for i, col := range sc.Columns {
+		if col != "-" {
+			cols = append(cols, i)
+		}
+	}
+	return cols
+}
+
+func exportCsv(db *Database, state *DbState, sc *meta.Schema,
+	w *bufio.Writer) int {
+	cols := exportColumns(sc)
+	typs := csvColumnTypes(db, state, sc, cols)
+	cw := csv.NewWriter(w)
+	row := make([]string, len(cols))
+	for i, c := range cols {
+		row[i] = sc.Columns[c]
+		if typs[i] != "" {
+			row[i] += ":" + typs[i]
+		}
+	}
+	ck(cw.Write(row))
+	n := exportRecords(db, state, sc.Table, func(rec core.Record) {
+		for i, c := range cols {
+			row[i] = ""
+			if raw := rec.GetRaw(c); raw != "" {
+				row[i] = csvCell(core.Unpack(raw), typs[i])
+			}
+		}
+		ck(cw.Write(row))
+	})
+	cw.Flush()
+	ck(cw.Error())
+	return n
+}
+
+// csvTypes are the CSV column types, strings do not have a type
+var csvTypes = map[types.Type]string{types.Number: "number",
+	types.Boolean: "boolean", types.Date: "date",
+	types.Object: "object", types.Record: "record"}
+
+// csvColumnTypes reads the table to determine the column types
+func csvColumnTypes(db *Database, state *DbState, sc *meta.Schema,
+	cols []int) []string {
+	typs := make([]string, len(cols))
+	seen := make([]bool, len(cols))
+	exportRecords(db, state, sc.Table, func(rec core.Record) {
+		for i, c := range cols {
+			if raw := rec.GetRaw(c); raw != "" {
+				typ := csvType(core.Unpack(raw))
+				if !seen[i] {
+					typs[i], seen[i] = typ, true
+				} else if typ != typs[i] {
+					typs[i] = "value"
+				}
+			}
+		}
+	})
+	return typs
+}
+
+func validCsvType(typ string) bool {
+	for _, t := range csvTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return typ == "value"
+}
+
+func csvType(x core.Value) string {
+	if x.Type() == types.String {
+		return ""
+	}
+	if typ, ok := csvTypes[x.Type()]; ok {
+		return typ
+	}
+	return "value"
+}
+
+func csvCell(x core.Value, typ string) string {
+	switch typ {
+	case "":
+		return core.ToStr(x)
+	case "date":
+		return core.IsoDate(x.(core.SuDate))
+	case "value":
+		return core.Display(nil, x)
+	}
+	return core.JsonEncode(x)
+}
+
+func exportJsonl(db *Database, state *DbState, sc *meta.Schema,
+	w *bufio.Writer) int {
+	cols := exportColumns(sc)
+	return exportRecords(db, state, sc.Table, func(rec core.Record) {
+		ob := &core.SuObject{}
+		for _, c := range cols {
+			if raw := rec.GetRaw(c); raw != "" {
+				x := core.Unpack(raw)
+				col := sc.Columns[c]
+				switch x.Type() {
+				case types.Date:
+					col += ":date"
+					x = core.SuStr(core.IsoDate(x.(core.SuDate)))
+				case types.Record:
+					col += ":record"
+				}
+				ob.Set(core.SuStr(col), x)
+			}
+		}
+		if ob.Size() == 0 {
+			w.WriteString("{}")
+		} else {
+			w.WriteString(core.JsonEncode(ob))
+		}
+		w.WriteByte('\n')
+	})
+}
+
+func exportRecords(db *Database, state *DbState, table string,
+	fn func(rec core.Record)) int {
+	info := state.Meta.GetRoInfo(table)
+	return info.Indexes[0].Check(func(off uint64) {
+		fn(OffToRecCk(db.Store, off))
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package tools
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/core"
+	. "github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	db, err := CreateDb(stor.HeapStor(8192))
+	ck(err)
+	StartConcur(db, time.Minute)
+	defer db.Close()
+	MakeSuTran = func(ut *UpdateTran) *core.SuTran {
+		return core.NewSuTran(nil, true)
+	}
+	query.DoAdmin(db, "create tmp (k, s, n, d, b, ob, m, r) key(k)", nil)
+	query.DoAdmin(db, "create tmp2 (k, s, n, d, b, ob, m, r) key(k)", nil)
+	ut := db.NewUpdateTran()
+	query.DoAction(nil, ut, `insert { k: 1, s: "hello, world", n: .5,
+		d: #20230102.030405006, b: true, ob: #(a: #(1, "two", #(b: 3))) } into tmp`)
+	query.DoAction(nil, ut, `insert { k: 2, s: "007", n: -12.5e-10,
+		b: false, ob: #() } into tmp`)
+	query.DoAction(nil, ut, `insert { k: 3, s: "say \"hi\"\nbye" } into tmp`)
+	// strings that look like other types, mixed types, and a record
+	query.DoAction(nil, ut, `insert { k: 4, s: "123", m: 1 } into tmp`)
+	query.DoAction(nil, ut, `insert { k: 5, s: "true", m: "x" } into tmp`)
+	query.DoAction(nil, ut, `insert { k: 6, s: "2023-01-02T03:04:05.006",
+		m: #20240102, r: [a: 1] } into tmp`)
+	query.DoAction(nil, ut, `insert { k: 7, s: "[1]" } into tmp`)
+	ut.Commit()
+	db.Persist()
+
+	rows := func(table string) string {
+		var sb strings.Builder
+		rt := db.NewReadTran()
+		rt.GetInfo(table).Indexes[0].Check(func(off uint64) {
+			rec := rt.GetRecord(off)
+			for i := 0; i < 8; i++ {
+				if i == 7 && rec.GetRaw(i) != "" {
+					sb.WriteString(core.Unpack(rec.GetRaw(i)).Type().String())
+				}
+				sb.WriteString(core.Unpack(rec.GetRaw(i)).String())
+				sb.WriteString(" ")
+			}
+			sb.WriteString("\n")
+		})
+		return sb.String()
+	}
+	expected := rows("tmp")
+	for _, format := range []string{"csv", "jsonl"} {
+		file := "tmp." + format
+		defer os.Remove(file)
+		n, err := ExportDbTable(db, "tmp", format, "")
+		ck(err)
+		assert.T(t).This(n).Is(7)
+		query.DoAdmin(db, "drop tmp2", nil)
+		query.DoAdmin(db, "create tmp2 (k, s, n, d, b, ob, m, r) key(k)", nil)
+		n, err = ImportDbTable(db, "tmp2", format, file)
+		ck(err)
+		assert.T(t).This(n).Is(7)
+		db.Persist()
+		assert.T(t).Msg(format).This(rows("tmp2")).Is(expected)
+
+		// duplicate keys are an error
+		_, err = ImportDbTable(db, "tmp2", format, file)
+		assert.T(t).That(strings.Contains(err.Error(), "duplicate key"))
+	}
+	data, _ := os.ReadFile("tmp.csv")
+	assert.T(t).This(string(data)).Like(
+		`k:number,s,n:number,d:date,b:boolean,ob:object,m:value,r:record
+		1,"hello, world",0.5,2023-01-02T03:04:05.006,true,"{""a"":[1,""two"",{""b"":3}]}",,
+		2,007,-1.25e-9,,false,[],,
+		3,"say ""hi""
+		bye",,,,,,
+		4,123,,,,,1,
+		5,true,,,,,'x',
+		6,2023-01-02T03:04:05.006,,,,,#20240102,"{""a"":1}"
+		7,[1],,,,,,`)
+	data, _ = os.ReadFile("tmp.jsonl")
+	assert.T(t).That(strings.Contains(string(data),
+		`"d:date":"2023-01-02T03:04:05.006"`))
+	assert.T(t).That(strings.Contains(string(data),
+		`"s":"2023-01-02T03:04:05.006"`))
+
+	_, err = ExportDbTable(db, "tmp", "xml", "")
+	assert.T(t).That(strings.Contains(err.Error(), "csv or jsonl"))
+	os.WriteFile("tmp2.csv", []byte("k,nonexistent\n4,x\n"), 0666)
+	defer os.Remove("tmp2.csv")
+	_, err = ImportDbTable(db, "tmp2", "csv", "")
+	assert.T(t).That(strings.Contains(err.Error(), "column not in table"))
+	os.WriteFile("tmp2.csv", []byte("k:number,d:date\n4,yesterday\n"), 0666)
+	_, err = ImportDbTable(db, "tmp2", "csv", "")
+	assert.T(t).That(strings.Contains(err.Error(), "invalid date"))
+	os.WriteFile("tmp2.csv", []byte("k:number,s:text\n4,x\n"), 0666)
+	_, err = ImportDbTable(db, "tmp2", "csv", "")
+	assert.T(t).That(strings.Contains(err.Error(), "invalid column type"))
+}
@@ -0,0 +1,247 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package tools
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/compile"
+	"github.com/apmckinlay/gsuneido/core"
+	. "github.com/apmckinlay/gsuneido/db19"
+)
+
+// importBatch is the number of records output per transaction
+const importBatch = 1000
+
+// ImportTable is used by -import
+func ImportTable(dbfile, table, format, from string) (int, error) {
+	db, err := OpenDatabase(dbfile)
+	if err != nil {
+		return 0, fmt.Errorf("import failed: %w", err)
+	}
+	StartConcur(db, time.Minute)
+	defer db.Close()
+	return ImportDbTable(db, table, format, from)
+}
+
+// ImportDbTable adds the records from a CSV or JSON Lines file
+// to an existing table. It is used by Database.Import
+// Records are output in transactions of importBatch,
+// so if there is an error, the records before it will have been imported.
+// Triggers are not run for the import's transactions
+// (other transactions are not affected).
+// See export.go for the formats.
+// It returns the number of records imported.
+func ImportDbTable(db *Database, table, format, from string) (
+	nrecs int, err error) {
+	line := 0
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("import failed: line %d: %v (%d records imported)",
+				line, e, nrecs)
+		}
+	}()
+	if from == "" {
+		from = ExportFormat(table, format)
+	}
+	ts := db.GetState().Meta.GetRoSchema(table)
+	if ts == nil {
+		panic("can't find " + table)
+	}
+	f, err := os.Open(from)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var next func() (rec core.Record)
+	switch format {
+	case "csv":
+		next = importCsv(ts.Columns, f, &line)
+	case "jsonl":
+		next = importJsonl(ts.Columns, f, &line)
+	default:
+		ExportFormat(table, format) // panics
+	}
+	for {
+		ut := db.NewUpdateTran()
+		ut.DisableTriggers()
+		n := 0
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					ut.Abort()
+					panic(e)
+				}
+			}()
+			for ; n < importBatch; n++ {
+				rec := next()
+				if rec == "" {
+					break
+				}
+				ut.Output(nil, table, rec)
+			}
+			ut.Commit()
+		}()
+		nrecs += n
+		if n < importBatch {
+			return nrecs, nil
+		}
+	}
+}
+
+// importCsv returns a function that returns the next record, or ""
+func importCsv(columns []string, f io.Reader, line *int) func() core.Record {
+	r := csv.NewReader(bufio.NewReader(f))
+	r.ReuseRecord = true
+	hdr, err := r.Read()
+	if err == io.EOF {
+		return func() core.Record { return "" }
+	}
+	ck(err)
+	*line = 1
+	typs := make([]string, len(hdr))
+	for i, h := range hdr {
+		hdr[i], typs[i], _ = strings.Cut(h, ":")
+		if typs[i] != "" && !validCsvType(typs[i]) {
+			panic("invalid column type: " + h)
+		}
+	}
+	fields := importFields(columns, hdr)
+	return func() core.Record {
+		row, err := r.Read()
+		if err == io.EOF {
+			return ""
+		}
+		ck(err)
+		*line++
+		var rb core.RecordBuilder
+		vals := make([]core.Value, len(columns))
+		for i, cell := range row {
+			vals[fields[i]] = csvValue(cell, typs[i])
+		}
+		return importRecord(&rb, vals)
+	}
+}
+
+// importFields maps the import columns to the table columns
+func importFields(columns, hdr []string) []int {
+	fields := make([]int, len(hdr))
+	for i, col := range hdr {
+		fields[i] = slices.Index(columns, col)
+		if fields[i] == -1 || col == "-" {
+			panic("column not in table: " + col)
+		}
+	}
+	return fields
+}
+
+// csvValue converts a cell to a value according to the column type
+func csvValue(s, typ string) core.Value {
+	if s == "" {
+		return nil
+	}
+	switch typ {
+	case "":
+		return core.SuStr(s)
+	case "number":
+		return core.NumFromString(s)
+	case "boolean":
+		switch s {
+		case "true":
+			return core.True
+		case "false":
+			return core.False
+		}
+		panic("invalid boolean: " + s)
+	case "date":
+		return importDate(s)
+	case "object":
+		return core.JsonDecode(s)
+	case "record":
+		return importRecordValue(core.JsonDecode(s))
+	}
+	return compile.Constant(s) // value
+}
+
+func importDate(s string) core.Value {
+	if d := core.ParseIsoDate(s); d != core.NilDate {
+		return d
+	}
+	panic("invalid date: " + s)
+}
+
+func importRecordValue(x core.Value) core.Value {
+	ob, ok := x.ToContainer()
+	if !ok {
+		panic("invalid record: " + x.String())
+	}
+	return core.SuRecordFromObject(ob.ToObject())
+}
+
+// importJsonl returns a function that returns the next record, or ""
+func importJsonl(columns []string, f io.Reader, line *int) func() core.Record {
+	r := bufio.NewReader(f)
+	return func() core.Record {
+		var s string
+		for s == "" {
+			var err error
+			s, err = r.ReadString('\n')
+			if err == io.EOF && s == "" {
+				return ""
+			}
+			if err != io.EOF {
+				ck(err)
+			}
+			*line++
+			s = trimLine(s)
+		}
+		ob, ok := core.JsonDecode(s).ToContainer()
+		if !ok || ob.ListSize() > 0 {
+			panic("expected a JSON object")
+		}
+		vals := make([]core.Value, len(columns))
+		iter := ob.ToObject().Iter2(false, true)
+		for k, v := iter(); k != nil; k, v = iter() {
+			col, typ, _ := strings.Cut(core.ToStr(k), ":")
+			i := importFields(columns, []string{col})[0]
+			switch typ {
+			case "":
+			case "date":
+				v = importDate(core.ToStr(v))
+			case "record":
+				v = importRecordValue(v)
+			default:
+				panic("invalid column type: " + core.ToStr(k))
+			}
+			vals[i] = v
+		}
+		var rb core.RecordBuilder
+		return importRecord(&rb, vals)
+	}
+}
+
+func trimLine(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func importRecord(rb *core.RecordBuilder, vals []core.Value) core.Record {
+	for _, v := range vals {
+		if v == nil {
+			rb.AddRaw("")
+		} else {
+			rb.Add(v.(core.Packable))
+		}
+	}
+	return rb.Trim().Build() // never "" so it can't be mistaken for the end
+}
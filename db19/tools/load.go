@@ -13,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/apmckinlay/gsuneido/core"
@@ -26,6 +27,7 @@ import (
 	"github.com/apmckinlay/gsuneido/util/assert"
 	"github.com/apmckinlay/gsuneido/util/cksum"
 	"github.com/apmckinlay/gsuneido/util/errs"
+	"github.com/apmckinlay/gsuneido/util/exit"
 	"github.com/apmckinlay/gsuneido/util/sortlist"
 	"github.com/apmckinlay/gsuneido/util/str"
 	"github.com/apmckinlay/gsuneido/util/system"
@@ -39,12 +41,30 @@ type loadJob struct {
 	schema string
 	nrecs  int
 	size   uint64
+	// verify is set for tables loaded by a previous, interrupted load
+	verify bool
+	// section is set if the worker should read the table's data itself
+	section *dumpSection
 }
 
+// loadCheckpointInterval is the minimum time between load checkpoints
+const loadCheckpointInterval = 5 * time.Second
+
+// loadProgressInterval is how often load reports progress
+const loadProgressInterval = 10 * time.Second
+
 // LoadDatabase imports a dumped database from a file using a worker pool.
-// It returns the number of tables loaded. Errors are fatal.
+// If the dump is not encrypted, it is scanned first to find the tables
+// and then the tables are read and indexed in parallel by options.Nworkers.
+// An encrypted dump can only be read sequentially,
+// so only the tables' indexes are built in parallel.
+// It returns the number of tables loaded.
 // It does NOT check foreign key data
 // because it assumes the dump was from a valid database.
+//
+// It loads into dbfile + ".load" which is checkpointed as tables complete.
+// If a load is interrupted, running it again resumes from the last checkpoint,
+// skipping (but verifying) the tables that were already loaded.
 func LoadDatabase(from, dbfile, privateKey, passphrase string) (
 	nTables, nViews int, err error) {
 	var errVal atomic.Value // error
@@ -53,14 +73,30 @@ func LoadDatabase(from, dbfile, privateKey, passphrase string) (
 			err = errs.From(e)
 		}
 	}()
-	f, r := loadOpen(from, privateKey, passphrase)
+	f, err := os.Open(from)
+	ck(err)
 	defer f.Close()
-	db, tmpfile := tmpdb()
-	defer func() { db.Close(); os.Remove(tmpfile) }()
+	fi, err := f.Stat()
+	ck(err)
+	lp := &loadProgress{start: time.Now(), total: fi.Size()}
+	var sections []dumpSection
+	var r *bufio.Reader
+	if privateKey == "" {
+		sections = scanDump(f)
+	} else {
+		r = loadReader(&countReader{r: f, n: &lp.read}, privateKey, passphrase)
+	}
+	loadfile := dbfile + ".load"
+	db, resume := loadDb(loadfile)
+	defer db.Close()
+	stop := lp.run()
+	defer stop()
 
-	// start the workers that build the indexes
+	// start the workers that read the tables and build the indexes
 	var wg sync.WaitGroup
-	channel := make(chan *loadJob)
+	var ckptLock sync.Mutex
+	lastCkpt := time.Now()
+	channel := make(chan *loadJob, options.Nworkers)
 	for i := 0; i < options.Nworkers; i++ {
 		wg.Add(1)
 		go func() {
@@ -73,19 +109,62 @@ func LoadDatabase(from, dbfile, privateKey, passphrase string) (
 				}
 			}()
 			for job = range channel {
-				loadTable2(job.db, job.schema, job.nrecs, job.size, job.list, false)
+				if job.verify {
+					table := str.BeforeFirst(job.schema, " ")
+					if err := job.db.CheckTable(table); err != nil {
+						panic(fmt.Sprint("previously loaded table failed check, ",
+							"remove ", loadfile, " to start over: ", err))
+					}
+				} else {
+					if job.section != nil {
+						job.nrecs, job.size, job.list = loadTable1(job.db,
+							job.section.reader(f, &lp.read), job.schema)
+						lp.rows.Add(int64(job.nrecs))
+					}
+					loadTable2(job.db, job.schema, job.nrecs, job.size,
+						job.list, false)
+					ckptLock.Lock()
+					if time.Since(lastCkpt) >= loadCheckpointInterval {
+						job.db.Checkpoint()
+						lastCkpt = time.Now()
+					}
+					ckptLock.Unlock()
+				}
+				lp.tables.Add(1)
 			}
 		}()
 	}
 
 	// load the tables
 	nTables = 0
-	for ; errVal.Load() == nil; nTables++ {
+	if r == nil {
+		for i := 0; i < len(sections) && errVal.Load() == nil; i++ {
+			sec := &sections[i]
+			if strings.HasPrefix(sec.schema, "views ") {
+				nViews, _, _ = loadTable1(db, sec.reader(f, &lp.read), sec.schema)
+				continue
+			}
+			nTables++
+			if resume && loadSkip(db, sec.schema,
+				func() (int, uint64) { return sec.nrecs, sec.size }) {
+				channel <- &loadJob{db: db, schema: sec.schema, verify: true}
+			} else {
+				channel <- &loadJob{db: db, schema: sec.schema, section: sec}
+			}
+		}
+	}
+	for ; r != nil && errVal.Load() == nil; nTables++ {
 		schema := readLinePrefixed(r, "====== ")
 		if schema == "" {
 			break
 		}
+		if resume && !strings.HasPrefix(schema, "views ") &&
+			loadSkip(db, schema, func() (int, uint64) { return skipRecords(r) }) {
+			channel <- &loadJob{db: db, schema: schema, verify: true}
+			continue
+		}
 		nrecs, size, list := loadTable1(db, r, schema)
+		lp.rows.Add(int64(nrecs))
 		if strings.HasPrefix(schema, "views ") {
 			nViews = nrecs
 			nTables--
@@ -97,16 +176,190 @@ func LoadDatabase(from, dbfile, privateKey, passphrase string) (
 	close(channel)
 	wg.Wait()
 	if errVal.Load() != nil {
-		return 0, 0, errVal.Load().(error)
+		err := errVal.Load().(error)
+		return 0, 0, fmt.Errorf("%w (load again to resume)", err)
 	}
 	trace("SIZE", db.Store.Size())
 	db.CheckAllFkeys()
 	db.GetState().Write()
 	db.Close()
-	ck(system.RenameBak(tmpfile, dbfile))
+	ck(system.RenameBak(loadfile, dbfile))
 	return nTables, nViews, nil
 }
 
+// dumpSection is the location of a table's data in an unencrypted dump file
+type dumpSection struct {
+	schema string
+	off    int64 // the start of the records
+	end    int64 // after the records
+	nrecs  int
+	size   uint64
+}
+
+// reader returns a reader for the section's records.
+// It uses ReadAt so multiple sections can be read concurrently.
+func (sec *dumpSection) reader(f *os.File, read *atomic.Int64) *bufio.Reader {
+	return bufio.NewReader(&countReader{
+		r: io.NewSectionReader(f, sec.off, sec.end-sec.off), n: read})
+}
+
+// scanDump returns the sections for the tables in an unencrypted dump file.
+// It seeks past large records so it does not have to read all the data.
+func scanDump(f *os.File) []dumpSection {
+	ds := &dumpScanner{f: f}
+	ds.seek(0)
+	version, err := ds.r.ReadString('\n')
+	ck(err)
+	checkDumpVersion(version)
+	ds.pos += int64(len(version))
+	var sections []dumpSection
+	intbuf := make([]byte, 4)
+	for {
+		line, err := ds.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return sections
+		}
+		ck(err)
+		ds.pos += int64(len(line))
+		if !strings.HasPrefix(line, "====== ") {
+			panic("not a valid dump file")
+		}
+		sec := dumpSection{schema: line[len("====== "):], off: ds.pos}
+		for { // each record
+			_, err := io.ReadFull(ds.r, intbuf)
+			if err == io.EOF {
+				break
+			}
+			ck(err)
+			ds.pos += 4
+			n := int(binary.BigEndian.Uint32(intbuf))
+			if n == 0 {
+				break
+			}
+			ds.skip(n)
+			sec.nrecs++
+			sec.size += uint64(n)
+		}
+		sec.end = ds.pos
+		sections = append(sections, sec)
+	}
+}
+
+// dumpScanner tracks the file position of a buffered reader
+// so it can seek
+type dumpScanner struct {
+	f   *os.File
+	r   *bufio.Reader
+	pos int64
+}
+
+func (ds *dumpScanner) seek(pos int64) {
+	ds.pos = pos
+	sr := io.NewSectionReader(ds.f, pos, 1<<62)
+	if ds.r == nil {
+		ds.r = bufio.NewReader(sr)
+	} else {
+		ds.r.Reset(sr)
+	}
+}
+
+func (ds *dumpScanner) skip(n int) {
+	if n <= ds.r.Buffered() {
+		ds.r.Discard(n)
+		ds.pos += int64(n)
+	} else {
+		ds.seek(ds.pos + int64(n))
+	}
+}
+
+// loadDb opens the database file for a previous, interrupted load
+// or else creates a new one.
+func loadDb(loadfile string) (db *Database, resume bool) {
+	if _, err := os.Stat(loadfile); err == nil {
+		db, err = OpenDbTrimmed(loadfile)
+		if err != nil {
+			panic(fmt.Sprint("can't resume load, remove ", loadfile,
+				" to start over: ", err))
+		}
+		log.Println("load: resuming from", loadfile)
+		return db, true
+	}
+	db, err := CreateDatabase(loadfile)
+	ck(err)
+	return db, false
+}
+
+// loadSkip returns whether a table was already loaded by a previous load.
+// counts is only called if it was,
+// it returns the number of records and size of the table in the dump.
+// It panics if the table was loaded but does not match the dump.
+func loadSkip(db *Database, schema string, counts func() (int, uint64)) bool {
+	table := str.BeforeFirst(schema, " ")
+	info := db.GetState().Meta.GetRoInfo(table)
+	if info == nil {
+		return false
+	}
+	if nrecs, size := counts(); nrecs != info.Nrows || size != info.Size {
+		panic("previously loaded " + table + " does not match the dump")
+	}
+	return true
+}
+
+// loadProgress tracks and reports the progress of LoadDatabase
+type loadProgress struct {
+	start  time.Time
+	total  int64 // size of the dump file
+	read   atomic.Int64
+	rows   atomic.Int64
+	tables atomic.Int32
+}
+
+// run reports progress periodically until the returned stop function is called
+func (lp *loadProgress) run() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(loadProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s := lp.String()
+				exit.Progress(s)
+				log.Println(s)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (lp *loadProgress) String() string {
+	elapsed := time.Since(lp.start)
+	read := lp.read.Load()
+	s := fmt.Sprintf("load: %d tables done, %d rows/sec",
+		lp.tables.Load(), int64(float64(lp.rows.Load())/elapsed.Seconds()))
+	if read > 0 && lp.total > 0 {
+		eta := time.Duration(float64(elapsed) *
+			float64(lp.total-read) / float64(read))
+		s += fmt.Sprintf(", %d%% read, ETA %v",
+			read*100/lp.total, eta.Round(time.Second))
+	}
+	return s
+}
+
+// countReader counts the bytes read, for progress
+type countReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
 // LoadTable is used by -load <table>.
 func LoadTable(table, dbfile string) (int, error) {
 	var db *Database
@@ -150,6 +403,10 @@ func LoadDbTable(table, from, privateKey, passphrase string,
 func loadOpen(filename, privateKey, passphrase string) (*os.File, *bufio.Reader) {
 	f, err := os.Open(filename)
 	ck(err)
+	return f, loadReader(f, privateKey, passphrase)
+}
+
+func loadReader(f io.Reader, privateKey, passphrase string) *bufio.Reader {
 	var r *bufio.Reader
 	if privateKey == "" {
 		r = bufio.NewReader(f)
@@ -158,13 +415,17 @@ func loadOpen(filename, privateKey, passphrase string) (*os.File, *bufio.Reader)
 	}
 	s, err := r.ReadString('\n')
 	ck(err)
+	checkDumpVersion(s)
+	return r
+}
+
+func checkDumpVersion(s string) {
 	if !strings.HasPrefix(s, dumpVersionBase) {
 		panic("not a valid dump file")
 	}
 	if s != dumpVersion && s != dumpVersionPrev {
 		panic("invalid dump version")
 	}
-	return f, r
 }
 
 func decryptor(privateKey, passphrase string, src io.Reader) io.Reader {
@@ -249,6 +510,27 @@ func readRecords(in *bufio.Reader, store *stor.Stor, list *slBuilder) (
 	return nrecs, size
 }
 
+// skipRecords reads the records for a table without storing them
+func skipRecords(in *bufio.Reader) (nrecs int, size uint64) {
+	intbuf := make([]byte, 4)
+	for { // each record
+		_, err := io.ReadFull(in, intbuf)
+		if err == io.EOF {
+			break
+		}
+		ck(err)
+		n := int(binary.BigEndian.Uint32(intbuf))
+		if n == 0 {
+			break
+		}
+		_, err = in.Discard(n)
+		ck(err)
+		nrecs++
+		size += uint64(n)
+	}
+	return nrecs, size
+}
+
 func buildIndexes(ts *meta.Schema, list *slBuilder, store *stor.Stor,
 	nrecs int) []*index.Overlay {
 	i := -1
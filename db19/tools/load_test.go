@@ -6,10 +6,12 @@ package tools
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/apmckinlay/gsuneido/core"
 	. "github.com/apmckinlay/gsuneido/db19"
 	"github.com/apmckinlay/gsuneido/db19/stor"
 	"github.com/apmckinlay/gsuneido/dbms/query"
@@ -79,3 +81,103 @@ func TestLoadFkey(*testing.T) {
 	_, err = LoadDbTable("tmp3", "tmp3.su", "", "", db)
 	ck(err)
 }
+
+func TestLoadResume(t *testing.T) {
+	db, err := CreateDb(stor.HeapStor(8192))
+	ck(err)
+	db.CheckerSync()
+	MakeSuTran = func(ut *UpdateTran) *core.SuTran {
+		return core.NewSuTran(nil, true)
+	}
+	create := func(table string, n int) {
+		query.DoAdmin(db, "create "+table+" (a, b) key(a) index(b)", nil)
+		ut := db.NewUpdateTran()
+		for i := 0; i < n; i++ {
+			query.DoAction(nil, ut, fmt.Sprint("insert { a: ", i,
+				", b: ", n-i, " } into ", table))
+		}
+		db.CommitMerge(ut)
+		db.PersistSync()
+	}
+	create("tmp1", 10)
+	create("tmp2", 20)
+	_, _, err = Dump(db, "tmp12.su", "")
+	ck(err)
+	defer os.Remove("tmp12.su")
+	create("tmp3", 30)
+	_, _, err = Dump(db, "tmp123.su", "")
+	ck(err)
+	defer os.Remove("tmp123.su")
+	defer os.Remove("tmp123.su.bak")
+	defer os.Remove("tmp.db")
+	defer os.Remove("tmp.db.bak")
+	defer os.Remove("tmp.db.load")
+
+	// simulate an interrupted load
+	_, _, err = LoadDatabase("tmp12.su", "tmp.db", "", "")
+	ck(err)
+	ck(os.Rename("tmp.db", "tmp.db.load"))
+	nTables, _, err := LoadDatabase("tmp123.su", "tmp.db", "", "")
+	ck(err)
+	assert.This(nTables).Is(3)
+	ck(CheckDatabase("tmp.db"))
+	ldb, err := OpenDb("tmp.db", stor.Read, false)
+	ck(err)
+	assert.This(ldb.GetState().Meta.GetRoInfo("tmp3").Nrows).Is(30)
+	ldb.Close()
+	_, err = os.Stat("tmp.db.load")
+	assert.That(os.IsNotExist(err))
+
+	// a partial load that doesn't match the dump
+	ck(os.Rename("tmp.db", "tmp.db.load"))
+	ut := db.NewUpdateTran()
+	query.DoAction(nil, ut, "insert { a: 99 } into tmp2")
+	db.CommitMerge(ut)
+	db.PersistSync()
+	_, _, err = Dump(db, "tmp123.su", "")
+	ck(err)
+	_, _, err = LoadDatabase("tmp123.su", "tmp.db", "", "")
+	assert.That(strings.Contains(err.Error(), "does not match"))
+}
+
+func TestScanDump(t *testing.T) {
+	db, err := CreateDb(stor.HeapStor(64 * 1024))
+	ck(err)
+	db.CheckerSync()
+	MakeSuTran = func(ut *UpdateTran) *core.SuTran {
+		return core.NewSuTran(nil, true)
+	}
+	query.DoAdmin(db, "create tmp (a, b) key(a)", nil)
+	ut := db.NewUpdateTran()
+	for i := 0; i < 20; i++ {
+		// some records larger than the scanner buffer
+		b := strings.Repeat("x", i*i*50)
+		query.DoAction(nil, ut, fmt.Sprint("insert { a: ", i,
+			", b: '", b, "' } into tmp"))
+	}
+	db.CommitMerge(ut)
+	db.PersistSync()
+	_, _, err = Dump(db, "tmp.su", "")
+	ck(err)
+	defer os.Remove("tmp.su")
+	f, err := os.Open("tmp.su")
+	ck(err)
+	defer f.Close()
+	sections := scanDump(f)
+	info := db.GetState().Meta.GetRoInfo("tmp")
+	i := slices.IndexFunc(sections, func(sec dumpSection) bool {
+		return strings.HasPrefix(sec.schema, "tmp ")
+	})
+	assert.T(t).That(i != -1)
+	assert.T(t).This(sections[i].nrecs).Is(20)
+	assert.T(t).This(sections[i].size).Is(info.Size)
+	fi, _ := f.Stat()
+	assert.T(t).This(sections[len(sections)-1].end).Is(fi.Size())
+
+	defer os.Remove("tmp.db")
+	defer os.Remove("tmp.db.bak")
+	nTables, _, err := LoadDatabase("tmp.su", "tmp.db", "", "")
+	ck(err)
+	assert.T(t).This(nTables).Is(len(sections) - 1) // views
+	ck(CheckDatabase("tmp.db"))
+}
@@ -202,6 +202,14 @@ func (t *ReadTran) Asof(asof int64) int64 {
 	return t.asof
 }
 
+// AsofTran returns a new read transaction as of the given time.
+// It is used by queries with table asof.
+func (t *ReadTran) AsofTran(asof int64) *ReadTran {
+	rt := t.db.NewReadTran()
+	rt.Asof(asof)
+	return rt
+}
+
 func (t *ReadTran) MakeLess(is *ixkey.Spec) func(x, y uint64) bool {
 	return MakeLess(t.db.Store, is)
 }
@@ -220,10 +228,17 @@ type UpdateTran struct {
 	ct *CkTran
 	ReadTran
 	writeCount int
+	// changes are added to the database changes feed by commit
+	changes []Change
+	// noTriggers is set by DisableTriggers
+	noTriggers bool
 }
 
 func (db *Database) NewUpdateTran() *UpdateTran {
 	db.ckOpen()
+	if db.standby {
+		panic("can't update a standby database")
+	}
 	ct := db.ck.StartTran()
 	if ct == nil {
 		return nil
@@ -237,6 +252,12 @@ func (t *UpdateTran) String() string {
 	return t.ct.String()
 }
 
+// DisableTriggers stops triggers from being called for this transaction.
+// Unlike Database.DisableTrigger it does not affect other transactions.
+func (t *UpdateTran) DisableTriggers() {
+	t.noTriggers = true
+}
+
 func (t *UpdateTran) Num() int {
 	return t.ct.start
 }
@@ -269,6 +290,7 @@ func (t *UpdateTran) commit() int {
 	t.db.UpdateState(func(state *DbState) {
 		state.Meta = t.meta.LayeredOnto(state.Meta)
 	})
+	t.db.changes.add(t.changes)
 	return t.num()
 }
 
@@ -345,9 +367,16 @@ func (t *UpdateTran) Output(th *core.Thread, table string, rec core.Record) {
 	}()
 	ti.Nrows++
 	ti.Size += uint64(n)
+	t.change(ts, "", rec[:n])
 	t.db.CallTrigger(th, t, table, "", rec)
 }
 
+// change records an output, update, or delete for the changes feed
+func (t *UpdateTran) change(ts *meta.Schema, oldrec, newrec core.Record) {
+	t.changes = append(t.changes,
+		Change{Table: ts.Table, Columns: ts.Columns, Old: oldrec, New: newrec})
+}
+
 func (t *UpdateTran) dupOutputBlock(table string, iIndex int, ix schema.Index,
 	ov *index.Overlay, rec core.Record, key string) {
 	if needsDupCheck(ix, rec) {
@@ -432,6 +461,7 @@ func (t *UpdateTran) Delete(th *core.Thread, table string, off uint64) {
 		assert.Msg("Delete Size").That(ti.Size >= uint64(n))
 		ti.Size -= uint64(n)
 	}()
+	t.change(ts, rec[:n], "")
 	t.db.CallTrigger(th, t, table, rec, "")
 }
 
@@ -588,6 +618,7 @@ func (t *UpdateTran) update(th *core.Thread, table string, oldoff uint64, newrec
 			}
 		}
 	}()
+	t.change(ts, oldrec, newrec)
 	t.db.CallTrigger(th, t, table, oldrec, newrec)
 	return newoff
 }
@@ -42,6 +42,9 @@ func (t *triggers) enabled(table string) bool {
 
 func (t *triggers) CallTrigger(th *Thread, tran *UpdateTran, table string,
 	oldrec, newrec Record) {
+	if tran.noTriggers {
+		return
+	}
 	sutran := MakeSuTran(tran)
 	hdr := SimpleHeader(tran.GetSchema(table).Columns)
 	t.call2(th, sutran, table,
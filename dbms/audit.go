@@ -0,0 +1,201 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+)
+
+// The audit log records logins, schema changes, and privileged commands
+// from client connections. It is stored in the audit table:
+//
+//	audit (timestamp, session, address, user, command, args, outcome)
+//		key(timestamp)
+//
+// args is e.g. the admin request or the user for Auth (never the password).
+// For Exec only the name of what is executed is recorded, not its arguments,
+// since they may contain passwords or other secrets.
+// args is truncated to auditArgsMax.
+// outcome is "ok", "failed" (for Auth), or the error.
+// Permission denials for any command are also recorded.
+//
+// Records are buffered and written in batches by a background goroutine
+// so audited requests do not wait for an update transaction.
+// Nothing is recorded on a standby since it is read-only.
+//
+// If the audit table does not exist, nothing is recorded.
+// The table can have other columns, they will be left empty.
+
+const auditArgsMax = 1000
+
+// auditMax is the maximum number of buffered records,
+// beyond this records are dropped (and logged)
+const auditMax = 10000
+
+// auditCmds are the commands that are always recorded
+var auditCmds = map[commands.Command]bool{
+	commands.Admin:       true,
+	commands.Auth:        true,
+	commands.Backup:      true,
+	commands.Check:       true,
+	commands.Drain:       true,
+	commands.Exec:        true,
+	commands.Kill:        true,
+	commands.Maintenance: true,
+	commands.Run:         true,
+}
+
+// audit is deferred by command.
+// It recovers to get the outcome and then re-panics.
+func (ss *serverSession) audit(icmd commands.Command) {
+	e := recover()
+	outcome := ss.auditOutcome
+	if e != nil {
+		outcome = errToStr(e)
+	} else if outcome == "" {
+		outcome = "ok"
+	}
+	if auditCmds[icmd] || strings.HasPrefix(outcome, "permission denied") {
+		ss.sc.local().audit(map[string]string{
+			"session": ss.sessionId.Load(),
+			"address": ss.sc.remoteAddr,
+			"user":    ss.sc.user,
+			"command": icmd.String(),
+			"args":    auditTrunc(ss.auditArgs),
+			"outcome": outcome,
+		})
+	}
+	if e != nil {
+		panic(e)
+	}
+}
+
+// local returns the underlying DbmsLocal, even if not authorized
+func (sc *serverConn) local() *DbmsLocal {
+	switch dbms := sc.dbms.(type) {
+	case *DbmsLocal:
+		return dbms
+	case *DbmsUnauth:
+		return dbms.dbms
+	}
+	panic("serverConn: unexpected dbms type")
+}
+
+func auditTrunc(s string) string {
+	if len(s) > auditArgsMax {
+		return s[:auditArgsMax] + "..."
+	}
+	return s
+}
+
+// auditExec returns the audit args for Exec, without the arguments
+func auditExec(ob Value) string {
+	if c, ok := ob.ToContainer(); ok && c.ListSize() > 0 {
+		return AsStr(c.ListGet(0))
+	}
+	return ""
+}
+
+type auditBuffer struct {
+	lock    sync.Mutex
+	pending []auditRec
+	writing bool
+	dropped int
+	wg      sync.WaitGroup
+}
+
+type auditRec struct {
+	timestamp SuDate
+	fields    map[string]string
+}
+
+// audit buffers a record for the audit table, if it exists.
+// Errors are logged, they do not affect the audited command.
+func (dbms *DbmsLocal) audit(fields map[string]string) {
+	if dbms.db.Standby() ||
+		dbms.db.GetState().Meta.GetRoSchema("audit") == nil {
+		return
+	}
+	ab := &dbms.audits
+	ab.lock.Lock()
+	defer ab.lock.Unlock()
+	if len(ab.pending) >= auditMax {
+		if ab.dropped == 0 {
+			log.Println("ERROR: audit: too many pending records, dropping")
+		}
+		ab.dropped++
+		return
+	}
+	// timestamp is assigned now to keep the order of events
+	ab.pending = append(ab.pending,
+		auditRec{timestamp: dbms.Timestamp(), fields: fields})
+	if !ab.writing {
+		ab.writing = true
+		ab.wg.Add(1)
+		go dbms.auditWriter()
+	}
+}
+
+// auditWriter writes the pending records in batches until there are none
+func (dbms *DbmsLocal) auditWriter() {
+	ab := &dbms.audits
+	defer ab.wg.Done()
+	for {
+		ab.lock.Lock()
+		batch := ab.pending
+		ab.pending = nil
+		if len(batch) == 0 {
+			ab.writing = false
+			ab.dropped = 0
+			ab.lock.Unlock()
+			return
+		}
+		ab.lock.Unlock()
+		dbms.auditWrite(batch)
+	}
+}
+
+// auditWait waits for buffered audit records to be written
+func (dbms *DbmsLocal) auditWait() {
+	dbms.audits.wg.Wait()
+}
+
+// auditWrite outputs a batch of records to the audit table
+// in a single update transaction
+func (dbms *DbmsLocal) auditWrite(batch []auditRec) {
+	var ut *db19.UpdateTran
+	defer func() {
+		if e := recover(); e != nil {
+			log.Println("ERROR: audit:", e)
+			if ut != nil {
+				ut.Abort()
+			}
+		}
+	}()
+	ts := dbms.db.GetState().Meta.GetRoSchema("audit")
+	if ts == nil {
+		return
+	}
+	th := &Thread{}
+	ut = dbms.db.NewUpdateTran()
+	for _, ar := range batch {
+		var rb RecordBuilder
+		for _, col := range ts.Columns {
+			if col == "timestamp" {
+				rb.Add(ar.timestamp)
+			} else {
+				rb.Add(SuStr(ar.fields[col]))
+			}
+		}
+		ut.Output(th, "audit", rb.Trim().Build())
+	}
+	ut.Commit()
+	ut = nil
+}
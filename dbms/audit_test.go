@@ -0,0 +1,86 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestAudit(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db19.StartConcur(db, time.Minute)
+	defer db.Close()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	admin := func(s string) { qry.DoAdmin(db, s, nil) }
+	admin("create users (user, passhash) key(user)")
+	ut := db.NewUpdateTran()
+	qry.DoAction(nil, ut, "insert { user: 'admin', passhash: 'x' } into users")
+	ut.Commit()
+	admin("create audit (timestamp, session, address, user, command, " +
+		"args, outcome, extra) key(timestamp)")
+	db.Persist()
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+
+	p1, p2 := net.Pipe()
+	workers = mux.NewWorkers(doRequest)
+	go newServerConn(dbms, p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := NewDbmsClient(p2).NewSession()
+	assert.T(t).That(!ms.Auth(th, "fred\x00wrong"))
+	assert.T(t).That(ms.Auth(th, TokenFor("bob")))
+	ms.SessionId(th, "bob@test")
+	ms.Admin("create tmp (a) key(a)", nil)
+	assert.T(t).This(func() { ms.Admin("drop nonexistent", nil) }).
+		Panics("nonexistent")
+	// Exec arguments are not recorded
+	assert.T(t).This(func() {
+		ms.Exec(th, SuObjectOf(SuStr("NoSuchFn"), SuStr("password")))
+	}).Panics("")
+	ms.Admin("create tmp2 (a) key(a) // "+strings.Repeat("x", 2000), nil)
+	ms.Libraries() // not audited
+	dbms.auditWait()
+	db.Persist()
+
+	rt := db.NewReadTran()
+	q := qry.ParseQuery("audit sort timestamp", rt, nil)
+	q, _, _ = qry.Setup(q, qry.ReadMode, rt)
+	hdr := q.Header()
+	var list []string
+	for row := q.Get(th, Next); row != nil; row = q.Get(th, Next) {
+		var fields []string
+		for _, f := range []string{
+			"session", "user", "command", "args", "outcome", "extra"} {
+			fields = append(fields, ToStr(row.GetVal(hdr, f, th, nil)))
+		}
+		assert.T(t).That(row.GetVal(hdr, "timestamp", th, nil) != EmptyStr)
+		list = append(list, strings.Join(fields, "|"))
+	}
+	assert.T(t).This(list).Is([]string{
+		"pipe||Auth|fred|failed|",
+		"pipe|bob|Auth|bob|ok|",
+		"bob@test|bob|Admin|create tmp (a) key(a)|ok|",
+		"bob@test|bob|Admin|drop nonexistent|" +
+			"can't drop nonexistent table: nonexistent|",
+		"bob@test|bob|Exec|NoSuchFn|can't find NoSuchFn|",
+		"bob@test|bob|Admin|" +
+			("create tmp2 (a) key(a) // " + strings.Repeat("x", 2000))[:1000] +
+			"...|ok|",
+	})
+}
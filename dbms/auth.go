@@ -8,6 +8,7 @@ import (
 	"crypto/sha1"
 	"io"
 	"sync"
+	"time"
 
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/util/hacks"
@@ -17,9 +18,24 @@ import (
 const nonceSize = 8
 const tokenSize = 16
 
-var tokens = make(map[string]bool)
+// tokens are only in memory, so they are lost if the server restarts.
+// They expire after tokenExpiry so unused ones don't accumulate.
+var tokens = make(map[string]tokenInfo)
+
+type tokenInfo struct {
+	user    string
+	expires time.Time
+}
+
 var tokensLock sync.Mutex
 
+// tokenExpiry is how long a token is valid.
+// Reconnecting clients refresh their token more often than this.
+const tokenExpiry = time.Hour
+
+// tokensSwept is the number of tokens after the last removal of expired ones
+var tokensSwept int
+
 func Nonce() string {
 	buf := make([]byte, nonceSize)
 	if _, err := rand.Read(buf); err != nil {
@@ -31,27 +47,53 @@ func Nonce() string {
 // Token generates a random token.
 // It is used by dbms.Token
 func Token() string {
+	return TokenFor("")
+}
+
+// TokenFor generates a random token that authorizes as the given user
+// (for permissions). It is used by the server for Token.
+func TokenFor(user string) string {
 	buf := make([]byte, tokenSize)
 	if _, err := rand.Read(buf); err != nil {
 		panic("Token: " + err.Error())
 	}
 	s := hacks.BStoS(buf)
+	now := time.Now()
 	tokensLock.Lock()
 	defer tokensLock.Unlock()
-	tokens[s] = true
+	if len(tokens) >= 2*max(tokensSwept, 100) {
+		for tok, ti := range tokens {
+			if now.After(ti.expires) {
+				delete(tokens, tok)
+			}
+		}
+		tokensSwept = len(tokens)
+	}
+	tokens[s] = tokenInfo{user: user, expires: now.Add(tokenExpiry)}
 	return s
 }
 
 // AuthToken verifies that the given token is valid.
 // It is used by dbms.Auth
 func AuthToken(s string) bool {
+	_, ok := authToken(s)
+	return ok
+}
+
+// authToken verifies that the given token is valid (and not expired)
+// and returns the user it was issued for
+func authToken(s string) (string, bool) {
 	tokensLock.Lock()
 	defer tokensLock.Unlock()
-	if tokens[s] {
-		delete(tokens, s)
-		return true
+	ti, ok := tokens[s]
+	if !ok {
+		return "", false
+	}
+	delete(tokens, s)
+	if time.Now().After(ti.expires) {
+		return "", false
 	}
-	return false
+	return ti.user, true
 }
 
 func AuthUser(th *Thread, s, nonce string) bool {
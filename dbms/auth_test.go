@@ -24,6 +24,24 @@ func TestToken(*testing.T) {
 	assert.False(AuthToken(tok1))
 	assert.True(AuthToken(tok2))
 	assert.False(AuthToken(tok2))
+
+	// expired tokens are rejected and removed
+	tok3 := Token()
+	tokensLock.Lock()
+	ti := tokens[tok3]
+	ti.expires = time.Now().Add(-time.Second)
+	tokens[tok3] = ti
+	tokensLock.Unlock()
+	assert.False(AuthToken(tok3))
+	for i := 0; i < 500; i++ {
+		tok := Token()
+		tokensLock.Lock()
+		tokens[tok] = tokenInfo{expires: time.Now().Add(-time.Second)}
+		tokensLock.Unlock()
+	}
+	tokensLock.Lock()
+	defer tokensLock.Unlock()
+	assert.That(len(tokens) < 500)
 }
 
 func TestAuthUser(*testing.T) {
@@ -5,6 +5,7 @@ package dbms
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net"
 	"net/http"
@@ -23,6 +24,9 @@ func ConnectClient(addr string, port string) net.Conn {
 		checkServerStatus(addr, port)
 		cantConnect(err.Error())
 	}
+	if conn, err = tlsClient(conn, addr); err != nil {
+		cantConnect(err.Error())
+	}
 	conn.Write(hello())
 	errmsg := checkHello(conn)
 	if errmsg != "" {
@@ -34,6 +38,25 @@ func ConnectClient(addr string, port string) net.Conn {
 	return conn
 }
 
+// dialServer is like ConnectClient but it returns errors
+// rather than being fatal. It is used by standby servers.
+func dialServer(addr string, port string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr+":"+port, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if conn, err = tlsClient(conn, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.Write(hello())
+	if errmsg := checkHello(conn); errmsg != "" {
+		conn.Close()
+		return nil, errors.New(errmsg)
+	}
+	return conn, nil
+}
+
 func clientVersionMismatch(conn net.Conn) {
 	buf := make([]byte, 2)
 	io.ReadFull(conn, buf)
@@ -49,4 +49,9 @@ const (
 	WriteCount
 	EndSession
 	Asof
+	Backup
+	Replicate
+	Changes
+	Drain
+	Maintenance
 )
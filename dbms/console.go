@@ -0,0 +1,177 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+// This is the server side of the admin console (see admin.go in main).
+// It reports the connections, sessions, and transactions
+// and allows aborting a single transaction.
+
+// tranStats are kept for each client transaction for the admin console
+type tranStats struct {
+	tran   ITran
+	start  time.Time
+	update bool
+	reads  atomic.Int64
+	writes atomic.Int64
+}
+
+func (ss *serverSession) addTranStats(tn int, tran ITran, update bool) {
+	ss.statsLock.Lock()
+	defer ss.statsLock.Unlock()
+	ss.tranStats[tn] = &tranStats{tran: tran, start: time.Now(), update: update}
+}
+
+func (ss *serverSession) deleteTranStats(tn int) {
+	ss.statsLock.Lock()
+	defer ss.statsLock.Unlock()
+	delete(ss.tranStats, tn)
+}
+
+// countTran is deferred by command.
+// It adds the rows read and written by the request
+// to the transaction it used (if any).
+func (ss *serverSession) countTran() {
+	tn := ss.curTran
+	ss.curTran = 0
+	if tn == 0 {
+		return
+	}
+	ss.statsLock.Lock()
+	ts := ss.tranStats[tn]
+	ss.statsLock.Unlock()
+	if ts != nil {
+		ts.reads.Add(int64(ss.thread.RowsRead()))
+		ts.writes.Add(int64(ss.written))
+	}
+}
+
+type ConsoleConn struct {
+	Id       uint32           `json:"id"`
+	Address  string           `json:"address"`
+	User     string           `json:"user,omitempty"`
+	Sessions []ConsoleSession `json:"sessions"`
+}
+
+type ConsoleSession struct {
+	SessionId string        `json:"session_id"`
+	Idle      float64       `json:"idle_seconds"`
+	Cursors   int           `json:"cursors"`
+	Trans     []ConsoleTran `json:"transactions"`
+}
+
+type ConsoleTran struct {
+	Num     int     `json:"num"`
+	Update  bool    `json:"update"`
+	Age     float64 `json:"age_seconds"`
+	Read    int64   `json:"rows_read"`
+	Written int64   `json:"rows_written"`
+}
+
+// ConsoleConnections returns the server connections for the admin console
+func ConsoleConnections() []ConsoleConn {
+	now := time.Now()
+	serverConnsLock.Lock()
+	defer serverConnsLock.Unlock()
+	conns := make([]ConsoleConn, 0, len(serverConns))
+	for _, sc := range serverConns {
+		sc.sessionsLock.Lock()
+		cc := ConsoleConn{Id: sc.id, Address: sc.remoteAddr, User: sc.user,
+			Sessions: make([]ConsoleSession, 0, len(sc.sessions))}
+		for _, ss := range sc.sessions {
+			cs := ConsoleSession{SessionId: ss.sessionId.Load(),
+				Idle:    now.Sub(time.Unix(0, ss.lastRequest.Load())).Seconds(),
+				Cursors: int(ss.ncursors.Load())}
+			cs.Trans = ss.consoleTrans(now)
+			cc.Sessions = append(cc.Sessions, cs)
+		}
+		sc.sessionsLock.Unlock()
+		sort.Slice(cc.Sessions, func(i, j int) bool {
+			return cc.Sessions[i].SessionId < cc.Sessions[j].SessionId
+		})
+		conns = append(conns, cc)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].Address != conns[j].Address {
+			return conns[i].Address < conns[j].Address
+		}
+		return conns[i].Id < conns[j].Id
+	})
+	return conns
+}
+
+func (ss *serverSession) consoleTrans(now time.Time) []ConsoleTran {
+	ss.statsLock.Lock()
+	defer ss.statsLock.Unlock()
+	trans := make([]ConsoleTran, 0, len(ss.tranStats))
+	for tn, ts := range ss.tranStats {
+		trans = append(trans, ConsoleTran{Num: tn, Update: ts.update,
+			Age:  now.Sub(ts.start).Seconds(),
+			Read: ts.reads.Load(), Written: ts.writes.Load()})
+	}
+	sort.Slice(trans, func(i, j int) bool { return trans[i].Num < trans[j].Num })
+	return trans
+}
+
+// ConsoleAbort aborts a client update transaction.
+// The client will get an error the next time it uses the transaction.
+// It returns false if the transaction was not found.
+func ConsoleAbort(tn int) bool {
+	var ts *tranStats
+	serverConnsLock.Lock()
+	for _, sc := range serverConns {
+		sc.sessionsLock.Lock()
+		for _, ss := range sc.sessions {
+			ss.statsLock.Lock()
+			if t := ss.tranStats[tn]; t != nil && t.update {
+				ts = t
+			}
+			ss.statsLock.Unlock()
+		}
+		sc.sessionsLock.Unlock()
+	}
+	serverConnsLock.Unlock()
+	if ts == nil {
+		return false
+	}
+	// UpdateTran Abort goes through the checker so it is thread safe
+	// but the session still owns the transaction
+	// so we don't remove it from the session
+	ts.tran.Abort()
+	return true
+}
+
+// ConsoleAuth checks a token (from Database.Token)
+// and returns the user if it is an admin i.e. not restricted by permissions
+func (dbms *DbmsLocal) ConsoleAuth(token string) (string, bool) {
+	user, ok := authToken(token)
+	if !ok || loadPerms(dbms, user) != nil {
+		return "", false
+	}
+	return user, true
+}
+
+// HaveUsers returns whether the database has a users table
+func (dbms *DbmsLocal) HaveUsers() bool {
+	return dbms.db.HaveUsers()
+}
+
+// ConsoleAudit records an admin console action in the audit table (if any)
+func (dbms *DbmsLocal) ConsoleAudit(addr, user, cmd, args, outcome string) {
+	dbms.audit(map[string]string{
+		"session": "admin console",
+		"address": addr,
+		"user":    user,
+		"command": cmd,
+		"args":    args,
+		"outcome": outcome,
+	})
+}
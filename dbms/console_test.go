@@ -0,0 +1,97 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestConsole(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db19.StartConcur(db, time.Minute)
+	defer db.Close()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	admin := func(s string) { qry.DoAdmin(db, s, nil) }
+	action := func(s string) {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, s)
+		ut.Commit()
+	}
+	admin("create users (user, passhash) key(user)")
+	action("insert { user: 'admin', passhash: 'x' } into users")
+	action("insert { user: 'bob', passhash: 'x' } into users")
+	admin("create roles (user, role) key(user, role)")
+	action("insert { user: 'bob', role: 'clerk' } into roles")
+	admin("create tmp (a, b) key(a)")
+	for i := range 5 {
+		action("insert { a: " + IntVal(i).String() + " } into tmp")
+	}
+	db.Persist() // wait for the merges
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+
+	_, ok := dbms.ConsoleAuth("nonsense")
+	assert.T(t).That(!ok)
+	_, ok = dbms.ConsoleAuth(TokenFor("bob"))
+	assert.T(t).That(!ok) // restricted
+	user, ok := dbms.ConsoleAuth(TokenFor("admin"))
+	assert.T(t).That(ok)
+	assert.T(t).This(user).Is("admin")
+
+	workers = mux.NewWorkers(doRequest)
+	p1, p2 := net.Pipe()
+	go newServerConn(dbms, p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := NewDbmsClient(p2).NewSession()
+	assert.T(t).That(ms.Auth(th, TokenFor("admin")))
+	ms.SessionId(th, "console")
+
+	ut := ms.Transaction(true)
+	q := ut.Query("tmp", nil)
+	for row, _ := q.Get(th, Next); row != nil; row, _ = q.Get(th, Next) {
+	}
+	ut.Action(th, "insert { a: 9 } into tmp")
+	rt := ms.Transaction(false)
+
+	var cs *ConsoleSession
+	for _, cc := range ConsoleConnections() {
+		if cc.User == "admin" {
+			for i := range cc.Sessions {
+				if cc.Sessions[i].SessionId == "console" {
+					cs = &cc.Sessions[i]
+				}
+			}
+		}
+	}
+	assert.T(t).That(cs != nil)
+	assert.T(t).This(len(cs.Trans)).Is(2)
+	trans := map[int]ConsoleTran{}
+	for _, tr := range cs.Trans {
+		trans[tr.Num] = tr
+	}
+	tr := trans[ut.Num()]
+	assert.T(t).That(tr.Update)
+	assert.T(t).That(tr.Read >= 5)
+	assert.T(t).This(tr.Written).Is(1)
+	assert.T(t).That(!trans[rt.Num()].Update)
+
+	assert.T(t).That(!ConsoleAbort(rt.Num())) // only update transactions
+	assert.T(t).That(ConsoleAbort(ut.Num()))
+	assert.T(t).This(ut.Complete()).Like("aborted")
+	rt.Complete()
+}
@@ -4,7 +4,12 @@
 package dbms
 
 import (
+	"crypto/sha1"
+	"errors"
+	"io"
 	"net"
+	"os"
+	"strconv"
 	"testing"
 	"time"
 
@@ -12,6 +17,7 @@ import (
 	"github.com/apmckinlay/gsuneido/db19"
 	"github.com/apmckinlay/gsuneido/db19/stor"
 	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
 	"github.com/apmckinlay/gsuneido/options"
 	"github.com/apmckinlay/gsuneido/util/assert"
 )
@@ -37,3 +43,239 @@ func TestClientServer(*testing.T) {
 
 	time.Sleep(25 * time.Millisecond)
 }
+
+func TestReconnect(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	dbmsLocal := NewDbmsLocal(db)
+	workers = mux.NewWorkers(doRequest)
+	var conn net.Conn
+	dc := &dbmsClient{dial: func() (net.Conn, error) {
+		p1, p2 := net.Pipe()
+		go newServerConn(dbmsLocal, p1)
+		if errmsg := checkHello(p2); errmsg != "" {
+			return nil, errors.New(errmsg)
+		}
+		p2.Write(hello())
+		conn = p2
+		return p2, nil
+	}}
+	c, _ := dc.dial()
+	dc.cc = mux.NewRecoverableClientConn(c)
+	ms := dc.NewSession()
+	ms.SessionId(&core.Thread{}, "mysession")
+	tran := ms.Transaction(true)
+	ms.Transaction(false).Complete()
+
+	lost := func() {
+		conn.Close()
+		for !dc.cc.Lost() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	lost()
+	assert.T(t).This(func() { ms.Get(nil, "tables", core.Next) }).
+		Panics("transactions were lost: " + tran.(*muxTran).String())
+	assert.T(t).This(func() { tran.Complete() }).Panics("was lost")
+	row, _, _ := ms.Get(nil, "tables", core.Next)
+	assert.T(t).That(row != nil)
+	assert.T(t).This(ms.SessionId(&core.Thread{}, "")).Is("mysession")
+
+	// other sessions use the new connection
+	ms2 := dc.NewSession()
+	q := ms2.Transaction(false).Query("tables", nil)
+	lost()
+	assert.T(t).This(func() { q.Get(nil, core.Next) }).Panics("transactions were lost")
+	assert.T(t).This(func() { q.Get(nil, core.Next) }).Panics("query was lost")
+	assert.T(t).This(ms.SessionId(&core.Thread{}, "")).Is("mysession")
+	assert.T(t).This(dc.gen).Is(2)
+}
+
+func TestReconnectAuth(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db19.StartConcur(db, time.Minute)
+	defer db.Close()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *core.SuTran {
+		return core.NewSuTran(nil, true)
+	}
+	qry.DoAdmin(db, "create users (user, passhash) key(user)", nil)
+	ut := db.NewUpdateTran()
+	qry.DoAction(nil, ut, "insert { user: 'bob', passhash: 'x' } into users")
+	ut.Commit()
+	db.Persist() // wait for the merge
+	dbmsLocal := NewDbmsLocal(db)
+	workers = mux.NewWorkers(doRequest)
+	var conn net.Conn
+	dc := &dbmsClient{dial: func() (net.Conn, error) {
+		p1, p2 := net.Pipe()
+		go newServerConn(dbmsLocal, p1)
+		if errmsg := checkHello(p2); errmsg != "" {
+			return nil, errors.New(errmsg)
+		}
+		p2.Write(hello())
+		conn = p2
+		return p2, nil
+	}}
+	c, _ := dc.dial()
+	dc.cc = mux.NewRecoverableClientConn(c)
+	ms := dc.NewSession()
+	assert.T(t).That(ms.Auth(nil, TokenFor("bob")))
+	lost := func() {
+		conn.Close()
+		for !dc.cc.Lost() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	lost()
+	row, _, _ := ms.Get(nil, "tables", core.Next)
+	assert.T(t).That(row != nil)
+
+	// the token is refreshed before it expires
+	token := dc.token
+	dc.tokenTime = time.Now().Add(-tokenRefresh - time.Second)
+	ms.Get(nil, "tables", core.Next)
+	assert.T(t).That(dc.token != token)
+	assert.T(t).That(time.Since(dc.tokenTime) < time.Minute)
+
+	// the server lost the token e.g. it restarted
+	tokensLock.Lock()
+	clear(tokens)
+	tokensLock.Unlock()
+	lost()
+	assert.T(t).This(func() { ms.Get(nil, "tables", core.Next) }).
+		Panics("log in again")
+	assert.T(t).This(dc.token).Is("")
+	assert.T(t).This(func() { ms.Get(nil, "tables", core.Next) }).
+		Panics("not authorized")
+	assert.T(t).That(ms.Auth(nil, TokenFor("bob")))
+	row, _, _ = ms.Get(nil, "tables", core.Next)
+	assert.T(t).That(row != nil)
+}
+
+func TestReplicate(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	const primary = "primary.tmp"
+	const standby = "standby.tmp"
+	defer os.Remove(primary)
+	defer os.Remove(standby)
+	db, err := db19.CreateDatabase(primary)
+	assert.This(err).Is(nil)
+	db.CheckerSync()
+	defer db.Close()
+	qry.DoAdmin(db, "create tmp (a) key(a)", nil)
+	db.PersistSync()
+	f, _ := os.Create(standby)
+	_, err = db19.WriteSnapshot(db.GetState(), f)
+	assert.This(err).Is(nil)
+	f.Close()
+	sdb, err := db19.OpenStandby(standby)
+	assert.This(err).Is(nil)
+	defer sdb.Close()
+	for i := 0; i < 10; i++ {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, "insert { a: "+strconv.Itoa(i)+" } into tmp")
+		db.CommitMerge(ut)
+	}
+	db.PersistSync()
+
+	p1, p2 := net.Pipe()
+	workers = mux.NewWorkers(doRequest)
+	go newServerConn(NewDbmsLocal(db), p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := (&dbmsClient{cc: mux.NewRecoverableClientConn(p2)}).NewSession()
+	for {
+		size, end, ck, asof := sdb.ReplicaPos()
+		data, pend, _ := ms.replicate(size, end, ck, asof)
+		assert.This(sdb.ReplicaAppend(data, pend)).Is(nil)
+		if len(data) == 0 {
+			break
+		}
+	}
+	sdbms := NewDbmsLocal(sdb)
+	row, _, _ := sdbms.Get(&core.Thread{}, "tmp where a = 9", core.Only)
+	assert.T(t).That(row != nil)
+	assert.T(t).This(func() { sdbms.Transaction(true) }).Panics("standby")
+	assert.T(t).This(func() { sdbms.Admin("drop tmp", nil) }).Panics("standby")
+
+	p2.Close()
+	assert.T(t).This(func() { ms.replicate(0, 0, 0, 0) }).Panics("lost connection")
+}
+
+func TestReplicateAuth(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	defer db.Close()
+	qry.DoAdmin(db, "create users (user, passhash) key(user)", nil)
+	for _, user := range []string{"fred", replicationUser} {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, "insert { user: '"+user+"', passhash: 'ph' } "+
+			"into users")
+		db.CommitMerge(ut)
+	}
+	db.PersistSync()
+	dbms := NewDbmsLocal(db)
+	core.GetDbms = func() core.IDbms { return dbms }
+	workers = mux.NewWorkers(doRequest)
+	connect := func(user string) *muxSession {
+		p1, p2 := net.Pipe()
+		go newServerConn(dbms, p1)
+		assert.This(checkHello(p2)).Is("")
+		p2.Write(hello())
+		ms := (&dbmsClient{cc: mux.NewRecoverableClientConn(p2)}).NewSession()
+		hash := sha1.New()
+		io.WriteString(hash, ms.Nonce(nil)+"ph")
+		assert.T(t).That(ms.auth(user + "\x00" + string(hash.Sum(nil))))
+		return ms
+	}
+	size, end, ck, asof := db.ReplicaPos()
+	ms := connect("fred")
+	assert.T(t).This(func() { ms.replicate(size, end, ck, asof) }).
+		Panics(notauth)
+	ms = connect(replicationUser)
+	data, _, _ := ms.replicate(size, end, ck, asof)
+	assert.T(t).This(len(data)).Is(0)
+}
+
+func TestChanges(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	qry.DoAdmin(db, "create tmp (a, b) key(a)", nil)
+	qry.DoAdmin(db, "create tmp2 (a) key(a)", nil)
+	_, from := db.Changes(nil, 0, 0)
+	for i := 0; i < 3; i++ {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, "insert { a: "+strconv.Itoa(i)+" } into tmp")
+		qry.DoAction(nil, ut, "insert { a: "+strconv.Itoa(i)+" } into tmp2")
+		db.CommitMerge(ut)
+	}
+	ut := db.NewUpdateTran()
+	qry.DoAction(nil, ut, "update tmp where a = 1 set b = 'x'")
+	qry.DoAction(nil, ut, "delete tmp where a = 2")
+	db.CommitMerge(ut)
+
+	p1, p2 := net.Pipe()
+	workers = mux.NewWorkers(doRequest)
+	go newServerConn(NewDbmsLocal(db), p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := NewDbmsClient(p2).NewSession()
+	list, next := ms.Changes([]string{"tmp"}, from)
+	assert.This(next).Is(from + 8)
+	assert.This(list.ListSize()).Is(5)
+	get := func(i int, mem string) core.Value {
+		return list.ListGet(i).Get(nil, core.SuStr(mem))
+	}
+	assert.This(get(0, "seq")).Is(core.Int64Val(from))
+	assert.This(get(0, "table")).Is(core.SuStr("tmp"))
+	assert.This(get(0, "old")).Is(core.False)
+	assert.This(get(3, "old").Get(nil, core.SuStr("a"))).Is(core.One)
+	assert.This(get(3, "new").Get(nil, core.SuStr("b"))).Is(core.SuStr("x"))
+	assert.This(get(4, "new")).Is(core.False)
+	list, _ = ms.Changes(nil, next)
+	assert.This(list.ListSize()).Is(0)
+}
@@ -4,11 +4,15 @@
 package dbms
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
-
-	"slices"
+	"sync"
+	"time"
 
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/core/trace"
@@ -22,6 +26,17 @@ import (
 // dbmsClient is the mux client that matches dbmsserver.
 type dbmsClient struct {
 	cc *mux.ClientConn
+	// dial is set if the client should reconnect after a lost connection
+	dial func() (net.Conn, error)
+	// lock guards cc, gen, token, and tokenTime
+	lock sync.Mutex
+	// gen is incremented by each reconnect
+	gen int
+	// token is used to re-authenticate after reconnecting
+	token string
+	// tokenTime is when token was issued, it is refreshed after tokenRefresh
+	// so it does not expire (on the server) while the client is connected
+	tokenTime time.Time
 }
 
 func NewDbmsClient(conn net.Conn) *dbmsClient {
@@ -29,13 +44,193 @@ func NewDbmsClient(conn net.Conn) *dbmsClient {
 	return &dbmsClient{cc: cc}
 }
 
+// ConnectDbmsClient connects to the server (like ConnectClient)
+// and returns a client that will reconnect if the connection is lost.
+//
+// After reconnecting, each session re-authenticates (with a token)
+// and re-sends its SessionId. Transactions, queries, and cursors
+// on the server are lost, using them will throw an exception.
+// Use state does not need to be re-sent because clients can't Use or Unuse,
+// the libraries in use are global state on the server, not per session.
+//
+// Tokens are only in memory on the server so if the server restarted,
+// re-authenticating fails. The client still reconnects, but it is no longer
+// authenticated, and the request throws an exception saying to log in again.
+func ConnectDbmsClient(addr, port string) *dbmsClient {
+	conn := ConnectClient(addr, port)
+	return &dbmsClient{cc: mux.NewRecoverableClientConn(conn),
+		dial: func() (net.Conn, error) { return dialServer(addr, port) }}
+}
+
+func (dc *dbmsClient) conn() (*mux.ClientConn, int) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+	return dc.cc, dc.gen
+}
+
+const (
+	reconnectDelay    = time.Second
+	reconnectMaxDelay = 30 * time.Second
+	reconnectTimeout  = 5 * time.Minute
+)
+
+// reconnect replaces a lost connection, retrying with back-off.
+// If another session has already reconnected, it does nothing.
+func (dc *dbmsClient) reconnect(lost *mux.ClientConn) error {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+	if dc.cc != lost {
+		return nil // already reconnected
+	}
+	log.Println("client: lost connection, reconnecting")
+	delay := reconnectDelay
+	deadline := time.Now().Add(reconnectTimeout)
+	for {
+		conn, err := dc.dial()
+		if err == nil {
+			cc := mux.NewRecoverableClientConn(conn)
+			if err = dc.reauth(cc); err == nil || err == errReauth {
+				dc.cc = cc
+				dc.gen++
+				if err == errReauth {
+					// e.g. the server restarted and no longer has the token
+					dc.token = ""
+					log.Println("client: reconnected, but not authenticated")
+					return err
+				}
+				log.Println("client: reconnected")
+				return nil
+			}
+			cc.Close()
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(delay)
+		delay = min(2*delay, reconnectMaxDelay)
+	}
+}
+
+var errReauth = errors.New("reconnected, but can't re-authenticate " +
+	"(the server may have restarted), log in again")
+
+// reauth authenticates a new connection with the saved token (if any)
+// and gets a new token for the next reconnect
+func (dc *dbmsClient) reauth(cc *mux.ClientConn) (err error) {
+	if dc.token == "" {
+		return nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	cs := cc.NewClientSession()
+	cs.PutCmd(commands.Auth).PutStr(dc.token)
+	cs.Request()
+	if !cs.GetBool() {
+		return errReauth
+	}
+	cs.PutCmd(commands.Token)
+	cs.Request()
+	dc.token = cs.GetStr()
+	dc.tokenTime = time.Now()
+	cs.PutCmd(commands.EndSession)
+	cs.EndMsg()
+	return nil
+}
+
 type muxSession struct {
 	*mux.ClientSession
+	dc *dbmsClient
+	// gen is the dbmsClient gen of ClientSession
+	gen int
+	// sessionId is set by SessionId so it can be re-sent after reconnecting
+	sessionId string
+	// trans are the outstanding transactions,
+	// so we can report which were lost by a reconnect
+	trans intSet
 }
 
 func (dc *dbmsClient) NewSession() *muxSession {
-	cs := dc.cc.NewClientSession()
-	return &muxSession{ClientSession: cs}
+	cc, gen := dc.conn()
+	return &muxSession{ClientSession: cc.NewClientSession(), dc: dc, gen: gen,
+		trans: make(intSet)}
+}
+
+// PutCmd starts a request, first resuming the session
+// if the connection was lost and the client reconnects
+func (ms *muxSession) PutCmd(cmd commands.Command) *mux.WriteBuf {
+	ms.resume()
+	ms.refreshToken()
+	return ms.ClientSession.PutCmd(cmd)
+}
+
+// tokenRefresh is how often a reconnecting client gets a new token
+const tokenRefresh = tokenExpiry / 2
+
+// refreshToken gets a new token for reconnecting
+// if the current one is older than tokenRefresh.
+// Only one session does the refresh.
+func (ms *muxSession) refreshToken() {
+	dc := ms.dc
+	if dc.dial == nil {
+		return
+	}
+	dc.lock.Lock()
+	due := dc.token != "" && time.Since(dc.tokenTime) > tokenRefresh
+	if due {
+		dc.tokenTime = time.Now()
+	}
+	dc.lock.Unlock()
+	if due {
+		token := ms.Token()
+		dc.lock.Lock()
+		dc.token = token
+		dc.lock.Unlock()
+	}
+}
+
+// resume reconnects (if necessary) and switches the session
+// to the new connection, re-sending the SessionId.
+// If the session had outstanding transactions it panics
+// with a list of the transactions that were lost.
+func (ms *muxSession) resume() {
+	if ms.dc.dial == nil {
+		return // not reconnecting
+	}
+	cc, gen := ms.dc.conn()
+	if cc.Lost() {
+		if err := ms.dc.reconnect(cc); err == errReauth {
+			panic("lost connection: " + err.Error())
+		} else if err != nil {
+			panic("lost connection: can't reconnect: " + err.Error())
+		}
+		cc, gen = ms.dc.conn()
+	}
+	if gen == ms.gen {
+		return
+	}
+	ms.ClientSession = cc.NewClientSession()
+	ms.gen = gen
+	if ms.sessionId != "" {
+		ms.ClientSession.PutCmd(commands.SessionId).PutStr(ms.sessionId)
+		ms.Request()
+	}
+	if len(ms.trans) > 0 {
+		tns := make([]int, 0, len(ms.trans))
+		for tn := range ms.trans {
+			tns = append(tns, tn)
+		}
+		slices.Sort(tns)
+		lost := make([]string, len(tns))
+		for i, tn := range tns {
+			lost[i] = tranName(tn)
+		}
+		clear(ms.trans)
+		panic("lost connection: reconnected, but transactions were lost: " +
+			strings.Join(lost, ", "))
+	}
 }
 
 // Dbms interface
@@ -57,7 +252,30 @@ func (ms *muxSession) auth(s string) bool {
 	}
 	ms.PutCmd(commands.Auth).PutStr(s)
 	ms.Request()
-	return ms.GetBool()
+	if !ms.GetBool() {
+		return false
+	}
+	if ms.dc.dial != nil {
+		token := ms.Token()
+		ms.dc.lock.Lock()
+		ms.dc.token = token
+		ms.dc.tokenTime = time.Now()
+		ms.dc.lock.Unlock()
+	}
+	return true
+}
+
+func (ms *muxSession) Backup(to, base string) uint64 {
+	ms.PutCmd(commands.Backup).PutStr(to).PutStr(base)
+	ms.Request()
+	return uint64(ms.GetInt64())
+}
+
+func (ms *muxSession) Changes(tables []string, from int64) (*SuObject, int64) {
+	ms.PutCmd(commands.Changes).PutStrs(tables).PutInt64(from)
+	ms.Request()
+	next := ms.GetInt64()
+	return ms.GetVal().(*SuObject), next
 }
 
 func (ms *muxSession) Check() string {
@@ -67,7 +285,10 @@ func (ms *muxSession) Check() string {
 }
 
 func (ms *muxSession) Close() {
-	ms.PutCmd(commands.EndSession)
+	if ms.Lost() {
+		return // nothing to close on the server
+	}
+	ms.ClientSession.PutCmd(commands.EndSession)
 	ms.EndMsg()
 }
 
@@ -97,6 +318,11 @@ func (ms *muxSession) EnableTrigger(string) {
 	assert.ShouldNotReachHere()
 }
 
+func (ms *muxSession) Drain(timeout int) {
+	ms.PutCmd(commands.Drain).PutInt(timeout)
+	ms.Request()
+}
+
 func (ms *muxSession) Exec(_ *Thread, args Value) Value {
 	packed := PackValue(args) // do this first because it could panic
 	if trace.ClientServer.On() {
@@ -144,6 +370,11 @@ func (ms *muxSession) Kill(sessionid string) int {
 	return ms.GetInt()
 }
 
+func (ms *muxSession) Maintenance(on bool) {
+	ms.PutCmd(commands.Maintenance).PutBool(on)
+	ms.Request()
+}
+
 func (ms *muxSession) Log(s string) {
 	ms.PutCmd(commands.Log).PutStr(s)
 	ms.Request()
@@ -194,6 +425,9 @@ func (ms *muxSession) SessionId(th *Thread, id string) string {
 	ms.PutCmd(commands.SessionId).PutStr(id)
 	ms.Request()
 	s := ms.GetStr()
+	if id != "" {
+		ms.sessionId = s
+	}
 	th.SetSession(s)
 	return s
 }
@@ -220,7 +454,8 @@ func (ms *muxSession) Transaction(update bool) ITran {
 	ms.PutCmd(commands.Transaction).PutBool(update)
 	ms.Request()
 	tn := ms.GetInt()
-	return &muxTran{muxSession: ms, tn: tn}
+	ms.trans[tn] = struct{}{}
+	return &muxTran{muxSession: ms, tn: tn, gen: ms.gen}
 }
 
 func (ms *muxSession) Transactions() *SuObject {
@@ -272,12 +507,30 @@ func (ms *muxSession) getRow(off int) Row {
 
 type muxTran struct {
 	*muxSession
-	tn       int
+	tn  int
+	gen int
 }
 
 var _ ITran = (*muxTran)(nil)
 
+// PutCmd checks that the transaction was not lost by a reconnect
+func (tc *muxTran) PutCmd(cmd commands.Command) *mux.WriteBuf {
+	tc.resume()
+	if tc.gen != tc.muxSession.gen {
+		panic("transaction " + tc.String() + " was lost (lost connection)")
+	}
+	return tc.ClientSession.PutCmd(cmd)
+}
+
+// ended removes the transaction from the outstanding transactions
+func (tc *muxTran) ended() {
+	if tc.gen == tc.muxSession.gen {
+		delete(tc.trans, tc.tn)
+	}
+}
+
 func (tc *muxTran) Abort() string {
+	defer tc.ended()
 	tc.PutCmd(commands.Abort).PutInt(tc.tn)
 	tc.Request()
 	return ""
@@ -290,6 +543,7 @@ func (tc *muxTran) Asof(asof int64) int64 {
 }
 
 func (tc *muxTran) Complete() string {
+	defer tc.ended()
 	tc.PutCmd(commands.Commit).PutInt(tc.tn)
 	tc.Request()
 	if tc.GetBool() {
@@ -320,10 +574,10 @@ func (tc *muxTran) ReadCount() int {
 	return tc.GetInt()
 }
 
-func (tc *muxTran) Action(_ *Thread, action string) int {
+func (tc *muxTran) Action(_ *Thread, action string) Value {
 	tc.PutCmd(commands.Action).PutInt(tc.tn).PutStr(action)
 	tc.Request()
-	return tc.GetInt()
+	return tc.GetVal()
 }
 
 func (tc *muxTran) Update(_ *Thread, table string, off uint64, rec Record) uint64 {
@@ -344,11 +598,15 @@ func (tc *muxTran) Num() int {
 }
 
 func (tc *muxTran) String() string {
+	return tranName(tc.tn)
+}
+
+func tranName(tn int) string {
 	pre := "rt"
-	if tc.tn % 2 == 1 {
+	if tn%2 == 1 {
 		pre = "ut"
-    }
-	return pre + strconv.Itoa(tc.tn)
+	}
+	return pre + strconv.Itoa(tn)
 }
 
 // ------------------------------------------------------------------
@@ -359,6 +617,7 @@ type muxQueryCursor struct {
 	hdr  *Header
 	keys []string // cache
 	id   int
+	gen  int
 	qc   qcType
 }
 
@@ -369,6 +628,19 @@ const (
 	cursor qcType = 'c'
 )
 
+// PutCmd checks that the query or cursor was not lost by a reconnect
+func (qc *muxQueryCursor) PutCmd(cmd commands.Command) *mux.WriteBuf {
+	qc.resume()
+	if qc.gen != qc.muxSession.gen {
+		what := "query"
+		if qc.qc == cursor {
+			what = "cursor"
+		}
+		panic(what + " was lost (lost connection)")
+	}
+	return qc.ClientSession.PutCmd(cmd)
+}
+
 func (qc *muxQueryCursor) Close() {
 	qc.PutCmd(commands.Close).PutInt(qc.id).PutByte(byte(qc.qc))
 	qc.Request()
@@ -419,7 +691,8 @@ type muxQuery struct {
 }
 
 func (ms *muxSession) newClientQuery(qn int) *muxQuery {
-	return &muxQuery{muxQueryCursor{muxSession: ms, id: qn, qc: query}}
+	return &muxQuery{muxQueryCursor{muxSession: ms, id: qn, gen: ms.gen,
+		qc: query}}
 }
 
 var _ IQuery = (*muxQuery)(nil)
@@ -447,7 +720,8 @@ type muxCursor struct {
 }
 
 func (ms *muxSession) newClientCursor(cn int) *muxCursor {
-	return &muxCursor{muxQueryCursor{muxSession: ms, id: cn, qc: cursor}}
+	return &muxCursor{muxQueryCursor{muxSession: ms, id: cn, gen: ms.gen,
+		qc: cursor}}
 }
 
 var _ ICursor = (*muxCursor)(nil)
@@ -8,6 +8,7 @@ import (
 	"log"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"slices"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/apmckinlay/gsuneido/options"
 	"github.com/apmckinlay/gsuneido/util/generic/atomics"
 	"github.com/apmckinlay/gsuneido/util/generic/slc"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/str"
 )
 
@@ -30,6 +32,7 @@ type DbmsLocal struct {
 	db        *db19.Database
 	libraries atomics.Value[[]string]
 	badlibs   atomic.Bool // limits logging
+	audits    auditBuffer
 }
 
 func NewDbmsLocal(db *db19.Database) *DbmsLocal {
@@ -44,6 +47,7 @@ var _ IDbms = (*DbmsLocal)(nil)
 
 func (dbms *DbmsLocal) Admin(admin string, sv *Sviews) {
 	trace.Dbms.Println("Admin", admin)
+	dbms.ckStandby()
 	qry.DoAdmin(dbms.db, admin, sv)
 }
 
@@ -59,6 +63,45 @@ func (dbms *DbmsLocal) Auth(th *Thread, s string) bool {
 	return true
 }
 
+func (dbms *DbmsLocal) Backup(to, base string) uint64 {
+	trace.Dbms.Println("Backup", to, base)
+	if to == "" {
+		to = "backup.db"
+	}
+	size, err := tools.Backup(dbms.db, to, base)
+	if err != nil {
+		panic(err.Error())
+	}
+	return size
+}
+
+// changesMaxSize limits the record data returned by one Changes call.
+// It must allow for the packing overhead within the mux message size limit.
+const changesMaxSize = 256 * 1024
+
+func (dbms *DbmsLocal) Changes(tables []string, from int64) (*SuObject, int64) {
+	list, next := dbms.db.Changes(tables, from, changesMaxSize)
+	ob := &SuObject{}
+	for _, c := range list {
+		hdr := SimpleHeader(c.Columns)
+		x := &SuObject{}
+		x.Set(SuStr("seq"), Int64Val(c.Seq))
+		x.Set(SuStr("table"), SuStr(c.Table))
+		x.Set(SuStr("asof"), SuDateFromUnixMilli(c.Asof))
+		x.Set(SuStr("old"), changeRec(c.Old, hdr))
+		x.Set(SuStr("new"), changeRec(c.New, hdr))
+		ob.Add(x)
+	}
+	return ob, next
+}
+
+func changeRec(rec Record, hdr *Header) Value {
+	if rec == "" {
+		return False
+	}
+	return SuRecordFromRow(Row{DbRec{Record: rec}}, hdr, "", nil)
+}
+
 func auth(th *Thread, s string) bool {
 	if AuthUser(th, s, th.Nonce) {
 		th.Nonce = ""
@@ -128,6 +171,27 @@ func (dbms *DbmsLocal) Dump(table, to, publicKey string) string {
 	return ""
 }
 
+// Export writes a table as CSV or JSON Lines (jsonl)
+// and returns the number of records exported
+func (dbms *DbmsLocal) Export(table, to, format string) int {
+	n, err := tools.ExportDbTable(dbms.db, table, format, to)
+	if err != nil {
+		panic(err.Error())
+	}
+	return n
+}
+
+// Import adds records to a table from CSV or JSON Lines (jsonl)
+// and returns the number of records imported
+func (dbms *DbmsLocal) Import(table, from, format string) int {
+	dbms.ckStandby()
+	n, err := tools.ImportDbTable(dbms.db, table, format, from)
+	if err != nil {
+		panic(err.Error())
+	}
+	return n
+}
+
 func (*DbmsLocal) Exec(th *Thread, v Value) Value {
 	return th.RunWithMainSuneido(func() Value {
 		trace.Dbms.Println("Exec", v)
@@ -158,6 +222,10 @@ func get(th *Thread, tran qry.QueryTran, query string, dir Dir) (Row, *Header, s
 	q := qry.ParseQuery(query, tran, th.Sviews())
 	q, fixcost, varcost := qry.Setup1(q, qry.ReadMode, tran)
 	qry.Warnings(query, q)
+	th.SetStrategy(func() string {
+		return queryLocal{Query: q, cost: fixcost + varcost,
+			mode: qry.ReadMode}.Strategy(false)
+	})
 	if trace.Query.On() {
 		d := map[Dir]string{Only: "one", Next: "first", Prev: "last"}[dir]
 		trace.Query.Println(d, fixcost+varcost, "-", query)
@@ -181,6 +249,16 @@ func (dbms *DbmsLocal) Info() Value {
 	ob := &SuObject{}
 	ob.Set(SuStr("currentSize"), Int64Val(int64(dbms.db.Size())))
 	ob.Set(SuStr("timeoutMin"), IntVal(int(options.TimeoutMinutes)))
+	if dbms.db.Standby() {
+		ob.Set(SuStr("standby"), True)
+	}
+	if mode := ServerMode(); mode != "" {
+		ob.Set(SuStr("mode"), SuStr(mode))
+	}
+	if draining.Load() {
+		ob.Set(SuStr("shutdown"),
+			FromGoTime(time.UnixMilli(drainDeadline.Load())))
+	}
 	return ob
 }
 
@@ -192,6 +270,7 @@ func (*DbmsLocal) Kill(addr string) int {
 }
 
 func (dbms *DbmsLocal) Load(table, from, privateKey, passphrase string) int {
+	dbms.ckStandby()
 	if from == "" {
 		from = table + ".su"
 	}
@@ -263,7 +342,7 @@ func (dbms *DbmsLocal) Libraries() []string {
 }
 
 func (*DbmsLocal) Log(s string) {
-	log.Println(s)
+	logging.Println("client", "", s)
 }
 
 func (*DbmsLocal) Nonce(th *Thread) string {
@@ -303,6 +382,7 @@ func (*DbmsLocal) Token() string {
 
 func (dbms *DbmsLocal) Transaction(update bool) ITran {
 	if update {
+		dbms.ckStandby()
 		if t := dbms.db.NewUpdateTran(); t != nil {
 			return &UpdateTranLocal{UpdateTran: t}
 		}
@@ -362,6 +442,32 @@ func (dbms *DbmsLocal) updateLibraries(fn func(libs []string) []string) bool {
 	return slices.Equal(oldlibs, dbms.libraries.Swap(newlibs))
 }
 
+// ckStandby panics if the database is a read-only standby
+func (dbms *DbmsLocal) ckStandby() {
+	if dbms.db.Standby() {
+		panic("not allowed on a standby server (read-only)")
+	}
+}
+
+// rows returns the values of fields from the results of a query.
+// It is for internal use and uses its own Thread so it isn't limited.
+func (dbms *DbmsLocal) rows(query string, fields ...string) [][]string {
+	th := &Thread{}
+	tran := dbms.db.NewReadTran()
+	q := qry.ParseQuery(query, tran, nil)
+	q, _, _ = qry.Setup(q, qry.ReadMode, tran)
+	hdr := q.Header()
+	var list [][]string
+	for row := q.Get(th, Next); row != nil; row = q.Get(th, Next) {
+		vals := make([]string, len(fields))
+		for i, f := range fields {
+			vals[i] = ToStrOrString(row.GetVal(hdr, f, th, nil))
+		}
+		list = append(list, vals)
+	}
+	return list
+}
+
 func (dbms *DbmsLocal) Unwrap() IDbms {
 	return dbms
 }
@@ -373,6 +479,7 @@ func (dbms *DbmsLocal) FormatQuery(query string) string {
 }
 
 func (dbms *DbmsLocal) Close() {
+	dbms.auditWait()
 	dbms.db.Close()
 }
 
@@ -414,7 +521,7 @@ func (t ReadTranLocal) Query(query string, sv *Sviews) IQuery {
 	return queryLocal{Query: q, cost: fixcost + varcost, mode: qry.ReadMode}
 }
 
-func (t ReadTranLocal) Action(*Thread, string) int {
+func (t ReadTranLocal) Action(*Thread, string) Value {
 	panic("cannot do action in read-only transaction")
 }
 
@@ -434,9 +541,9 @@ func (t UpdateTranLocal) Query(query string, sv *Sviews) IQuery {
 	return queryLocal{Query: q, cost: fixcost + varcost, mode: qry.UpdateMode}
 }
 
-func (t UpdateTranLocal) Action(th *Thread, action string) int {
+func (t UpdateTranLocal) Action(th *Thread, action string) Value {
 	trace.Dbms.Println("Action", action)
-	return qry.DoAction(th, t.UpdateTran, action)
+	return qry.DoActionResult(th, t.UpdateTran, action)
 }
 
 // queryLocal
@@ -500,6 +607,9 @@ type cursorLocal struct {
 }
 
 func (q cursorLocal) Get(th *Thread, t ITran, dir Dir) (Row, string) {
+	if pt, ok := t.(permsTran); ok {
+		t = pt.ITran
+	}
 	q.Query.SetTran(t.(qry.QueryTran))
 	return q.queryLocal.Get(th, dir)
 }
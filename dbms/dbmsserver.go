@@ -5,12 +5,14 @@ package dbms
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -24,6 +26,8 @@ import (
 	"github.com/apmckinlay/gsuneido/util/assert"
 	"github.com/apmckinlay/gsuneido/util/exit"
 	"github.com/apmckinlay/gsuneido/util/generic/atomics"
+	"github.com/apmckinlay/gsuneido/util/hacks"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/str"
 	"golang.org/x/time/rate"
 )
@@ -49,6 +53,16 @@ type serverConn struct {
 	sessionsLock sync.Mutex // guards sessions
 	// id is primarily used as a key to store the set of connections in a map
 	id uint32
+	// lag is set by cmdReplicate if this is a standby connection
+	lag atomic.Pointer[replicaLag]
+	// user is set by cmdAuth (guarded by sessionsLock for the admin console)
+	user string
+	// perms is set by cmdAuth if the user is restricted by permissions
+	perms *perms
+	// limits is set by newServerConn and cmdAuth, nil if no limits
+	limits atomic.Pointer[limits]
+	// ntrans is the number of transactions for all the sessions
+	ntrans atomic.Int32
 }
 
 // serverSession handles one client session.
@@ -64,6 +78,26 @@ type serverSession struct {
 	queryTrans    map[int]int    // query id => transaction id
 	sessionId     atomics.String
 	nonce         string
+	// auditArgs and auditOutcome are set by commands for audit
+	auditArgs    string
+	auditOutcome string
+	// ncursors is len(cursors), used by metrics
+	ncursors atomic.Int32
+	// queryText is the query for each query and cursor, for the slow log
+	queryText map[int]string
+	// slowQuery, slowQc, slowAction, and written are set by commands
+	// for the slow log
+	slowQuery  string
+	slowQc     IQueryCursor
+	slowAction bool
+	written    int
+	// curTran is the transaction used by the request (if any)
+	curTran int
+	// tranStats are for the admin console (see console.go)
+	tranStats map[int]*tranStats
+	statsLock sync.Mutex // guards tranStats
+	// lastRequest is the time (UnixNano) of the last request
+	lastRequest atomic.Int64
 	mux.ReadBuf
 	// id is primarily used as a key to store the set of sessions in a map
 	id uint32
@@ -78,6 +112,13 @@ func Server(dbms *DbmsLocal) {
 	if err != nil {
 		Fatal(err)
 	}
+	tlsConfig, err := tlsServerConfig()
+	if err != nil {
+		Fatal("dbms server tls:", err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
 	go idleTimeout()
 	var tempDelay time.Duration // how long to sleep on accept failure
 	limiter := rate.NewLimiter(rate.Limit(100), 10)
@@ -134,11 +175,21 @@ func idleCheck() {
 
 func (sc *serverConn) serverLog(args ...any) {
 	args = append([]any{"dbms server:", sc.remoteAddr + ":"}, args...)
-	log.Println(args...)
+	logging.Println("dbms", sc.remoteAddr, args...)
 }
 
 func newServerConn(dbms *DbmsLocal, conn net.Conn) {
 	trace.ClientServer.Println("server connection")
+	if err := tlsHandshake(conn); err != nil {
+		log.Println("dbms server:", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if draining.Load() {
+		conn.Write(unavailable("shutting down"))
+		conn.Close()
+		return
+	}
 	conn.Write(hello())
 	if errmsg := checkHello(conn); errmsg != "" {
 		if strings.HasPrefix(errmsg, "version mismatch") {
@@ -154,6 +205,7 @@ func newServerConn(dbms *DbmsLocal, conn net.Conn) {
 	if dbms.db.HaveUsers() {
 		sc.dbms = &DbmsUnauth{dbms: dbms}
 	}
+	sc.limits.Store(loadLimits(dbms, ""))
 	serverConnsLock.Lock()
 	serverConns[sc.id] = sc
 	serverConnsLock.Unlock()
@@ -200,20 +252,48 @@ func doRequest(wb *mux.WriteBuf, th *Thread, id uint64, req []byte) {
 			queries:     make(map[int]IQuery),
 			tranQueries: make(map[int]intSet),
 			queryTrans:  make(map[int]int),
+			queryText:   make(map[int]string),
+			tranStats:   make(map[int]*tranStats),
 		}
 		ss.sessionId.Store(sc.remoteAddr)
 		sc.sessions[sid] = ss
 	}
 	sc.sessionsLock.Unlock()
 
+	ss.lastRequest.Store(time.Now().UnixNano())
 	ss.ReadBuf.SetBuf(req)
 	ss.WriteBuf = wb
 	th.SetSession(ss.sessionId.Load())
 	th.SetSviews(&sc.Sviews)
+	th.SetLimits(sc.limits.Load().request())
+	th.SetDbms(sc.threadDbms())
 	ss.thread = th
 	ss.request()
 }
 
+// threadDbms returns the dbms for code run on the server by a request,
+// e.g. functions called by where or extend expressions.
+// For a restricted connection it checks the permissions (see perms.go).
+func (sc *serverConn) threadDbms() IDbms {
+	if sc.perms != nil {
+		return sc.perms.thread
+	}
+	if du, ok := sc.dbms.(*DbmsUnauth); ok {
+		return du.dbms
+	}
+	return sc.dbms
+}
+
+// unrestricted sets the thread to use the unrestricted dbms.
+// It is used by Exec and Run since permission for them
+// allows running any code on the server.
+func (ss *serverSession) unrestricted() *Thread {
+	if ss.sc.perms != nil {
+		ss.thread.SetDbms(ss.sc.perms.dbms)
+	}
+	return ss.thread
+}
+
 func (ss *serverSession) request() {
 	var icmd commands.Command
 	defer func() {
@@ -231,14 +311,30 @@ func (ss *serverSession) request() {
 		ss.sc.serverLog("closed connection: invalid command")
 		return
 	}
-	cmd := cmds[icmd]
-	cmd(ss)
+	ss.command(icmd)
 	assert.That(ss.Remaining() == 0) // should consume entire message
 	if icmd != commands.EndSession {
 		ss.EndMsg()
 	}
 }
 
+// command runs a command, recording it in the audit log
+// and the slow request log if required.
+// These must be done before the response is sent.
+func (ss *serverSession) command(icmd commands.Command) {
+	ss.slowReset()
+	defer ss.checkSlow(icmd, time.Now())
+	defer ss.countTran()
+	ss.auditArgs, ss.auditOutcome = "", ""
+	defer ss.audit(icmd)
+	ss.sc.checkMaintenance(icmd)
+	if ss.sc.perms != nil {
+		ss.sc.perms.command(icmd)
+	}
+	cmd := cmds[icmd]
+	cmd(ss)
+}
+
 func errToStr(e any) string {
 	if t, ok := e.(interface{ ToStr() (string, bool) }); ok {
 		if s, ok := t.ToStr(); ok {
@@ -261,8 +357,9 @@ func (ss *serverSession) close() {
 }
 
 func (ss *serverSession) abort() {
-	for _, tran := range ss.trans {
+	for tn, tran := range ss.trans {
 		tran.Abort()
+		ss.deleteTran(tn)
 	}
 }
 
@@ -308,6 +405,13 @@ func Conns() string {
 		sb.WriteString("</ul>\r\n")
 	}
 	sb.WriteString("</ul>\r\n")
+	for _, sc := range conns {
+		if lag := sc.lag.Load(); lag != nil {
+			sb.WriteString("<p>Standby " + sc.remoteAddr + " lag: " +
+				lag.String() + "</p>\r\n")
+		}
+	}
+	sb.WriteString(standbyStatus())
 	return sb.String()
 }
 
@@ -340,10 +444,15 @@ func cmdAbort(ss *serverSession) {
 }
 
 func (ss *serverSession) deleteTran(tn int) {
+	if _, ok := ss.trans[tn]; ok {
+		ss.sc.ntrans.Add(-1)
+	}
 	delete(ss.trans, tn)
+	ss.deleteTranStats(tn)
 	for qn := range ss.tranQueries[tn] {
 		delete(ss.queries, qn)
 		delete(ss.queryTrans, qn)
+		delete(ss.queryText, qn)
 		if len(ss.queries) != len(ss.queryTrans) {
 			log.Println("ERROR deleteTran", len(ss.queries), "!=", len(ss.queryTrans))
 		}
@@ -356,6 +465,7 @@ func (ss *serverSession) getTran() (ITran, int) {
 	if tn == 0 {
 		return nil, 0
 	}
+	ss.curTran = tn
 	return ss.tran(tn), tn
 }
 
@@ -370,12 +480,30 @@ func (ss *serverSession) tran(tn int) ITran {
 func cmdAction(ss *serverSession) {
 	tran, _ := ss.getTran()
 	action := ss.GetStr()
-	n := tran.Action(ss.thread, action)
-	ss.PutBool(true).PutInt(n)
+	if ss.sc.perms != nil {
+		ss.sc.perms.action(action, &ss.sc.Sviews)
+	}
+	ss.slowQuery, ss.slowAction = action, true
+	result := tran.Action(ss.thread, action)
+	ss.written = actionCount(result)
+	ss.PutBool(true).PutVal(result)
+}
+
+// actionCount returns the number of records written by an action
+func actionCount(result Value) int {
+	if ob, ok := result.ToContainer(); ok {
+		return ToInt(ob.Get(nil, SuStr("inserted"))) +
+			ToInt(ob.Get(nil, SuStr("updated")))
+	}
+	return ToInt(result)
 }
 
 func cmdAdmin(ss *serverSession) {
 	s := ss.GetStr()
+	ss.auditArgs = s
+	if ss.sc.perms != nil {
+		ss.sc.perms.admin(s)
+	}
 	ss.sc.dbms.Admin(s, &ss.sc.Sviews)
 	ss.PutBool(true)
 }
@@ -385,19 +513,36 @@ func cmdAuth(ss *serverSession) {
 	if _, ok := ss.sc.dbms.(*DbmsUnauth); !ok {
 		panic("already authorized")
 	}
-	result := ss.auth(s)
+	user, result := ss.auth(s)
+	ss.auditArgs = user
 	if result {
-		ss.sc.dbms = ss.sc.dbms.(*DbmsUnauth).dbms // remove DbmsUnauth
+		dbms := ss.sc.dbms.(*DbmsUnauth).dbms
+		ss.sc.sessionsLock.Lock()
+		ss.sc.user = user
+		ss.sc.sessionsLock.Unlock()
+		ss.sc.perms = loadPerms(dbms, user)
+		ss.sc.limits.Store(loadLimits(dbms, user))
+		ss.sc.dbms = dbms // remove DbmsUnauth
+	} else {
+		ss.auditOutcome = "failed"
 	}
 	ss.PutBool(true).PutBool(result)
 }
 
-func (ss *serverSession) auth(s string) bool {
+// auth returns the user and whether it succeeded.
+// If it fails, user is the attempted user (or "" for a token)
+func (ss *serverSession) auth(s string) (string, bool) {
 	if AuthUser(ss.thread, s, ss.nonce) {
 		ss.nonce = ""
-		return true
+		return str.BeforeFirst(s, "\x00"), true
+	}
+	if user, ok := authToken(s); ok {
+		return user, true
 	}
-	return AuthToken(s)
+	if strings.Contains(s, "\x00") {
+		return str.BeforeFirst(s, "\x00"), false
+	}
+	return "", false
 }
 
 func cmdAsof(ss *serverSession) {
@@ -407,6 +552,21 @@ func cmdAsof(ss *serverSession) {
 	ss.PutBool(true).PutInt64(tran.Asof(asof))
 }
 
+func cmdBackup(ss *serverSession) {
+	to := ss.GetStr()
+	base := ss.GetStr()
+	ss.auditArgs = to
+	size := ss.sc.dbms.Backup(to, base)
+	ss.PutBool(true).PutInt64(int64(size))
+}
+
+func cmdChanges(ss *serverSession) {
+	tables := ss.GetStrs()
+	from := ss.GetInt64()
+	list, next := ss.sc.dbms.Changes(tables, from)
+	ss.PutBool(true).PutInt64(next).PutVal(list)
+}
+
 func cmdCheck(ss *serverSession) {
 	s := ss.sc.dbms.Check()
 	ss.PutBool(true).PutStr(s)
@@ -421,6 +581,7 @@ func cmdClose(ss *serverSession) {
 			ss.error("query not found")
 		}
 		delete(ss.queries, qn)
+		delete(ss.queryText, qn)
 		tn := ss.queryTrans[qn]
 		delete(ss.queryTrans, qn)
 		if len(ss.queries) != len(ss.queryTrans) {
@@ -434,6 +595,8 @@ func cmdClose(ss *serverSession) {
 			ss.error("cursor not found")
 		}
 		delete(ss.cursors, qn)
+		delete(ss.queryText, qn)
+		ss.ncursors.Store(int32(len(ss.cursors)))
 		c.Close()
 	default:
 		ss.error("dbms server expected q or c")
@@ -474,9 +637,16 @@ func connections() *SuObject {
 
 func cmdCursor(ss *serverSession) {
 	query := ss.GetStr()
+	if ss.sc.perms != nil {
+		ss.sc.perms.query(query, &ss.sc.Sviews)
+	}
+	ss.slowQuery = query
 	q := ss.sc.dbms.Cursor(query, &ss.sc.Sviews)
+	ss.slowQc = q
 	num := int(lastNum.Add(1))
 	ss.cursors[num] = q
+	ss.queryText[num] = query
+	ss.ncursors.Store(int32(len(ss.cursors)))
 	ss.PutBool(true).PutInt(num)
 }
 
@@ -484,6 +654,13 @@ func cmdCursors(ss *serverSession) {
 	ss.PutBool(true).PutInt(len(ss.cursors))
 }
 
+func cmdDrain(ss *serverSession) {
+	timeout := ss.GetInt()
+	ss.auditArgs = strconv.Itoa(timeout)
+	ss.sc.dbms.Drain(timeout)
+	ss.PutBool(true)
+}
+
 func cmdEndSession(ss *serverSession) {
 	// ss.sc.serverLog("closing connection: received EndSession")
 	ss.close()
@@ -494,13 +671,18 @@ func cmdErase(ss *serverSession) {
 	tran, _ := ss.getTran()
 	table := ss.GetStr()
 	off := uint64(ss.GetInt64())
+	if ss.sc.perms != nil {
+		ss.sc.perms.check(writeAccess, table)
+	}
 	tran.Delete(ss.thread, table, off)
+	ss.written = 1
 	ss.PutBool(true)
 }
 
 func cmdExec(ss *serverSession) {
 	ob := ss.GetVal()
-	v := ss.sc.dbms.Exec(ss.thread, ob)
+	ss.auditArgs = auditExec(ob)
+	v := ss.sc.dbms.Exec(ss.unrestricted(), ob)
 	ss.PutResult(v)
 }
 
@@ -518,11 +700,14 @@ func (ss *serverSession) getQorTC() (tbl string, hdr *Header, row Row) {
 	dir := ss.getDir()
 	t, _ := ss.getTran()
 	if t == nil {
-		q := ss.getQuery()
+		q, qn := ss.getQuery()
+		ss.slowQuery, ss.slowQc = ss.queryText[qn], q
+		ss.curTran = ss.queryTrans[qn]
 		hdr = q.Header()
 		row, tbl = q.Get(ss.thread, dir)
 	} else {
-		c := ss.getCursor()
+		c, qn := ss.getCursor()
+		ss.slowQuery, ss.slowQc = ss.queryText[qn], c
 		hdr = c.Header()
 		row, tbl = c.Get(ss.thread, t, dir)
 	}
@@ -611,6 +796,10 @@ func cmdGetOne(ss *serverSession) {
 	}
 	tran, _ := ss.getTran()
 	query := ss.GetStr()
+	if ss.sc.perms != nil {
+		ss.sc.perms.query(query, &ss.sc.Sviews)
+	}
+	ss.slowQuery = query
 	var g func(*Thread, string, Dir) (Row, *Header, string)
 	if tran == nil {
 		g = ss.sc.dbms.Get
@@ -654,6 +843,7 @@ func cmdKeys(ss *serverSession) {
 
 func cmdKill(ss *serverSession) {
 	sessionId := ss.GetStr()
+	ss.auditArgs = sessionId
 	n := kill(sessionId)
 	ss.PutBool(true).PutInt(n)
 }
@@ -703,6 +893,13 @@ func cmdLog(ss *serverSession) {
 	ss.PutBool(true)
 }
 
+func cmdMaintenance(ss *serverSession) {
+	on := ss.GetBool()
+	ss.auditArgs = strconv.FormatBool(on)
+	ss.sc.dbms.Maintenance(on)
+	ss.PutBool(true)
+}
+
 func cmdNonce(ss *serverSession) {
 	ss.nonce = Nonce()
 	ss.PutBool(true).PutStr_(ss.nonce)
@@ -714,36 +911,52 @@ func cmdOrder(ss *serverSession) {
 }
 
 func cmdOutput(ss *serverSession) {
-	q := ss.getQuery()
+	q, qn := ss.getQuery()
 	rec := ss.GetRec()
+	if ss.sc.perms != nil {
+		uq, ok := q.(interface{ Updateable() string })
+		if !ok {
+			panic(ss.sc.perms.denied("output to " + ss.queryText[qn]))
+		}
+		ss.sc.perms.check(writeAccess, uq.Updateable())
+	}
+	ss.slowQuery = ss.queryText[qn]
+	ss.curTran = ss.queryTrans[qn]
 	q.Output(ss.thread, rec)
+	ss.written = 1
 	ss.PutBool(true)
 }
 
-func (ss *serverSession) getQuery() IQuery {
+func (ss *serverSession) getQuery() (IQuery, int) {
 	qn := ss.GetInt()
 	q := ss.queries[qn]
 	if q == nil {
 		ss.error("dbms server: query not found")
 	}
-	return q
+	return q, qn
 }
 
-func (ss *serverSession) getCursor() ICursor {
+func (ss *serverSession) getCursor() (ICursor, int) {
 	qn := ss.GetInt()
 	c := ss.cursors[qn]
 	if c == nil {
 		ss.error("dbms server: query not found")
 	}
-	return c
+	return c, qn
 }
 
 func cmdQuery(ss *serverSession) {
 	tran, tn := ss.getTran()
 	query := ss.GetStr()
+	if ss.sc.perms != nil {
+		ss.sc.perms.query(query, &ss.sc.Sviews)
+	}
+	ss.slowQuery = query
 	q := tran.Query(query, &ss.sc.Sviews)
+	ss.slowQc = q
 	qn := int(lastNum.Add(1))
 	ss.queries[qn] = q
+	ss.queryText[qn] = query
 	ss.queryTrans[qn] = tn
 	if ss.tranQueries[tn] == nil {
 		ss.tranQueries[tn] = make(intSet)
@@ -760,6 +973,29 @@ func cmdReadCount(ss *serverSession) {
 	ss.PutBool(true).PutInt(0) //TODO
 }
 
+// cmdReplicate sends the next piece of the database to a standby.
+// It sends the raw database so if there are users
+// it is only allowed for the replication user.
+func cmdReplicate(ss *serverSession) {
+	dbms, ok := ss.sc.dbms.(*DbmsLocal)
+	if !ok || (dbms.db.HaveUsers() && ss.sc.user != replicationUser) {
+		panic(notauth)
+	}
+	from := uint64(ss.GetInt64())
+	stateEnd := uint64(ss.GetInt64())
+	ck := uint32(ss.GetInt64())
+	asof := ss.GetInt64()
+	data, end, primaryAsof, err :=
+		dbms.db.ReplicaData(from, stateEnd, ck, replicateMax)
+	if err != nil {
+		panic(err.Error())
+	}
+	ss.sc.lag.Store(&replicaLag{bytes: end - stateEnd,
+		ms: max(0, primaryAsof-asof)})
+	ss.PutBool(true).PutInt64(int64(end)).PutInt64(primaryAsof).
+		PutStr_(hacks.BStoS(data))
+}
+
 func cmdRewind(ss *serverSession) {
 	qc := ss.getQorC()
 	qc.Rewind()
@@ -768,7 +1004,8 @@ func cmdRewind(ss *serverSession) {
 
 func cmdRun(ss *serverSession) {
 	s := ss.GetStr()
-	v := ss.sc.dbms.Run(ss.thread, s)
+	ss.auditArgs = s
+	v := ss.sc.dbms.Run(ss.unrestricted(), s)
 	ss.PutResult(v)
 }
 
@@ -798,15 +1035,23 @@ func cmdTimestamp(ss *serverSession) {
 }
 
 func cmdToken(ss *serverSession) {
-	tok := Token()
+	tok := TokenFor(ss.sc.user)
 	ss.PutBool(true).PutStr(tok)
 }
 
 func cmdTransaction(ss *serverSession) {
 	update := ss.GetBool()
+	if draining.Load() {
+		panic("server is shutting down")
+	}
+	if lim := ss.sc.limits.Load(); lim != nil {
+		ss.sc.checkTrans(lim)
+	}
 	tran := ss.sc.dbms.Transaction(update)
 	tn := tran.Num()
 	ss.trans[tn] = tran
+	ss.addTranStats(tn, tran, update)
+	ss.sc.ntrans.Add(1)
 	ss.PutBool(true).PutInt(tn)
 }
 
@@ -820,7 +1065,11 @@ func cmdUpdate(ss *serverSession) {
 	table := ss.GetStr()
 	off := uint64(ss.GetInt64())
 	rec := ss.GetRec()
+	if ss.sc.perms != nil {
+		ss.sc.perms.check(writeAccess, table)
+	}
 	newoff := tran.Update(ss.thread, table, off, rec)
+	ss.written = 1
 	ss.PutBool(true).PutInt(int(newoff))
 }
 
@@ -872,10 +1121,16 @@ var cmds = []command{ // order must match commmands.go
 	cmdWriteCount,
 	cmdEndSession,
 	cmdAsof,
+	cmdBackup,
+	cmdReplicate,
+	cmdChanges,
+	cmdDrain,
+	cmdMaintenance,
 	nil,
 }
 
 func init() {
 	assert.Msg("dbmsserver cmds").
-		That(cmds[commands.Asof] != nil && cmds[commands.Asof+1] == nil)
+		That(cmds[commands.Maintenance] != nil &&
+			cmds[commands.Maintenance+1] == nil)
 }
@@ -27,6 +27,14 @@ func (du *DbmsUnauth) Auth(th *Thread, data string) bool {
 	return du.dbms.Auth(th, data)
 }
 
+func (du *DbmsUnauth) Backup(string, string) uint64 {
+	panic(notauth)
+}
+
+func (du *DbmsUnauth) Changes([]string, int64) (*SuObject, int64) {
+	panic(notauth)
+}
+
 func (du *DbmsUnauth) Check() string {
 	panic(notauth)
 }
@@ -51,6 +59,10 @@ func (du *DbmsUnauth) DisableTrigger(string) {
 	panic(notauth)
 }
 
+func (du *DbmsUnauth) Drain(int) {
+	panic(notauth)
+}
+
 func (du *DbmsUnauth) EnableTrigger(string) {
 	panic(notauth)
 }
@@ -79,6 +91,10 @@ func (du *DbmsUnauth) Kill(string) int {
 	panic(notauth)
 }
 
+func (du *DbmsUnauth) Maintenance(bool) {
+	panic(notauth)
+}
+
 func (du *DbmsUnauth) LibGet(name string) []string {
 	return du.dbms.LibGet(name)
 }
@@ -0,0 +1,114 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/exit"
+)
+
+// Draining is used to shut down the server cleanly e.g. for an upgrade.
+// While draining, new connections and new transactions are rejected.
+// Once the outstanding transactions finish (or the timeout expires)
+// the server exits normally, which persists and closes the database.
+// Connected sessions can see that the server is shutting down,
+// and by when, from Database.Info() mode and shutdown
+// so they can warn their users.
+//
+// Maintenance mode only allows admin connections.
+// An admin connection is one that is authorized and not restricted
+// by permissions (see perms.go).
+// If the database has no users, all connections are admin.
+
+var draining, maintenance atomic.Bool
+
+// drainDeadline is when a drain will shut down the server (unix milli)
+var drainDeadline atomic.Int64
+
+// DefaultDrainTimeout is the timeout (seconds) for a signal or http drain
+const DefaultDrainTimeout = 60
+
+// drainExit is a variable so tests can override it
+var drainExit = func() { exit.Exit(0) }
+
+// ServerMode returns "draining", "maintenance", or ""
+func ServerMode() string {
+	switch {
+	case draining.Load():
+		return "draining"
+	case maintenance.Load():
+		return "maintenance"
+	}
+	return ""
+}
+
+func (dbms *DbmsLocal) Drain(timeout int) {
+	if options.Action != "server" {
+		panic("Drain: only allowed on the server")
+	}
+	if !draining.CompareAndSwap(false, true) {
+		return // already draining
+	}
+	log.Println("dbms server: draining, timeout", timeout, "seconds")
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	drainDeadline.Store(deadline.UnixMilli())
+	go func() {
+		for {
+			n := dbms.Transactions().Size()
+			if n == 0 {
+				log.Println("dbms server: drained")
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Println("WARNING: dbms server: drain timeout with",
+					n, "outstanding transactions")
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		drainExit()
+	}()
+}
+
+func (*DbmsLocal) Maintenance(on bool) {
+	if maintenance.Swap(on) != on {
+		if on {
+			log.Println("dbms server: maintenance mode on")
+		} else {
+			log.Println("dbms server: maintenance mode off")
+		}
+	}
+}
+
+// maintenanceCmds are the commands allowed for non-admin connections
+// in maintenance mode, so they can still authorize as an admin
+var maintenanceCmds = map[commands.Command]bool{
+	commands.Auth:       true,
+	commands.EndSession: true,
+	commands.Log:        true,
+	commands.Nonce:      true,
+	commands.SessionId:  true,
+}
+
+// checkMaintenance is called by serverSession.command
+func (sc *serverConn) checkMaintenance(icmd commands.Command) {
+	if !maintenance.Load() || maintenanceCmds[icmd] {
+		return
+	}
+	if _, ok := sc.dbms.(*DbmsLocal); !ok || sc.perms != nil {
+		panic("server is in maintenance mode")
+	}
+}
+
+// unavailable is sent instead of hello() to reject new connections
+func unavailable(reason string) []byte {
+	var buf [helloSize]byte
+	copy(buf[:], "Suneido unavailable: "+reason+"\r\n")
+	return buf[:]
+}
@@ -0,0 +1,101 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestDrain(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db19.StartConcur(db, time.Minute) // Drain polls from another goroutine
+	defer db.Close()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	admin := func(s string) { qry.DoAdmin(db, s, nil) }
+	action := func(s string) {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, s)
+		ut.Commit()
+	}
+	admin("create users (user, passhash) key(user)")
+	action("insert { user: 'admin', passhash: 'x' } into users")
+	action("insert { user: 'bob', passhash: 'x' } into users")
+	admin("create roles (user, role) key(user, role)")
+	action("insert { user: 'bob', role: 'clerk' } into roles")
+	admin("create permissions (role, name, access) key(role, name)")
+	action("insert { role: 'clerk', name: '*', access: 'write' } into permissions")
+	db.Persist() // wait for the merges
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+
+	workers = mux.NewWorkers(doRequest)
+	pipe := func() net.Conn {
+		p1, p2 := net.Pipe()
+		go newServerConn(dbms, p1)
+		return p2
+	}
+	connect := func(user string) *muxSession {
+		p := pipe()
+		assert.This(checkHello(p)).Is("")
+		p.Write(hello())
+		ms := NewDbmsClient(p).NewSession()
+		assert.T(t).That(ms.Auth(th, TokenFor(user)))
+		return ms
+	}
+
+	// maintenance
+	ad := connect("admin")
+	bob := connect("bob")
+	ad.Maintenance(true)
+	assert.T(t).This(dbms.Info().Get(th, SuStr("mode"))).Is(SuStr("maintenance"))
+	assert.T(t).This(func() { bob.Transaction(false) }).
+		Panics("server is in maintenance mode")
+	ad.Transaction(false).Complete()
+	ad.Maintenance(false)
+	bob.Transaction(false).Complete()
+
+	// drain
+	defer func(action string) { options.Action = action }(options.Action)
+	defer draining.Store(false)
+	exited := make(chan bool, 1)
+	drainExit = func() { exited <- true }
+	assert.T(t).This(func() { ad.Drain(10) }).
+		Panics("only allowed on the server")
+	options.Action = "server"
+	tran := bob.Transaction(true)
+	ad.Drain(10)
+	assert.T(t).This(ServerMode()).Is("draining")
+	// existing sessions can see the shutdown
+	info := bob.Info()
+	assert.T(t).This(info.Get(th, SuStr("mode"))).Is(SuStr("draining"))
+	shutdown := info.Get(th, SuStr("shutdown")).(SuDate)
+	assert.T(t).That(shutdown.MinusMs(Now()) > 9000)
+	assert.T(t).This(func() { ad.Transaction(false) }).
+		Panics("server is shutting down")
+	assert.T(t).This(checkHello(pipe())).Is("server unavailable: shutting down")
+	select {
+	case <-exited:
+		t.Fatal("drain exited with outstanding transaction")
+	case <-time.After(300 * time.Millisecond):
+	}
+	tran.Complete()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not exit")
+	}
+}
@@ -49,6 +49,9 @@ func checkHello(conn net.Conn) string {
 		return "hello: invalid response"
 	}
 	s = strings.TrimPrefix(s, "Suneido ")
+	if strings.HasPrefix(s, "unavailable: ") {
+		return "server " + strings.TrimRight(s, "\r\n\x00")
+	}
 	if noTime(s) != noTime(options.BuiltDate) && !options.IgnoreVersion {
 		return fmt.Sprintf("version mismatch (got %s, want %s)",
 			noTime(s), noTime(options.BuiltDate))
@@ -0,0 +1,99 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+// Limits restrict the resources used by client connections.
+// They are stored in the limits table:
+//
+//	limits (user, name, value) key(user, name)
+//
+// user "*" applies to all connections, a specific user overrides it.
+// name is one of:
+//   - timeout - the maximum seconds to execute a single request
+//   - rows - the maximum rows read from tables by a single request
+//   - tempindex - the maximum megabytes of temp index data for a request
+//   - transactions - the maximum concurrent transactions per connection
+//
+// Exceeding a limit aborts the request with an error.
+// If the limits table does not exist, there are no limits.
+// Limits are loaded when a connection is made and when it is authorized.
+
+type limits struct {
+	timeout      time.Duration
+	rows         int
+	tempIndex    int // bytes
+	transactions int
+}
+
+// loadLimits returns the limits for a user (or "" for all connections),
+// or nil if there are no limits
+func loadLimits(dbms *DbmsLocal, user string) *limits {
+	if dbms.db.GetState().Meta.GetRoInfo("limits") == nil {
+		return nil
+	}
+	query := "limits where user in ('*', " + SuStr(user).String() + ")"
+	rows := dbms.rows(query, "user", "name", "value")
+	if len(rows) == 0 {
+		return nil
+	}
+	var lim limits
+	for _, pass := range []string{"*", user} { // user overrides "*"
+		for _, row := range rows {
+			if row[0] == pass {
+				lim.set(row[1], row[2])
+			}
+		}
+	}
+	return &lim
+}
+
+func (lim *limits) set(name, value string) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Println("ERROR: limits: invalid value for", name+":", value)
+		return
+	}
+	switch name {
+	case "timeout":
+		lim.timeout = time.Duration(n) * time.Second
+	case "rows":
+		lim.rows = n
+	case "tempindex":
+		lim.tempIndex = n * 1024 * 1024
+	case "transactions":
+		lim.transactions = n
+	default:
+		log.Println("ERROR: limits: unknown limit:", name)
+	}
+}
+
+// request returns the Limits for a single request.
+// lim may be nil, in which case there are no limits,
+// but rows read are still counted.
+func (lim *limits) request() *Limits {
+	if lim == nil {
+		return &Limits{}
+	}
+	rl := &Limits{MaxRows: lim.rows, MaxTempIndex: lim.tempIndex}
+	if lim.timeout > 0 {
+		rl.Deadline = time.Now().Add(lim.timeout)
+	}
+	return rl
+}
+
+// checkTrans is called by cmdTransaction
+func (sc *serverConn) checkTrans(lim *limits) {
+	if lim.transactions > 0 && int(sc.ntrans.Load()) >= lim.transactions {
+		panic("too many concurrent transactions (limit " +
+			strconv.Itoa(lim.transactions) + ")")
+	}
+}
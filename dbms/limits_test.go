@@ -0,0 +1,86 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestLimits(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	admin := func(s string) { qry.DoAdmin(db, s, nil) }
+	action := func(s string) {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, s)
+		db.CommitMerge(ut)
+	}
+	admin("create users (user, passhash) key(user)")
+	action("insert { user: 'admin', passhash: 'x' } into users")
+	admin("create tmp (a, b) key(a)")
+	for i := range 10 {
+		action("insert { a: " + IntVal(i).String() + " } into tmp")
+	}
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+
+	assert.T(t).This(loadLimits(dbms, "")).Is(nil)
+
+	admin("create limits (user, name, value) key(user, name)")
+	action("insert { user: '*', name: 'rows', value: 5 } into limits")
+	action("insert { user: '*', name: 'timeout', value: 60 } into limits")
+	action("insert { user: 'bob', name: 'rows', value: 20 } into limits")
+	action("insert { user: 'bob', name: 'transactions', value: 2 } into limits")
+	assert.T(t).This(*loadLimits(dbms, "")).
+		Is(limits{rows: 5, timeout: time.Minute})
+	assert.T(t).This(*loadLimits(dbms, "bob")).
+		Is(limits{rows: 20, timeout: time.Minute, transactions: 2})
+
+	// client-server
+	workers = mux.NewWorkers(doRequest)
+	connect := func() *muxSession {
+		p1, p2 := net.Pipe()
+		go newServerConn(dbms, p1)
+		assert.This(checkHello(p2)).Is("")
+		p2.Write(hello())
+		return NewDbmsClient(p2).NewSession()
+	}
+	ms := connect()
+	assert.T(t).That(ms.Auth(th, TokenFor("admin")))
+	row, _, _ := ms.Get(th, "tmp where a = 3", Only)
+	assert.T(t).That(row != nil)
+	assert.T(t).This(func() { ms.Get(th, "tmp where b = 3", Only) }).
+		Panics("query rows read limit exceeded (5)")
+	// point lookups are counted
+	assert.T(t).This(func() {
+		ms.Get(th, "tmp where a in (1, 2, 3, 4, 5, 6) summarize count", Only)
+	}).Panics("query rows read limit exceeded (5)")
+
+	ms = connect()
+	assert.T(t).That(ms.Auth(th, TokenFor("bob")))
+	row, _, _ = ms.Get(th, "tmp where b = 3", Only)
+	assert.T(t).That(row == nil)
+	t1 := ms.Transaction(false)
+	t2 := ms.Transaction(true)
+	assert.T(t).This(func() { ms.Transaction(false) }).
+		Panics("too many concurrent transactions (limit 2)")
+	t1.Complete()
+	t3 := ms.Transaction(false)
+	t2.Abort()
+	t3.Complete()
+}
@@ -0,0 +1,80 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	"github.com/apmckinlay/gsuneido/util/assert"
+	"github.com/apmckinlay/gsuneido/util/generic/atomics"
+)
+
+// cmdTimes are the server request counts, times, and latency histograms
+// for each command
+var cmdTimes = make([]latency, len(cmds))
+
+// LatencyBuckets are the upper bounds of the request latency histograms
+var LatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 5 * time.Second, 10 * time.Second}
+
+type latency struct {
+	atomics.Durations
+	// buckets are the counts for each of LatencyBuckets (not cumulative)
+	buckets [9]atomic.Int64
+}
+
+func (lat *latency) add(d time.Duration) {
+	lat.Durations.Add(d)
+	for i, le := range LatencyBuckets {
+		if d <= le {
+			lat.buckets[i].Add(1)
+			break
+		}
+	}
+}
+
+// CommandTimes calls fn with the request count, total time,
+// and cumulative counts for each of LatencyBuckets
+// for each command that the server has handled.
+// It is used for metrics.
+func CommandTimes(fn func(cmd string, count int64, total time.Duration,
+	buckets []int64)) {
+	for i := range cmdTimes {
+		lat := &cmdTimes[i]
+		if count, total := lat.Load(); count > 0 {
+			buckets := make([]int64, len(LatencyBuckets))
+			var sum int64
+			for j := range buckets {
+				sum += lat.buckets[j].Load()
+				buckets[j] = min(sum, count) // in case of concurrent add
+			}
+			fn(commands.Command(i).String(), count, total, buckets)
+		}
+	}
+}
+
+// ConnStats returns the number of server connections, sessions, and cursors.
+// It is used for metrics.
+func ConnStats() (conns, sessions, cursors int) {
+	serverConnsLock.Lock()
+	defer serverConnsLock.Unlock()
+	for _, sc := range serverConns {
+		conns++
+		sc.sessionsLock.Lock()
+		for _, ss := range sc.sessions {
+			sessions++
+			cursors += int(ss.ncursors.Load())
+		}
+		sc.sessionsLock.Unlock()
+	}
+	return
+}
+
+func init() {
+	assert.That(len(LatencyBuckets) == len(latency{}.buckets))
+}
@@ -0,0 +1,55 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	qry.DoAdmin(db, "create tmp (a) key(a)", nil)
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+	counts := func() map[string]int64 {
+		m := map[string]int64{}
+		CommandTimes(func(cmd string, count int64, total time.Duration,
+			buckets []int64) {
+			m[cmd] = count
+		})
+		return m
+	}
+	before := counts()
+
+	p1, p2 := net.Pipe()
+	workers = mux.NewWorkers(doRequest)
+	go newServerConn(dbms, p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := NewDbmsClient(p2).NewSession()
+	ms.Cursor("tmp", nil)
+	ms.Cursor("tmp", nil)
+	ms.Get(th, "tmp", Only)
+	after := counts()
+	assert.T(t).This(after["Cursor"] - before["Cursor"]).Is(2)
+	assert.T(t).This(after["GetOne"] - before["GetOne"]).Is(1)
+	conns, sessions, cursors := ConnStats()
+	assert.T(t).That(conns >= 1 && sessions >= 1)
+	assert.T(t).That(cursors >= 2)
+}
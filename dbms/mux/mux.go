@@ -39,6 +39,10 @@ type ClientConn struct {
 	conn
 	lock        sync.Mutex
 	nextSession atomic.Uint32 // the next session id
+	// recoverable means a lost connection panics in Request
+	// instead of being fatal
+	recoverable bool
+	closed      bool // set by lost, guarded by lock
 }
 
 type respch chan []byte
@@ -51,6 +55,18 @@ func NewClientConn(rw io.ReadWriteCloser) *ClientConn {
 	return &m
 }
 
+// NewRecoverableClientConn is like NewClientConn
+// except that a lost connection is not fatal,
+// instead outstanding and future Requests panic with "lost connection".
+// It is used by standby servers which reconnect to the primary
+// and by clients that reconnect to the server.
+func NewRecoverableClientConn(rw io.ReadWriteCloser) *ClientConn {
+	m := ClientConn{conn: conn{rw: rw}, rchs: make(map[uint32]respch),
+		recoverable: true}
+	go m.conn.reader(m.client)
+	return &m
+}
+
 type ServerConn struct {
 	conn
 	id uint32
@@ -91,10 +107,26 @@ func (cc *ClientConn) NewClientSession() *ClientSession {
 	wb := newWriteBuf(&cc.conn, sessionId)
 	cc.lock.Lock()
 	defer cc.lock.Unlock()
-	cc.rchs[sessionId] = rch
+	if cc.closed {
+		close(rch)
+	} else {
+		cc.rchs[sessionId] = rch
+	}
 	return &ClientSession{cc: cc, rch: rch, ReadWrite: ReadWrite{WriteBuf: *wb}}
 }
 
+// Lost returns true if the connection has been lost
+func (cc *ClientConn) Lost() bool {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.closed
+}
+
+// Lost returns true if the session's connection has been lost
+func (cs *ClientSession) Lost() bool {
+	return cs.cc.Lost()
+}
+
 func (cs *ClientSession) read() []byte {
 	return <-cs.rch
 }
@@ -105,6 +137,9 @@ func (cs *ClientSession) read() []byte {
 func (cs *ClientSession) Request() {
 	cs.EndMsg()
 	cs.ReadBuf.buf = cs.read()
+	if cs.ReadBuf.buf == nil { // closed by lost
+		panic("lost connection: " + cs.cc.err.Load())
+	}
 	if !cs.GetBool() {
 		err := cs.GetStr()
 		trace.ClientServer.Println(err)
@@ -196,11 +231,26 @@ func (c *conn) reader(handler func(uint32, []byte)) {
 func (cc *ClientConn) client(id uint32, data []byte) {
 	// need to send id for client to pipeline messages
 	if data == nil {
+		if cc.recoverable {
+			cc.lost()
+			return
+		}
 		core.Fatal("lost connection:", cc.err.Load())
 	}
 	cc.getrch(id) <- data
 }
 
+// lost closes all the response channels so reads return nil
+func (cc *ClientConn) lost() {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	for id, ch := range cc.rchs {
+		close(ch)
+		delete(cc.rchs, id)
+	}
+	cc.closed = true
+}
+
 func (cc *ClientConn) getrch(id uint32) respch {
 	cc.lock.Lock()
 	defer cc.lock.Unlock()
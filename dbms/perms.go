@@ -0,0 +1,305 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"strings"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+)
+
+// Permissions restrict what an authorized client connection can do.
+// They are stored in two tables:
+//
+//	roles (user, role) key(user, role)
+//	permissions (role, name, access) key(role, name)
+//
+// name is a table, "*" for all tables except the security tables
+// (users, roles, and permissions) which must be named explicitly,
+// or a command (Backup, Changes, Check, Drain, Exec, Kill, Maintenance,
+// Replicate, Run).
+// Table access is read, write (includes read), or admin (includes write).
+// Admin (create, alter, rename, drop) requires admin access to the table.
+// Command access is allow.
+//
+// If the roles table does not exist, or the user has no roles,
+// the user is not restricted.
+// Permissions are loaded when a connection is authorized.
+//
+// Permissions are checked on the requests from the client.
+// Code run on the server by a request, e.g. functions called by
+// where or extend expressions, uses permsDbms which checks the same
+// permissions. The exception is Exec and Run since permission for them
+// allows running any code on the server.
+
+type access byte
+
+const (
+	noAccess access = iota
+	readAccess
+	writeAccess
+	adminAccess
+)
+
+var accessNames = map[string]access{
+	"read": readAccess, "write": writeAccess, "admin": adminAccess}
+
+func (a access) String() string {
+	for s, x := range accessNames {
+		if x == a {
+			return s
+		}
+	}
+	return "no"
+}
+
+// restricted are the commands that require a command permission
+var restricted = map[commands.Command]bool{
+	commands.Backup:      true,
+	commands.Changes:     true,
+	commands.Check:       true,
+	commands.Drain:       true,
+	commands.Exec:        true,
+	commands.Kill:        true,
+	commands.Maintenance: true,
+	commands.Replicate:   true,
+	commands.Run:         true,
+}
+
+type perms struct {
+	dbms     *DbmsLocal
+	user     string
+	tables   map[string]access
+	commands map[string]bool
+	// thread is the dbms for code run on the server by requests
+	thread *permsDbms
+}
+
+// loadPerms returns the permissions for a user,
+// or nil if the user is not restricted
+func loadPerms(dbms *DbmsLocal, user string) *perms {
+	if user == "" || dbms.db.GetState().Meta.GetRoInfo("roles") == nil {
+		return nil
+	}
+	p := &perms{dbms: dbms, user: user,
+		tables: make(map[string]access), commands: make(map[string]bool)}
+	p.thread = &permsDbms{DbmsLocal: dbms, p: p}
+	roles := dbms.rows("roles where user = "+SuStr(user).String(), "role")
+	if len(roles) == 0 {
+		return nil
+	}
+	if dbms.db.GetState().Meta.GetRoInfo("permissions") == nil {
+		return p // no permissions
+	}
+	for _, role := range roles {
+		rows := dbms.rows("permissions where role = "+SuStr(role[0]).String(),
+			"name", "access")
+		for _, row := range rows {
+			name, acc := row[0], strings.ToLower(row[1])
+			if acc == "allow" {
+				p.commands[name] = true
+			} else if a := accessNames[acc]; a > p.tables[name] {
+				p.tables[name] = a
+			}
+		}
+	}
+	return p
+}
+
+func (p *perms) command(cmd commands.Command) {
+	if restricted[cmd] && !p.commands[cmd.String()] {
+		panic(p.denied(cmd.String()))
+	}
+}
+
+// securityTables are not included in "*"
+// because access to them would allow getting around the permissions
+var securityTables = map[string]bool{
+	"users": true, "roles": true, "permissions": true}
+
+func (p *perms) access(table string) access {
+	if securityTables[table] {
+		return p.tables[table]
+	}
+	return max(p.tables[table], p.tables["*"])
+}
+
+func (p *perms) check(need access, tables ...string) {
+	for _, table := range tables {
+		if p.access(table) < need {
+			panic(p.denied(need.String() + " " + table))
+		}
+	}
+}
+
+func (p *perms) denied(what string) string {
+	return "permission denied: " + p.user + " can't " + what
+}
+
+func (p *perms) query(query string, sv *Sviews) {
+	tran := p.dbms.db.NewReadTran()
+	p.check(readAccess, qry.QueryTables(query, tran, sv)...)
+}
+
+func (p *perms) action(action string, sv *Sviews) {
+	tran := p.dbms.db.NewReadTran()
+	read, write := qry.ActionTables(action, tran, sv)
+	p.check(readAccess, read...)
+	p.check(writeAccess, write...)
+}
+
+func (p *perms) admin(admin string) {
+	p.check(adminAccess, qry.AdminTables(admin)...)
+}
+
+//-------------------------------------------------------------------
+
+// permsDbms is the dbms for code run on the server
+// by the requests from a restricted connection.
+// It checks the same permissions as the client requests.
+type permsDbms struct {
+	*DbmsLocal
+	p *perms
+}
+
+var _ IDbms = (*permsDbms)(nil)
+
+func (pd *permsDbms) Admin(admin string, sv *Sviews) {
+	pd.p.admin(admin)
+	pd.DbmsLocal.Admin(admin, sv)
+}
+
+func (pd *permsDbms) Backup(to, base string) uint64 {
+	pd.p.command(commands.Backup)
+	return pd.DbmsLocal.Backup(to, base)
+}
+
+func (pd *permsDbms) Changes(tables []string, from int64) (*SuObject, int64) {
+	pd.p.command(commands.Changes)
+	return pd.DbmsLocal.Changes(tables, from)
+}
+
+func (pd *permsDbms) Check() string {
+	pd.p.command(commands.Check)
+	return pd.DbmsLocal.Check()
+}
+
+func (pd *permsDbms) Cursor(query string, sv *Sviews) ICursor {
+	pd.p.query(query, sv)
+	return pd.DbmsLocal.Cursor(query, sv)
+}
+
+func (pd *permsDbms) DisableTrigger(table string) {
+	pd.p.check(adminAccess, table)
+	pd.DbmsLocal.DisableTrigger(table)
+}
+
+func (pd *permsDbms) Drain(timeout int) {
+	pd.p.command(commands.Drain)
+	pd.DbmsLocal.Drain(timeout)
+}
+
+func (pd *permsDbms) EnableTrigger(table string) {
+	pd.p.check(adminAccess, table)
+	pd.DbmsLocal.EnableTrigger(table)
+}
+
+// Exec runs the code with the unrestricted dbms, like the Exec command
+func (pd *permsDbms) Exec(th *Thread, args Value) Value {
+	pd.p.command(commands.Exec)
+	th.SetDbms(pd.DbmsLocal)
+	defer th.SetDbms(pd)
+	return pd.DbmsLocal.Exec(th, args)
+}
+
+func (pd *permsDbms) Get(th *Thread, query string, dir Dir) (Row, *Header, string) {
+	pd.p.query(query, th.Sviews())
+	return pd.DbmsLocal.Get(th, query, dir)
+}
+
+func (pd *permsDbms) Kill(sessionId string) int {
+	pd.p.command(commands.Kill)
+	return pd.DbmsLocal.Kill(sessionId)
+}
+
+func (pd *permsDbms) Maintenance(on bool) {
+	pd.p.command(commands.Maintenance)
+	pd.DbmsLocal.Maintenance(on)
+}
+
+// Run runs the code with the unrestricted dbms, like the Run command
+func (pd *permsDbms) Run(th *Thread, code string) Value {
+	pd.p.command(commands.Run)
+	th.SetDbms(pd.DbmsLocal)
+	defer th.SetDbms(pd)
+	return pd.DbmsLocal.Run(th, code)
+}
+
+func (pd *permsDbms) Transaction(update bool) ITran {
+	return permsTran{ITran: pd.DbmsLocal.Transaction(update), p: pd.p}
+}
+
+// Unuse is denied because the libraries in use are global
+func (pd *permsDbms) Unuse(lib string) bool {
+	panic(pd.p.denied("Unuse " + lib))
+}
+
+// Use is denied because the libraries in use are global
+func (pd *permsDbms) Use(lib string) bool {
+	panic(pd.p.denied("Use " + lib))
+}
+
+func (pd *permsDbms) Unwrap() IDbms {
+	return pd
+}
+
+// permsTran is a transaction from permsDbms
+type permsTran struct {
+	ITran
+	p *perms
+}
+
+func (pt permsTran) Action(th *Thread, action string) Value {
+	pt.p.action(action, th.Sviews())
+	return pt.ITran.Action(th, action)
+}
+
+func (pt permsTran) Delete(th *Thread, table string, off uint64) {
+	pt.p.check(writeAccess, table)
+	pt.ITran.Delete(th, table, off)
+}
+
+func (pt permsTran) Get(th *Thread, query string, dir Dir) (Row, *Header, string) {
+	pt.p.query(query, th.Sviews())
+	return pt.ITran.Get(th, query, dir)
+}
+
+func (pt permsTran) Query(query string, sv *Sviews) IQuery {
+	pt.p.query(query, sv)
+	return permsQuery{IQuery: pt.ITran.Query(query, sv), p: pt.p, query: query}
+}
+
+func (pt permsTran) Update(th *Thread, table string, off uint64,
+	rec Record) uint64 {
+	pt.p.check(writeAccess, table)
+	return pt.ITran.Update(th, table, off, rec)
+}
+
+// permsQuery is a query from a permsTran
+type permsQuery struct {
+	IQuery
+	p     *perms
+	query string
+}
+
+func (pq permsQuery) Output(th *Thread, rec Record) {
+	uq, ok := pq.IQuery.(interface{ Updateable() string })
+	if !ok {
+		panic(pq.p.denied("output to " + pq.query))
+	}
+	pq.p.check(writeAccess, uq.Updateable())
+	pq.IQuery.Output(th, rec)
+}
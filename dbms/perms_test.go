@@ -0,0 +1,155 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestPerms(t *testing.T) {
+	options.BuiltDate = "Dec 29 2020 12:34"
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	db19.MakeSuTran = func(ut *db19.UpdateTran) *SuTran {
+		return NewSuTran(nil, true)
+	}
+	admin := func(s string) { qry.DoAdmin(db, s, nil) }
+	action := func(s string) {
+		ut := db.NewUpdateTran()
+		qry.DoAction(nil, ut, s)
+		db.CommitMerge(ut)
+	}
+	admin("create users (user, passhash) key(user)")
+	action("insert { user: 'admin', passhash: 'x' } into users")
+	admin("create public (a) key(a)")
+	admin("create secret (a) key(a)")
+	admin("create scratch (a) key(a)")
+	action("insert { a: 1 } into public")
+	action("insert { a: 1 } into secret")
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+
+	// no roles table means no restrictions
+	assert.T(t).This(loadPerms(dbms, "bob")).Is(nil)
+
+	admin("create roles (user, role) key(user, role)")
+	admin("create permissions (role, name, access) key(role, name)")
+	action("insert { user: 'bob', role: 'report' } into roles")
+	action("insert { user: 'bob', role: 'scratch' } into roles")
+	action("insert { role: 'report', name: 'public', access: 'read' } " +
+		"into permissions")
+	action("insert { role: 'scratch', name: 'scratch', access: 'admin' } " +
+		"into permissions")
+	action("insert { role: 'everything', name: '*', access: 'write' } " +
+		"into permissions")
+	action("insert { user: 'carol', role: 'everything' } into roles")
+	action("insert { role: 'scratch', name: 'Kill', access: 'allow' } " +
+		"into permissions")
+
+	// no roles for the user means no restrictions
+	assert.T(t).This(loadPerms(dbms, "admin")).Is(nil)
+
+	p := loadPerms(dbms, "bob")
+	assert.T(t).This(p.access("public")).Is(readAccess)
+	assert.T(t).This(p.access("secret")).Is(noAccess)
+	assert.T(t).This(p.access("scratch")).Is(adminAccess)
+
+	// "*" does not include the security tables
+	p = loadPerms(dbms, "carol")
+	assert.T(t).This(p.access("secret")).Is(writeAccess)
+	assert.T(t).This(p.access("users")).Is(noAccess)
+	assert.T(t).This(p.access("roles")).Is(noAccess)
+	assert.T(t).This(p.access("permissions")).Is(noAccess)
+
+	// client-server
+	p1, p2 := net.Pipe()
+	workers = mux.NewWorkers(doRequest)
+	go newServerConn(dbms, p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms := NewDbmsClient(p2).NewSession()
+	assert.T(t).That(ms.Auth(th, TokenFor("bob")))
+	row, _, _ := ms.Get(th, "public", Only)
+	assert.T(t).That(row != nil)
+	denied := func(f func()) {
+		t.Helper()
+		assert.T(t).This(f).Panics("permission denied: bob can't")
+	}
+	denied(func() { ms.Get(th, "secret", Only) })
+	denied(func() { ms.Get(th, "public join secret", Only) })
+	denied(func() { ms.Cursor("secret", nil) })
+	denied(func() { ms.Exec(th, SuObjectOf(SuStr("Print"))) })
+	denied(func() { ms.Run(th, "123") })
+	denied(func() { ms.Admin("create public2 (a) key(a)", nil) })
+	denied(func() { ms.Admin("drop secret", nil) })
+	assert.T(t).This(ms.Kill("nonexistent")).Is(0)
+
+	tran := ms.Transaction(true)
+	denied(func() { tran.Query("secret", nil) })
+	denied(func() { tran.Action(th, "insert { a: 2 } into public") })
+	denied(func() { tran.Action(th, "insert secret into scratch") })
+	q := tran.Query("public", nil)
+	row, _ = q.Get(th, Next)
+	denied(func() { tran.Delete(th, "public", row[0].Off) })
+	denied(func() { q.Output(th, row[0].Record) })
+	tran.Abort()
+
+	// code run on the server by a request is also restricted
+	Global.TestDef("TestQueryFirst", &SuBuiltin{
+		Fn: func(th *Thread, args []Value) Value {
+			row, hdr, _ := th.Dbms().Get(th, ToStr(args[0]), Next)
+			return row.GetVal(hdr, "a", nil, nil)
+		},
+		BuiltinParams: BuiltinParams{ParamSpec: ParamSpec1}})
+	Global.TestDef("TestAdmin", &SuBuiltin{
+		Fn: func(th *Thread, args []Value) Value {
+			th.Dbms().Admin(ToStr(args[0]), nil)
+			return nil
+		},
+		BuiltinParams: BuiltinParams{ParamSpec: ParamSpec1}})
+	row, hdr, _ := ms.Get(th, "public extend x = TestQueryFirst('public')", Only)
+	assert.T(t).This(row.GetVal(hdr, "x", nil, nil)).Is(One)
+	denied(func() { ms.Get(th, "public extend x = TestQueryFirst('secret')", Only) })
+	denied(func() { ms.Get(th, "public where TestQueryFirst('secret') is 1", Only) })
+	denied(func() { ms.Get(th, "public extend x = TestAdmin('drop secret')", Only) })
+	tran = ms.Transaction(true)
+	denied(func() {
+		tran.Action(th, "insert (public where TestQueryFirst('secret') is 1) into scratch")
+	})
+	tran.Abort()
+
+	ms.Admin("alter scratch create (b)", nil)
+	tran = ms.Transaction(true)
+	assert.T(t).This(tran.Action(th, "insert { a: 2 } into scratch")).Is(IntVal(1))
+	assert.T(t).This(tran.Complete()).Is("")
+	ms.Admin("drop scratch", nil)
+
+	// a "*" reader can't query the security tables
+	p1, p2 = net.Pipe()
+	go newServerConn(dbms, p1)
+	assert.This(checkHello(p2)).Is("")
+	p2.Write(hello())
+	ms = NewDbmsClient(p2).NewSession()
+	assert.T(t).That(ms.Auth(th, TokenFor("carol")))
+	row, _, _ = ms.Get(th, "secret", Only)
+	assert.T(t).That(row != nil)
+	assert.T(t).This(func() { ms.Get(th, "users", Only) }).
+		Panics("permission denied: carol can't read users")
+	assert.T(t).This(func() { ms.Get(th, "secret times users", Only) }).
+		Panics("permission denied: carol can't read users")
+	tran = ms.Transaction(true)
+	assert.T(t).This(func() {
+		tran.Action(th, "insert { user: 'carol', role: 'admin' } into roles")
+	}).Panics("permission denied: carol can't write roles")
+	tran.Abort()
+}
@@ -9,13 +9,27 @@ import (
 	"github.com/apmckinlay/gsuneido/compile/ast"
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/util/generic/set"
 )
 
+// DoAction executes an action and returns the number of records affected
 func DoAction(th *Thread, ut *db19.UpdateTran, action string) int {
 	a := ParseAction(action, ut, th.Sviews())
 	return a.execute(th, ut)
 }
 
+// DoActionResult executes an action and returns its result.
+// This is the number of records affected,
+// except for upsert which returns #(inserted: n, updated: n)
+func DoActionResult(th *Thread, ut *db19.UpdateTran, action string) Value {
+	a := ParseAction(action, ut, th.Sviews())
+	n := a.execute(th, ut)
+	if ua, ok := a.(*upsertAction); ok {
+		return ua.result()
+	}
+	return IntVal(n)
+}
+
 //-------------------------------------------------------------------
 
 type insertRecordAction struct {
@@ -51,17 +65,14 @@ func (a *insertQueryAction) execute(th *Thread, ut *db19.UpdateTran) int {
 	qr, _, _ := Setup(a.query, ReadMode, ut)
 	hdr := qr.Header()
 	fields := ut.GetSchema(a.table).Columns
+	ckTsFields(fields)
 	n := 0
 	for row := qr.Get(th, Next); row != nil; row = qr.Get(th, Next) {
 		rb := RecordBuilder{}
-		var tsField string
 		for _, f := range fields {
 			if f == "-" || strings.HasSuffix(f, "_deps") {
 				rb.AddRaw("")
 			} else if strings.HasSuffix(f, "_TS") {
-				if tsField != "" {
-					panic("multiple _TS fields not supported")
-				}
 				rb.Add(th.Timestamp())
 			} else {
 				rb.AddRaw(row.GetRaw(hdr, f))
@@ -74,6 +85,154 @@ func (a *insertQueryAction) execute(th *Thread, ut *db19.UpdateTran) int {
 	return n
 }
 
+// ckTsFields panics if there is more than one _TS field
+func ckTsFields(fields []string) {
+	n := 0
+	for _, f := range fields {
+		if strings.HasSuffix(f, "_TS") {
+			n++
+		}
+	}
+	if n > 1 {
+		panic("multiple _TS fields not supported")
+	}
+}
+
+//-------------------------------------------------------------------
+
+// upsertAction inserts records that don't exist (by key)
+// and updates the ones that do.
+// Updates only change the fields that are supplied.
+type upsertAction struct {
+	record   *SuRecord
+	query    Query
+	table    string
+	key      []string
+	inserted int
+	updated  int
+}
+
+func (a *upsertAction) String() string {
+	s := "upsert "
+	if a.record != nil {
+		s += a.record.Show()
+	} else {
+		s += a.query.String()
+	}
+	s += " into " + a.table
+	if a.key != nil {
+		s += " key(" + strings.Join(a.key, ",") + ")"
+	}
+	return s
+}
+
+func (a *upsertAction) result() Value {
+	ob := &SuObject{}
+	ob.Set(SuStr("inserted"), IntVal(a.inserted))
+	ob.Set(SuStr("updated"), IntVal(a.updated))
+	return ob
+}
+
+func (a *upsertAction) execute(th *Thread, ut *db19.UpdateTran) int {
+	tbl, ok := NewTable(ut, a.table).(*Table)
+	if !ok {
+		panic("upsert: can't upsert into " + a.table)
+	}
+	key := a.getKey(tbl)
+	tbl.setIndex(key)
+	if a.record != nil {
+		a.upsertRecord(th, ut, tbl, key)
+	} else {
+		a.upsertQuery(th, ut, tbl, key)
+	}
+	return a.inserted + a.updated
+}
+
+// getKey returns the table index for the specified key,
+// or the table's key if it only has one
+func (a *upsertAction) getKey(tbl *Table) []string {
+	if a.key == nil {
+		if len(tbl.keys) != 1 {
+			panic("upsert: " + a.table + " has multiple keys, specify key(...)")
+		}
+		return tbl.keys[0]
+	}
+	for _, key := range tbl.allKeys {
+		if set.Equal(key, a.key) {
+			return key
+		}
+	}
+	panic("upsert: " + a.table + " does not have key(" +
+		strings.Join(a.key, ",") + ")")
+}
+
+func (a *upsertAction) upsertRecord(th *Thread, ut *db19.UpdateTran,
+	tbl *Table, key []string) {
+	hdr := tbl.Header()
+	rec := a.record.ToRecord(th, hdr)
+	row := Row{DbRec{Record: rec}}
+	vals := make([]string, len(key))
+	for i, col := range key {
+		vals[i] = row.GetRaw(hdr, col)
+	}
+	old := tbl.Lookup(th, key, vals)
+	if old == nil {
+		tbl.Output(th, rec)
+		a.inserted++
+		return
+	}
+	r := SuRecordFromRow(old, hdr, a.table, MakeSuTran(ut))
+	iter := a.record.Iter2(false, true)
+	for k, v := iter(); v != nil; k, v = iter() {
+		r.Put(th, k, v)
+	}
+	ut.Update(th, a.table, old[0].Off, r.ToRecord(th, hdr))
+	a.updated++
+}
+
+// NOTE: like insert query, doesn't execute rules or output _deps
+
+func (a *upsertAction) upsertQuery(th *Thread, ut *db19.UpdateTran,
+	tbl *Table, key []string) {
+	qr, _, _ := Setup(a.query, ReadMode, ut)
+	hdr := qr.Header()
+	for _, col := range key {
+		if !hdr.HasField(col) {
+			panic("upsert: query must include key column " + col)
+		}
+	}
+	tblHdr := tbl.Header()
+	fields := tbl.schema.Columns
+	ckTsFields(fields)
+	vals := make([]string, len(key))
+	for row := qr.Get(th, Next); row != nil; row = qr.Get(th, Next) {
+		for i, col := range key {
+			vals[i] = row.GetRaw(hdr, col)
+		}
+		old := tbl.Lookup(th, key, vals)
+		rb := RecordBuilder{}
+		for _, f := range fields {
+			if f == "-" || strings.HasSuffix(f, "_deps") {
+				rb.AddRaw("")
+			} else if strings.HasSuffix(f, "_TS") {
+				rb.Add(th.Timestamp())
+			} else if old == nil || hdr.HasField(f) {
+				rb.AddRaw(row.GetRaw(hdr, f))
+			} else {
+				rb.AddRaw(old.GetRaw(tblHdr, f))
+			}
+		}
+		rec := rb.Trim().Build()
+		if old == nil {
+			ut.Output(th, a.table, rec)
+			a.inserted++
+		} else {
+			ut.Update(th, a.table, old[0].Off, rec)
+			a.updated++
+		}
+	}
+}
+
 //-------------------------------------------------------------------
 
 type updateAction struct {
@@ -576,6 +576,36 @@ func TestQueryGet(t *testing.T) {
 		'saskatoon'	''	''	'a'	''	'axon'
 		'saskatoon'	''	''	'i'	''	'intercon'
 		'vancouver'	''	''	'e'	''	'emerald'`)
+	test("customer semijoin hist2",
+		"customer^(id) SEMIJOIN-LOOKUP by(id) hist2^(id)",
+		`city	id	name
+		'saskatoon'	'a'	'axon'
+		'vancouver'	'e'	'emerald'`)
+	test("customer antijoin hist2",
+		"customer^(id) ANTIJOIN-LOOKUP by(id) hist2^(id)",
+		`city	id	name
+		'calgary'	'c'	'calac'
+		'saskatoon'	'i'	'intercon'`)
+	test("customer semijoin (hist2 where item is 'pencil')",
+		"customer^(id) SEMIJOIN-LOOKUP by(id) "+
+			"(hist2^(id) WHERE item is 'pencil')",
+		`city	id	name
+		'vancouver'	'e'	'emerald'`)
+	test("inven outerjoin hist2",
+		"inven^(item) OUTERJOIN-MERGE 1:n by(item) (hist2^(date) TEMPINDEX(item))",
+		`cost	date	id	item	qty
+		''	''	''	'mouse'	2
+		100	970101	'a'	'disk'	5
+		200	970102	'e'	'disk'	5
+		300	970103	'e'	'pencil'	7`)
+	test("(inven where item is 'mouse') outerjoin hist2",
+		"inven^(item) WHERE*1 item is 'mouse' "+
+			"OUTERJOIN-MERGE 1:n by(item) (hist2^(date) TEMPINDEX(item))",
+		`cost	date	id	item	qty
+		''	''	''	'mouse'	2
+		100	970101	'a'	'disk'	''
+		200	970102	'e'	'disk'	''
+		300	970103	'e'	'pencil'	''`)
 
 	// where
 	test("customer where id > 'd'", // range
@@ -727,7 +757,102 @@ func TestQueryGet(t *testing.T) {
 		"hist^(date) SUMMARIZE-SEQ max cost",
 		`max_cost
 		300`)
+	test("hist summarize item, countdistinct date, median cost, stddev cost "+
+		"sort item",
+		"hist^(date) TEMPINDEX(item) SUMMARIZE-SEQ item, "+
+			"median cost, stddev cost, countdistinct date",
+		`countdistinct_date	item	median_cost	stddev_cost
+		1	'disk'	150	70.71067811865475
+		1	'mouse'	200	0
+		1	'pencil'	300	0`)
+	test("hist summarize percentile(25) cost, variance cost, "+
+		"concat(', ', sort) id",
+		"hist^(date) SUMMARIZE-SEQ percentile(25) cost, variance cost, "+
+			"concat(', ', sort) id",
+		`concat_id	percentile25_cost	variance_cost
+		'a, c, e, e'	175	6666.666666666666`)
+	test("hist summarize percentile(12.5) cost, percentile(75) cost",
+		"hist^(date) SUMMARIZE-SEQ percentile(12.5) cost, percentile(75) cost",
+		`percentile12_5_cost	percentile75_cost
+		137.5	225`)
 
+	// window
+	test("hist2 window sort date extend n = count(), a = average(cost), "+
+		"p = lag(item), l = lead(cost, 2)",
+		"hist2^(date) WINDOW sort date extend n = count(), "+
+			"a = average(cost), p = lag(item), l = lead(cost, 2)",
+		`a	cost	date	id	item	l	n	p
+		100	100	970101	'a'	'disk'	300	1	''
+		150	200	970102	'e'	'disk'	''	2	'disk'
+		200	300	970103	'e'	'pencil'	''	3	'disk'`)
+	test("hist window by item sort date, id "+
+		"extend t = total(cost), n = row_number()",
+		"hist^(date) TEMPINDEX(item,date,id) WINDOW by item sort date, id "+
+			"extend t = total(cost), n = row_number()",
+		`cost	date	id	item	n	t
+		100	970101	'a'	'disk'	1	100
+		200	970101	'e'	'disk'	2	300
+		200	970102	'c'	'mouse'	1	200
+		300	970103	'e'	'pencil'	1	300`)
+	test("hist window by item sort date extend r = rank(), d = dense_rank()",
+		"hist^(date) TEMPINDEX(item,date) WINDOW by item sort date "+
+			"extend r = rank(), d = dense_rank()",
+		`cost	d	date	id	item	r
+		100	1	970101	'a'	'disk'	1
+		200	1	970101	'e'	'disk'	1
+		200	1	970102	'c'	'mouse'	1
+		300	1	970103	'e'	'pencil'	1`)
+	test("hist window by id sort reverse date extend r = row_number(), "+
+		"m = min(cost) where id is 'e'",
+		"hist^(date) WHERE id is 'e' WINDOW by id sort reverse date "+
+			"extend r = row_number(), m = min(cost)",
+		`cost	date	id	item	m	r
+		200	970101	'e'	'disk'	200	2
+		300	970103	'e'	'pencil'	300	1`)
+	test("hist window by id sort reverse date extend r = row_number() "+
+		"where r is 1",
+		"hist^(date) TEMPINDEX(id,date) WINDOW by id sort reverse date "+
+			"extend r = row_number() WHERE r is 1",
+		`cost	date	id	item	r
+		100	970101	'a'	'disk'	1
+		200	970102	'c'	'mouse'	1
+		300	970103	'e'	'pencil'	1`)
+	test("inven leftjoin by(item) (hist window by id sort date "+
+		"extend n = row_number())",
+		"inven^(item) LEFTJOIN 1:n by(item) (hist^(date) TEMPINDEX(id,date) "+
+			"WINDOW by id sort date extend n = row_number() TEMPINDEX(item))",
+		`cost	date	id	item	n	qty
+		100	970101	'a'	'disk'	1	5
+		200	970101	'e'	'disk'	1	5
+		200	970102	'c'	'mouse'	1	2
+		300	970103	'e'	'pencil'	2	7`)
+	// limit
+	test("hist sort date limit 2",
+		"hist^(date) LIMIT 2",
+		`cost	date	id	item
+		100	970101	'a'	'disk'
+		200	970101	'e'	'disk'`)
+	test("hist sort reverse date limit 1 offset 1",
+		"hist^(date) reverse LIMIT 1 OFFSET 1",
+		`cost	date	id	item
+		200	970102	'c'	'mouse'`)
+	test("hist sort cost, id limit 2",
+		"hist^(date) TEMPINDEX(cost,id) TOP 2 LIMIT 2",
+		`cost	date	id	item
+		100	970101	'a'	'disk'
+		200	970102	'c'	'mouse'`)
+	test("hist sort reverse cost, id limit 1 offset 1",
+		"hist^(date) TEMPINDEX(cost,id) TOP 2 reverse LIMIT 1 OFFSET 1",
+		`cost	date	id	item
+		200	970101	'e'	'disk'`)
+	test("hist where item is 'disk' limit 5",
+		"hist^(date) WHERE item is 'disk' LIMIT 5",
+		`cost	date	id	item
+		100	970101	'a'	'disk'
+		200	970101	'e'	'disk'`)
+	test("hist sort date limit 0",
+		"NOTHING(hist)",
+		`cost	date	id	item`)
 	// tempindex
 	test("tables intersect columns",
 		"columns INTERSECT (tables TEMPINDEX(table))",
@@ -783,3 +908,33 @@ func TestQueryGet(t *testing.T) {
 		1	'a'
 		1	'c'`)
 }
+
+func TestWindowSelect(t *testing.T) {
+	MakeSuTran = func(qt QueryTran) *SuTran { return nil }
+	th := &Thread{}
+	db := testDb()
+	defer db.Close()
+	tran := db.NewReadTran()
+	q := ParseQuery("hist window by id sort date extend n = row_number()",
+		tran, nil)
+	q, _, _ = Setup(q, ReadMode, tran)
+	w := q.(*Window)
+	hdr := w.Header()
+	get := func(col, val string) []string {
+		t.Helper()
+		w.Select([]string{col}, []string{Pack(SuStr(val))})
+		var list []string
+		for row := w.Get(th, Next); row != nil; row = w.Get(th, Next) {
+			list = append(list, row.GetVal(hdr, "date", th, nil).String()+
+				":"+row.GetVal(hdr, "n", th, nil).String())
+		}
+		return list
+	}
+	// by column is passed to the source
+	assert.T(t).This(get("id", "e")).Is([]string{"970101:1", "970103:2"})
+	// other columns are filtered after the window is calculated
+	assert.T(t).This(get("item", "pencil")).Is([]string{"970103:2"})
+	w.Select(nil, nil)
+	row := w.Lookup(th, []string{"item"}, []string{Pack(SuStr("mouse"))})
+	assert.T(t).This(row.GetVal(hdr, "n", th, nil)).Is(One)
+}
@@ -24,6 +24,8 @@ import (
 		joinBase
 			Join - symmetric
 			LeftJoin - asymmetric
+			OuterJoin - symmetric (outerjoin.go)
+			SemiJoin - asymmetric (semijoin.go)
 */
 
 // joinLike is common stuff for Join, LeftJoin, and Times
@@ -33,7 +35,7 @@ type joinLike struct {
 	Query2
 }
 
-// joinBase is common stuff for Join and LeftJoin
+// joinBase is common stuff for Join, LeftJoin, OuterJoin, and SemiJoin
 type joinBase struct {
 	qt         QueryTran
 	st         *SuTran
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/util/assert"
 )
 
@@ -101,3 +102,60 @@ func setupIndex(q Query, mode Mode, index []string, tran QueryTran) Query {
 	q = SetApproach(q, index, float64(1), tran)
 	return q
 }
+
+func TestJoin_Merge(t *testing.T) {
+	db := heapDb()
+	defer db.Close()
+	db.adm("create lft (k, a) key(a) index(k)")
+	db.act("insert { k: 1, a: 'a1' } into lft")
+	db.act("insert { k: 2, a: 'a2' } into lft")
+	db.act("insert { k: 2, a: 'a3' } into lft")
+	db.act("insert { k: 4, a: 'a4' } into lft")
+	db.adm("create rgt (k, b) key(b) index(k)")
+	db.act("insert { k: 2, b: 'b1' } into rgt")
+	db.act("insert { k: 2, b: 'b2' } into rgt")
+	db.act("insert { k: 3, b: 'b3' } into rgt")
+	db.act("insert { k: 5, b: 'b5' } into rgt")
+	th := &Thread{}
+	test := func(query, strategy, expected string) (Query, []string) {
+		t.Helper()
+		tran := db.NewReadTran()
+		q := ParseQuery(query, tran, nil)
+		q, _, _ = Setup(q, ReadMode, tran)
+		assert.T(t).That(strings.Contains(q.String(), strategy))
+		assert.T(t).This(queryAll2(q)).Is(expected)
+		hdr := q.Header()
+		var rows []string
+		q.Rewind()
+		for row := q.Get(th, Next); row != nil; row = q.Get(th, Next) {
+			rows = append(rows, row2str(hdr, row))
+		}
+		// reverse after each row
+		for i := range rows {
+			q.Rewind()
+			for range i + 1 {
+				q.Get(th, Next)
+			}
+			prev := "nil"
+			if i > 0 {
+				prev = rows[i-1]
+			}
+			assert.T(t).This(row2str(hdr, q.Get(th, Prev))).Is(prev)
+			if i > 0 {
+				assert.T(t).This(row2str(hdr, q.Get(th, Next))).Is(rows[i])
+			}
+		}
+		return q, rows
+	}
+	q, rows := test("lft outerjoin rgt", "OUTERJOIN-MERGE",
+		"k=1 a=a1 | k=2 a=a2 b=b1 | k=2 a=a2 b=b2 | k=2 a=a3 b=b1 | "+
+			"k=2 a=a3 b=b2 | k=3 b=b3 | k=4 a=a4 | k=5 b=b5")
+	// reverse after eof
+	assert.T(t).This(q.Get(th, Next)).Is(nil)
+	assert.T(t).This(row2str(q.Header(), q.Get(th, Prev))).
+		Is(rows[len(rows)-1])
+	test("lft semijoin rgt", "SEMIJOIN-MERGE",
+		"k=2 a=a2 | k=2 a=a3")
+	test("lft antijoin rgt", "ANTIJOIN-MERGE",
+		"k=1 a=a1 | k=4 a=a4")
+}
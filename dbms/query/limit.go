@@ -0,0 +1,239 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"strconv"
+
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+// Limit returns at most limit rows after skipping offset rows.
+// It is parsed after sort e.g. sort date limit 50 offset 100
+//
+// Optimize passes a reduced frac to the source
+// so plans that read in order (e.g. an index) are favored over temp indexes.
+// If Sort does end up with a TempIndex, it only keeps offset + limit rows.
+//
+// The rows are buffered so they can be read in either direction.
+// Select filters the limited rows (rather than the source)
+// so it does not change which rows are included.
+type Limit struct {
+	Query1
+	limit   int
+	offset  int
+	rows    []Row // the rows read so far, up to limit
+	pos     int
+	skipped bool // the offset rows have been skipped
+	eof     bool // no more rows to read from the source
+	rewound bool
+	selCols []string
+	selVals []string
+}
+
+func NewLimit(src Query, limit, offset int) *Limit {
+	if limit < 0 {
+		panic("limit: must not be negative")
+	}
+	if offset < 0 {
+		panic("limit: offset must not be negative")
+	}
+	lim := &Limit{limit: limit, offset: offset}
+	lim.source = src
+	lim.header = src.Header()
+	lim.keys = src.Keys()
+	lim.fixed = src.Fixed()
+	lim.setNrows(lim.getNrows())
+	lim.rowSiz.Set(src.rowSize())
+	lim.fast1.Set(src.fastSingle())
+	lim.singleTbl.Set(src.SingleTable())
+	return lim
+}
+
+func (lim *Limit) getNrows() (int, int) {
+	nr, pop := lim.source.Nrows()
+	return max(0, min(lim.limit, nr-lim.offset)), pop
+}
+
+func (lim *Limit) String() string {
+	return lim.source.String() + " " + lim.stringOp()
+}
+
+func (lim *Limit) stringOp() string {
+	s := "LIMIT " + strconv.Itoa(lim.limit)
+	if lim.offset > 0 {
+		s += " OFFSET " + strconv.Itoa(lim.offset)
+	}
+	return s
+}
+
+func (lim *Limit) format() string {
+	s := "limit " + strconv.Itoa(lim.limit)
+	if lim.offset > 0 {
+		s += " offset " + strconv.Itoa(lim.offset)
+	}
+	return s
+}
+
+// Order returns the order of the source (Sort)
+func (lim *Limit) Order() []string {
+	return lim.source.Order()
+}
+
+func (lim *Limit) Updateable() string {
+	return lim.source.Updateable()
+}
+
+func (*Limit) Output(*Thread, Record) {
+	panic("can't output to this query")
+}
+
+func (lim *Limit) Transform() Query {
+	src := lim.source.Transform()
+	if _, ok := src.(*Nothing); ok {
+		return src
+	}
+	if lim.limit == 0 {
+		return NewNothing(lim)
+	}
+	if src != lim.source {
+		return NewLimit(src, lim.limit, lim.offset)
+	}
+	return lim
+}
+
+func (lim *Limit) optimize(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	if index != nil {
+		return impossible, impossible, nil
+	}
+	fixcost, varcost := Optimize(lim.source, mode, nil, lim.srcFrac(frac))
+	return fixcost, varcost, nil
+}
+
+// srcFrac returns the fraction of the source that will be read
+func (lim *Limit) srcFrac(frac float64) float64 {
+	nrows, _ := lim.source.Nrows()
+	if nrows <= 0 {
+		return frac
+	}
+	n := float64(lim.offset) + frac*float64(lim.limit)
+	return min(frac, n/float64(nrows))
+}
+
+func (lim *Limit) setApproach(_ []string, frac float64, _ any, tran QueryTran) {
+	lim.source = SetApproach(lim.source, nil, lim.srcFrac(frac), tran)
+	lim.header = lim.source.Header()
+	// let a sort temp index keep only the rows we need
+	q := lim.source
+	reverse := false
+	if sort, ok := q.(*Sort); ok {
+		q = sort.source
+		reverse = sort.reverse
+	}
+	if ti, ok := q.(*TempIndex); ok {
+		ti.top = lim.offset + lim.limit
+		ti.topLast = reverse
+	}
+	lim.rewound = true
+}
+
+// execution --------------------------------------------------------
+
+func (lim *Limit) Rewind() {
+	lim.source.Rewind()
+	lim.rewound = true
+}
+
+func (lim *Limit) Get(th *Thread, dir Dir) Row {
+	for {
+		row := lim.get(th, dir)
+		if row == nil || lim.filter(th, row) {
+			return row
+		}
+	}
+}
+
+func (lim *Limit) get(th *Thread, dir Dir) Row {
+	if lim.rewound {
+		lim.rewound = false
+		lim.rows = lim.rows[:0]
+		lim.skipped = false
+		lim.eof = false
+		lim.pos = -1
+		if dir == Prev {
+			for lim.read(th) {
+			}
+			lim.pos = len(lim.rows)
+		}
+	}
+	if dir == Next {
+		lim.pos++
+		if lim.pos == len(lim.rows) {
+			lim.read(th)
+		}
+		if lim.pos >= len(lim.rows) {
+			lim.pos = len(lim.rows)
+			return nil
+		}
+	} else { // Prev
+		lim.pos--
+		if lim.pos < 0 {
+			lim.pos = -1
+			return nil
+		}
+	}
+	return lim.rows[lim.pos]
+}
+
+// read adds the next source row to rows, returning false if there isn't one
+func (lim *Limit) read(th *Thread) bool {
+	if !lim.skipped {
+		lim.skipped = true
+		for range lim.offset {
+			if lim.source.Get(th, Next) == nil {
+				lim.eof = true
+				break
+			}
+		}
+	}
+	if lim.eof || len(lim.rows) >= lim.limit {
+		return false
+	}
+	row := lim.source.Get(th, Next)
+	if row == nil {
+		lim.eof = true
+		return false
+	}
+	lim.rows = append(lim.rows, row)
+	return true
+}
+
+func (lim *Limit) Select(cols, vals []string) {
+	lim.selCols, lim.selVals = cols, vals
+	lim.Rewind()
+}
+
+func (lim *Limit) filter(th *Thread, row Row) bool {
+	for i, col := range lim.selCols {
+		if row.GetRawVal(lim.header, col, th, nil) != lim.selVals[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (lim *Limit) Lookup(th *Thread, cols, vals []string) Row {
+	lim.Select(cols, vals)
+	defer lim.Select(nil, nil) // clear
+	return lim.Get(th, Next)
+}
+
+func (lim *Limit) Simple(th *Thread) []Row {
+	rows := lim.source.Simple(th)
+	if lim.offset >= len(rows) {
+		return nil
+	}
+	rows = rows[lim.offset:]
+	return rows[:min(lim.limit, len(rows))]
+}
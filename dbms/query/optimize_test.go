@@ -103,6 +103,12 @@ func TestOptimize(t *testing.T) {
 		"supplier^(city) WHERE supplier > 1")
 	test("supplier where supplier > 9 sort city",
 		"supplier^(supplier) WHERE supplier > 9 TEMPINDEX(city)")
+	test("supplier where supplier > 8 sort city",
+		"supplier^(supplier) WHERE supplier > 8 TEMPINDEX(city)")
+	test("supplier where supplier > 8 sort city limit 1",
+		"supplier^(city) WHERE supplier > 8 LIMIT 1")
+	test("table sort c limit 3 offset 2",
+		"table^(a) TEMPINDEX(c) TOP 5 LIMIT 3 OFFSET 2")
 
 	test("table project a",
 		"table^(a) PROJECT-COPY a")
@@ -159,6 +165,12 @@ func TestOptimize(t *testing.T) {
 		"trans^(date,item,id) TEMPINDEX(id) SUMMARIZE-SEQ id, count")
 	test("trans summarize/*small*/ id, count",
 		"trans^(date,item,id) SUMMARIZE-MAP id, count")
+	test("hist summarize id, stddev cost", // doesn't keep values
+		"hist^(date) SUMMARIZE-MAP id, stddev cost")
+	test("hist summarize id, median cost", // keeps values
+		"hist^(date) TEMPINDEX(id) SUMMARIZE-SEQ id, median cost")
+	test("hist summarize/*small*/ id, median cost",
+		"hist^(date) SUMMARIZE-MAP id, median cost")
 
 	test("customer times inven",
 		"customer^(id) TIMES inven^(item)")
@@ -200,6 +212,19 @@ func TestOptimize(t *testing.T) {
 	test("customer leftjoin hist2 sort date",
 		"(customer^(id) LEFTJOIN 1:n by(id) hist2^(id)) TEMPINDEX(date)")
 
+	test("inven semijoin trans",
+		"inven^(item) SEMIJOIN-LOOKUP by(item) trans^(item)")
+	test("trans semijoin inven",
+		"trans^(item) SEMIJOIN-MERGE by(item) inven^(item)")
+	test("hist semijoin inven",
+		"hist^(date) SEMIJOIN-MAP by(item) inven^(item)")
+	test("customer antijoin (hist2 where cost > 100)",
+		"customer^(id) ANTIJOIN-LOOKUP by(id) (hist2^(id) WHERE cost > 100)")
+	test("inven outerjoin trans",
+		"inven^(item) OUTERJOIN-MERGE 1:n by(item) trans^(item)")
+	test("hist outerjoin inven",
+		"hist^(date) TEMPINDEX(item) OUTERJOIN-MERGE n:1 by(item) inven^(item)")
+
 	test("hist2 where date > 1 sort id",
 		"hist2^(id) WHERE date > 1")
 	test("hist2 where date is 1 sort id",
@@ -222,9 +247,22 @@ func TestOptimize(t *testing.T) {
 			"(trans^(date,item,id) JOIN n:1 by(item) inven^(item))")
 	test("trans join customer",
 		"trans^(date,item,id) JOIN n:1 by(id) customer^(id)")
+	test("trans semijoin inven",
+		"trans^(item) SEMIJOIN-MERGE by(item) inven^(item)")
+	test("hist semijoin inven",
+		"hist^(date) SEMIJOIN-LOOKUP by(item) inven^(item)")
 	test("trans join inven join customer",
 		"(inven^(item) JOIN 1:n by(item) trans^(item)) "+
 			"JOIN n:1 by(id) customer^(id)")
 	assert.T(t).This(func() { test("table rename b to bb sort c", "") }).
 		Panics("invalid query")
 }
+
+func TestOuterJoinLookupCost(t *testing.T) {
+	q := ParseQuery("task outerjoin by(cnum) cus", testTran{}, nil)
+	oj := q.(*OuterJoin)
+	// Lookup is a full scan
+	_, read1 := Optimize(oj.source1, ReadMode, nil, 1)
+	_, read2 := Optimize(oj.source2, ReadMode, nil, 1)
+	assert.T(t).That(oj.lookupCost() >= read1+read2)
+}
@@ -0,0 +1,545 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"slices"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/core/trace"
+	"github.com/apmckinlay/gsuneido/util/generic/set"
+	"github.com/apmckinlay/gsuneido/util/str"
+)
+
+// OuterJoin is a full outer join.
+// It outputs the rows from a LeftJoin of source1 and source2,
+// plus the source2 rows that do not match any source1 row
+// (with empty source1 fields).
+// The lookup strategy reads both sources by an index on the by columns
+// so they can do lookups on each other.
+// The merge strategy reads both sources in the same by order
+// and outputs the unmatched rows from either side in the one pass.
+// Select and Lookup filter the whole outer join (a full scan).
+type OuterJoin struct {
+	empty1 Row
+	empty2 Row
+	joinBase
+	outerJoinApproach
+	group   outerGroup
+	phase   outerPhase
+	rewound bool
+}
+
+type outerJoinApproach struct {
+	index1 []string
+	index2 []string
+	// mergeCols are the by columns in the order of the merge indexes
+	mergeCols []string
+	strategy  outerStrategy
+	reverse   bool
+}
+
+type outerStrategy int
+
+const (
+	// outerLookup outputs source1 (like LeftJoin)
+	// and then the unmatched source2 rows, doing lookups for both
+	outerLookup outerStrategy = iota + 1
+	// outerMerge reads both sources in by order, without lookups
+	outerMerge
+)
+
+// outerGroup is the output rows for one by value for outerMerge
+type outerGroup struct {
+	rows []Row
+	// next1 and next2 are the source rows after the group (in dir)
+	next1 Row
+	next2 Row
+	// n1 and n2 are the number of source rows in the group
+	n1  int
+	n2  int
+	pos int
+	dir Dir
+}
+
+type outerPhase int
+
+const (
+	// outerLeft outputs source1 rows with their matching source2 rows
+	outerLeft outerPhase = iota
+	// outerRight outputs the source2 rows without a matching source1 row
+	outerRight
+)
+
+func NewOuterJoin(src1, src2 Query, by []string, t QueryTran) *OuterJoin {
+	return newOuterJoin(src1, src2, by, t, nil, nil)
+}
+
+func newOuterJoin(src1, src2 Query, by []string, t QueryTran,
+	prevFixed1, prevFixed2 []Fixed) *OuterJoin {
+	oj := &OuterJoin{joinBase: newJoinBase(src1, src2, by, t,
+		prevFixed1, prevFixed2)}
+	oj.keys = oj.getKeys()
+	oj.fixed = oj.getFixed()
+	oj.setNrows(oj.getNrows())
+	oj.fast1.Set(src1.fastSingle() && src2.fastSingle())
+	oj.lookCost.Set(oj.getLookupCost())
+	return oj
+}
+
+// getLookupCost is the cost of reading both sources
+// plus looking up each row in the other source,
+// since Lookup has to scan the whole outer join
+func (oj *OuterJoin) getLookupCost() Cost {
+	n1, _ := oj.source1.Nrows()
+	n2, _ := oj.source2.Nrows()
+	return (n1+n2)*250 + // ??? same as Table
+		n1*oj.source2.lookupCost() + n2*oj.source1.lookupCost()
+}
+
+func (oj *OuterJoin) With(src1, src2 Query) *OuterJoin {
+	return newOuterJoin(src1, src2, oj.by, oj.qt, oj.prevFixed1, oj.prevFixed2)
+}
+
+func (oj *OuterJoin) String() string {
+	return parenQ2(oj.source1) + " " + oj.stringOp() + " " + paren(oj.source2)
+}
+
+func (oj *OuterJoin) stringOp() string {
+	s := "OUTERJOIN"
+	switch oj.strategy {
+	case outerLookup:
+		s += "-LOOKUP"
+	case outerMerge:
+		s += "-MERGE"
+	}
+	return s + oj.bystr()
+}
+
+func (oj *OuterJoin) format() string {
+	s := "outerjoin by" + str.Join("(,)", oj.by)
+	if oj.joinType == n_n {
+		s += " /*MANY TO MANY*/"
+	}
+	return s
+}
+
+func (oj *OuterJoin) getKeys() [][]string {
+	// either side can be missing/blank (except for by)
+	if oj.joinType == one_one {
+		return [][]string{oj.by}
+	}
+	return oj.keypairs()
+}
+
+func (oj *OuterJoin) getFixed() []Fixed {
+	fixed1 := oj.source1.Fixed()
+	fixed2 := oj.source2.Fixed()
+	var result []Fixed
+	// by columns are fixed if they are fixed on both sides
+	for _, f1 := range fixed1 {
+		if slices.Contains(oj.by, f1.col) {
+			if vals2 := getFixed(fixed2, f1.col); vals2 != nil {
+				result = append(result,
+					Fixed{col: f1.col, values: set.Union(f1.values, vals2)})
+			}
+		}
+	}
+	// add "" to the others because either side can be empty
+	for _, fixed := range [][]Fixed{fixed1, fixed2} {
+		for _, f := range fixed {
+			if !slices.Contains(oj.by, f.col) {
+				result = append(result, fixedWith(f, ""))
+			}
+		}
+	}
+	return result
+}
+
+func (oj *OuterJoin) getNrows() (int, int) {
+	n1, p1 := oj.source1.Nrows()
+	n2, p2 := oj.source2.Nrows()
+	return oj.nrows(n1, n2), oj.nrows(p1, p2)
+}
+
+func (oj *OuterJoin) nrows(n1, n2 int) int {
+	if oj.joinType == n_n {
+		return max(n1+n2, (n1*n2)/2) // estimate half
+	}
+	return max(n1, n2) + min(n1, n2)/2 // ??? estimate half match
+}
+
+func (oj *OuterJoin) Transform() Query {
+	src1 := oj.source1.Transform()
+	src2 := oj.source2.Transform()
+	_, src1Nothing := src1.(*Nothing)
+	_, src2Nothing := src2.(*Nothing)
+	if src1Nothing && src2Nothing {
+		return NewNothing(oj)
+	}
+	if src2Nothing {
+		return keepCols(src1, src2, oj.Header())
+	}
+	if src1Nothing {
+		return keepCols(src2, src1, oj.Header())
+	}
+	// can't copy fixed between sources because both are "optional"
+	if src1 != oj.source1 || src2 != oj.source2 {
+		return oj.With(src1, src2).Transform()
+	}
+	return oj
+}
+
+func (oj *OuterJoin) optimize(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	if index != nil {
+		// lookup outputs the unmatched source2 rows last so there is no order
+		// COULD allow the merge order
+		return impossible, impossible, nil
+	}
+	fwd := outerjoinopt(oj.source1, oj.source2, mode, frac, oj.by)
+	rev := outerjoinopt(oj.source2, oj.source1, mode, frac, oj.by)
+	merge, mergeApp := oj.mergeCost(mode, frac)
+	if trace.JoinOpt.On() {
+		trace.JoinOpt.Println(mode, index, frac)
+		trace.Println("    outerjoin fwd index1", fwd.index1, "index2", fwd.index2,
+			"=", fwd.fixcost, fwd.varcost)
+		trace.Println("    outerjoin rev index1", rev.index1, "index2", rev.index2,
+			"=", rev.fixcost, rev.varcost)
+		trace.Println("    outerjoin merge index1", merge.index1,
+			"index2", merge.index2, "=", merge.fixcost, merge.varcost)
+	}
+	approach := &outerJoinApproach{strategy: outerLookup}
+	if rev.fixcost+rev.varcost < fwd.fixcost+fwd.varcost {
+		fwd = rev
+		approach.reverse = true
+	}
+	if merge.fixcost+merge.varcost < fwd.fixcost+fwd.varcost {
+		return merge.fixcost, merge.varcost, mergeApp
+	}
+	if fwd.fixcost >= impossible {
+		return impossible, impossible, nil
+	}
+	approach.index1 = fwd.index1
+	approach.index2 = fwd.index2
+	return fwd.fixcost, fwd.varcost, approach
+}
+
+// mergeCost returns the cost of reading all of both sources
+// by indexes with the by columns as a prefix, in the same order
+func (oj *OuterJoin) mergeCost(mode Mode, frac float64) (joinCost, any) {
+	best := joinCost{fixcost: impossible, varcost: impossible}
+	var mergeCols []string
+	mergeIndexes([][]string{oj.by}, oj.source1.Indexes(), oj.source2.Indexes(),
+		func(by []string, i1, i2 int) {
+			index1, index2 := by, by
+			if i1 != -1 {
+				index1 = oj.source1.Indexes()[i1]
+				index2 = oj.source2.Indexes()[i2]
+			}
+			fixcost1, varcost1 := Optimize(oj.source1, mode, index1, frac)
+			fixcost2, varcost2 := Optimize(oj.source2, mode, index2, frac)
+			if fixcost1+varcost1+fixcost2+varcost2 < best.fixcost+best.varcost {
+				best = joinCost{index1: index1, index2: index2,
+					fixcost: fixcost1 + fixcost2, varcost: varcost1 + varcost2}
+				mergeCols = index1[:len(by)]
+			}
+		})
+	return best, &outerJoinApproach{strategy: outerMerge,
+		index1: best.index1, index2: best.index2, mergeCols: mergeCols}
+}
+
+// outerjoinopt returns the cost of reading all of both sources
+// plus looking up each row in the other source
+func outerjoinopt(src1, src2 Query, mode Mode, frac float64,
+	by []string) joinCost {
+	best1 := bestGrouped(src1, mode, nil, frac, by)
+	best2 := bestGrouped(src2, mode, nil, frac, by)
+	if best1.index == nil || best2.index == nil {
+		return joinCost{fixcost: impossible}
+	}
+	nrows1, _ := src1.Nrows()
+	nrows2, _ := src2.Nrows()
+	lookups := Cost(frac * float64(nrows1*src2.lookupCost()+
+		nrows2*src1.lookupCost()))
+	return joinCost{index1: best1.index, index2: best2.index,
+		fixcost: best1.fixcost + best2.fixcost,
+		varcost: best1.varcost + best2.varcost + lookups,
+	}
+}
+
+func (oj *OuterJoin) setApproach(_ []string, frac float64, approach any, tran QueryTran) {
+	ap := approach.(*outerJoinApproach)
+	oj.outerJoinApproach = *ap
+	if ap.reverse {
+		oj.source1, oj.source2 = oj.source2, oj.source1
+		oj.joinType = oj.joinType.reverse()
+	}
+	oj.source1 = SetApproach(oj.source1, ap.index1, frac, tran)
+	oj.source2 = SetApproach(oj.source2, ap.index2, frac, tran)
+	oj.empty1 = make(Row, len(oj.source1.Header().Fields))
+	oj.empty2 = make(Row, len(oj.source2.Header().Fields))
+	oj.header = oj.getHeader()
+	oj.rewound = true
+}
+
+// execution --------------------------------------------------------
+
+func (oj *OuterJoin) Rewind() {
+	oj.joinBase.Rewind()
+	oj.rewound = true
+}
+
+func (oj *OuterJoin) rewind() {
+	oj.joinBase.rewind()
+	oj.rewound = true
+}
+
+func (oj *OuterJoin) Get(th *Thread, dir Dir) Row {
+	for {
+		row := oj.get(th, dir)
+		if row == nil || oj.filter(th, row) {
+			return row
+		}
+	}
+}
+
+func (oj *OuterJoin) get(th *Thread, dir Dir) Row {
+	if oj.strategy == outerMerge {
+		return oj.getMerge(th, dir)
+	}
+	if oj.rewound {
+		oj.rewound = false
+		if dir == Next {
+			oj.startLeft()
+		} else { // Prev
+			oj.startRight()
+		}
+	}
+	for {
+		if oj.phase == outerRight {
+			if row := oj.getRight(th, dir); row != nil {
+				return row
+			}
+			if dir == Next {
+				return nil
+			}
+			oj.startLeft()
+		}
+		if row := oj.getLeft(th, dir); row != nil {
+			return row
+		}
+		if dir == Prev {
+			return nil
+		}
+		oj.startRight()
+	}
+}
+
+func (oj *OuterJoin) startLeft() {
+	oj.phase = outerLeft
+	oj.source1.Select(nil, nil)
+	oj.row1, oj.row2 = nil, nil
+}
+
+func (oj *OuterJoin) startRight() {
+	oj.phase = outerRight
+	oj.source2.Select(nil, nil)
+	oj.row1, oj.row2 = nil, nil
+}
+
+// getLeft is like LeftJoin Get
+func (oj *OuterJoin) getLeft(th *Thread, dir Dir) Row {
+	row1out := true
+	for {
+		if oj.row2 == nil {
+			oj.row1 = oj.source1.Get(th, dir)
+			if oj.row1 == nil {
+				return nil
+			}
+			oj.source2.Select(oj.by, oj.projectRow1(th, oj.row1))
+			row1out = false
+		}
+		oj.row2 = oj.source2.Get(th, dir)
+		if !row1out || oj.row2 != nil {
+			row1out = true
+			row2 := oj.row2
+			if row2 == nil {
+				row2 = oj.empty2
+			}
+			return JoinRows(oj.row1, row2)
+		}
+	}
+}
+
+// getRight returns the next source2 row that doesn't match any source1 row
+func (oj *OuterJoin) getRight(th *Thread, dir Dir) Row {
+	for {
+		row2 := oj.source2.Get(th, dir)
+		if row2 == nil {
+			return nil
+		}
+		oj.source1.Select(oj.by, oj.projectRow2(th, row2))
+		if oj.source1.Get(th, Next) == nil {
+			return JoinRows(oj.empty1, row2)
+		}
+	}
+}
+
+// getMerge returns the next row from the current group,
+// reading the next group from both sources when it is exhausted.
+// If the direction changes, the sources are moved back over the group.
+func (oj *OuterJoin) getMerge(th *Thread, dir Dir) Row {
+	g := &oj.group
+	if oj.rewound {
+		oj.rewound = false
+		*g = outerGroup{next1: oj.source1.Get(th, dir),
+			next2: oj.source2.Get(th, dir), dir: dir, pos: -1}
+	}
+	if dir == g.dir {
+		g.pos++
+	} else {
+		g.pos--
+	}
+	if 0 <= g.pos && g.pos < len(g.rows) {
+		return g.rows[g.pos]
+	}
+	if dir != g.dir {
+		g.next1 = oj.backOver(th, oj.source1, g.next1, g.n1, dir)
+		g.next2 = oj.backOver(th, oj.source2, g.next2, g.n2, dir)
+		g.dir = dir
+	}
+	oj.nextGroup(th, dir)
+	if len(g.rows) == 0 {
+		return nil
+	}
+	return g.rows[0]
+}
+
+// backOver moves src (in the new dir) back over the n rows of the group
+// and returns the row after the group in the new direction
+func (oj *OuterJoin) backOver(th *Thread, src Query, next Row, n int,
+	dir Dir) Row {
+	if next == nil {
+		src.Rewind() // eof so start from the other end
+	}
+	for range n {
+		src.Get(th, dir)
+	}
+	return src.Get(th, dir)
+}
+
+// nextGroup reads the source rows with the next by value (in dir)
+// and makes the output rows for them
+func (oj *OuterJoin) nextGroup(th *Thread, dir Dir) {
+	g := &oj.group
+	g.rows, g.n1, g.n2, g.pos = g.rows[:0], 0, 0, 0
+	if g.next1 == nil && g.next2 == nil {
+		return
+	}
+	var key []string
+	if g.next2 == nil {
+		key = oj.projectMerge(th, oj.source1, g.next1)
+	} else if g.next1 == nil {
+		key = oj.projectMerge(th, oj.source2, g.next2)
+	} else {
+		key1 := oj.projectMerge(th, oj.source1, g.next1)
+		key2 := oj.projectMerge(th, oj.source2, g.next2)
+		c := slices.Compare(key1, key2)
+		if dir == Prev {
+			c = -c
+		}
+		key = key1
+		if c > 0 {
+			key = key2
+		}
+	}
+	var rows1, rows2 []Row
+	for g.next1 != nil &&
+		slices.Equal(oj.projectMerge(th, oj.source1, g.next1), key) {
+		rows1 = append(rows1, g.next1)
+		g.next1 = oj.source1.Get(th, dir)
+	}
+	for g.next2 != nil &&
+		slices.Equal(oj.projectMerge(th, oj.source2, g.next2), key) {
+		rows2 = append(rows2, g.next2)
+		g.next2 = oj.source2.Get(th, dir)
+	}
+	g.n1, g.n2 = len(rows1), len(rows2)
+	switch {
+	case len(rows2) == 0:
+		for _, row1 := range rows1 {
+			g.rows = append(g.rows, JoinRows(row1, oj.empty2))
+		}
+	case len(rows1) == 0:
+		for _, row2 := range rows2 {
+			g.rows = append(g.rows, JoinRows(oj.empty1, row2))
+		}
+	default:
+		for _, row1 := range rows1 {
+			for _, row2 := range rows2 {
+				g.rows = append(g.rows, JoinRows(row1, row2))
+			}
+		}
+	}
+}
+
+func (oj *OuterJoin) projectMerge(th *Thread, src Query, row Row) []string {
+	hdr := src.Header()
+	key := make([]string, len(oj.mergeCols))
+	for i, col := range oj.mergeCols {
+		key[i] = row.GetRawVal(hdr, col, th, oj.st)
+	}
+	return key
+}
+
+func (oj *OuterJoin) filter(th *Thread, row Row) bool {
+	for i, col := range oj.sel2cols {
+		if row.GetRawVal(oj.header, col, th, oj.st) != oj.sel2vals[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Select filters the results since either side can be empty
+func (oj *OuterJoin) Select(cols, vals []string) {
+	oj.source1.Select(nil, nil)
+	oj.source2.Select(nil, nil)
+	oj.rewind()
+	oj.sel2cols, oj.sel2vals = cols, vals
+}
+
+func (oj *OuterJoin) Lookup(th *Thread, cols, vals []string) Row {
+	oj.Select(cols, vals)
+	defer oj.Select(nil, nil) // clear
+	return oj.Get(th, Next)
+}
+
+func (oj *OuterJoin) Simple(th *Thread) []Row {
+	rows1 := oj.source1.Simple(th)
+	rows2 := oj.source2.Simple(th)
+	empty1 := make(Row, len(oj.source1.Header().Fields))
+	empty2 := make(Row, len(oj.source2.Header().Fields))
+	matched2 := make([]bool, len(rows2))
+	rows := make([]Row, 0, len(rows1)+len(rows2))
+	for _, row1 := range rows1 {
+		row1out := false
+		for i2, row2 := range rows2 {
+			if oj.equalBy(th, oj.st, row1, row2) {
+				rows = append(rows, JoinRows(row1, row2))
+				row1out = true
+				matched2[i2] = true
+			}
+		}
+		if !row1out {
+			rows = append(rows, JoinRows(row1, empty2))
+		}
+	}
+	for i2, row2 := range rows2 {
+		if !matched2[i2] {
+			rows = append(rows, JoinRows(empty1, row2))
+		}
+	}
+	return rows
+}
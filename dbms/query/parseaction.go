@@ -19,7 +19,7 @@ type actionParser struct {
 	queryParser
 }
 
-// ParseAction parses insert, update, and delete actions
+// ParseAction parses insert, update, upsert, and delete actions
 func ParseAction(src string, t QueryTran, sv *Sviews) Action {
 	p := actionParser{*NewQueryParser(src, t, sv)}
 	result := p.action()
@@ -37,8 +37,10 @@ func (p *actionParser) action() Action {
 		return p.update()
 	case p.MatchIf(tok.Delete):
 		return p.delete()
+	case p.MatchIf(tok.Upsert):
+		return p.upsert()
 	default:
-		panic(p.Error("action must be insert, update, or delete"))
+		panic(p.Error("action must be insert, update, upsert, or delete"))
 	}
 }
 
@@ -89,3 +91,25 @@ func (p *actionParser) delete() Action {
 	query := p.baseQuery()
 	return &deleteAction{query: query}
 }
+
+// upsert is either:
+//
+//	upsert record into table [key(columns)]
+//	upsert query into table [key(columns)]
+func (p *actionParser) upsert() Action {
+	var record *SuRecord
+	var query Query
+	if p.Token == tok.LCurly || p.Token == tok.LBracket {
+		record = p.record()
+	} else {
+		query = p.baseQuery()
+	}
+	p.Match(tok.Into)
+	table := p.Text
+	p.Match(tok.Identifier)
+	var key []string
+	if p.MatchIf(tok.Key) {
+		key = p.parenList()
+	}
+	return &upsertAction{record: record, query: query, table: table, key: key}
+}
@@ -26,6 +26,10 @@ func TestParseAct(t *testing.T) {
 	test("delete table")
 	test("delete table where a > 1")
 
+	test("upsert [a: 1, b: 3] into table")
+	test("upsert [a: 1, b: 3] into table key(a)")
+	test("upsert table where a > 1 into table1 key(a,b)")
+
 	assert.This(func() {
 		ParseAction("foo bar", testTran{}, nil)
 	}).Panics("action must")
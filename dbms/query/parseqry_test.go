@@ -27,6 +27,9 @@ func TestParseQuery(t *testing.T) {
 	test("table")
 	test("table sort a")
 	test("table sort reverse a, b")
+	test("table sort a limit 5")
+	test("table sort a limit 5 offset 10")
+	test("table where a is 1 limit 1", "table where*1 a is 1 limit 1")
 	test("table project a")
 	test("table project a,b,c")
 	test("table rename a to aa")
@@ -43,6 +46,12 @@ func TestParseQuery(t *testing.T) {
 		"cus leftjoin 1:n by(cnum) task")
 	test("cus leftjoin by(cnum) task",
 		"cus leftjoin 1:n by(cnum) task")
+	test("cus outerjoin task",
+		"cus outerjoin 1:n by(cnum) task")
+	test("cus semijoin task",
+		"cus semijoin by(cnum) task")
+	test("cus antijoin by(cnum) task",
+		"cus antijoin by(cnum) task")
 	test("table summarize count",
 		"table summarize count")
 	test("table summarize n = count")
@@ -53,6 +62,20 @@ func TestParseQuery(t *testing.T) {
 		"table summarize count, total a, max b")
 	test("table summarize a, b, count",
 		"table summarize a, b, count")
+	test("table summarize countdistinct a, median a, stddev a, variance a")
+	test("table summarize p90 = percentile(90) a, percentile(12.5) b")
+	test("table summarize percentile(25) a, percentile(75) a")
+	test("table summarize concat a, concat(', ') b, concat('', sort) c",
+		`table summarize concat a, concat(", ") b, concat("", sort) c`)
+	// newer op names can still be by columns
+	test("table extend median = a summarize median, count")
+	test("table extend concat = a, stddev = b summarize concat, stddev, " +
+		"concat b, median c")
+	test("table window sort b extend n = row_number()")
+	test("table window by a sort reverse b extend t = total(c), r = rank()")
+	test("table window by a sort b extend p = lag(c), n = lead(c, 2)")
+	test("table window by a sort b extend x = LAG(c, 1)",
+		"table window by a sort b extend x = lag(c)")
 
 	test("(table union table2) join table2",
 		"(table union table2) join n:1 by(c,d,e) table2")
@@ -78,6 +101,25 @@ func TestParseQuery(t *testing.T) {
 	xtest("cus join by() task", "invalid empty join by")
 	xtest("table summarize a, b", "expecting Comma")
 	xtest("table summarize total", "expecting identifier")
+	xtest("table summarize percentile a", "expecting LParen")
+	xtest("table summarize percentile(101) a",
+		"percentile must be from 0 to 100")
+	xtest("table summarize concat(sort) a", "expecting String")
+	xtest("table summarize x = max a, x = min a",
+		"summarize: duplicate result columns")
+	xtest("table window extend x = count()", "expecting Sort")
+	xtest("table window sort b extend x = foo(c)",
+		"window: invalid function: foo")
+	xtest("table window sort b extend x = total()",
+		"window: total requires a column")
+	xtest("table window sort b extend x = lag(c, 0)",
+		"offset must be greater than zero")
+	xtest("table window by a sort a extend x = count()",
+		"sort columns can't be in by")
+	xtest("table sort a limit -1", "limit must be a non-negative integer")
+	xtest("table limit 5 sort a", "syntax error")
+	xtest("table window sort b extend c = count()",
+		"column(s) already exist")
 
 	xtest("cus extend x = y = 1",
 		"assignment operators are not allowed")
@@ -5,6 +5,7 @@ package query
 
 import (
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/apmckinlay/gsuneido/compile"
@@ -52,9 +53,28 @@ func (p *queryParser) sort() Query {
 		cols := p.commaList()
 		q = NewSort(q, reverse, cols)
 	}
+	if p.Token.IsIdent() && p.Text == "limit" {
+		p.Next()
+		limit := p.count("limit")
+		offset := 0
+		if p.Token.IsIdent() && p.Text == "offset" {
+			p.Next()
+			offset = p.count("offset")
+		}
+		q = NewLimit(q, limit, offset)
+	}
 	return q
 }
 
+func (p *queryParser) count(what string) int {
+	n, err := strconv.Atoi(p.Text)
+	if err != nil || n < 0 {
+		p.Error(what + " must be a non-negative integer")
+	}
+	p.Match(tok.Number)
+	return n
+}
+
 func (p *queryParser) baseQuery() Query {
 	q := p.source()
 	for p.operation(&q) {
@@ -73,6 +93,9 @@ func (p *queryParser) source() Query {
 
 func (p *queryParser) table() Query {
 	table := p.MatchIdent()
+	if p.Token.IsIdent() && p.Text == "asof" {
+		return p.tableAsof(table)
+	}
 	if !slices.Contains(p.viewNest, table) {
 		if def := p.getView(table); def != "" {
 			q := parseQuery(def, p.t, p.sviews, append(p.viewNest, table),
@@ -86,6 +109,19 @@ func (p *queryParser) table() Query {
 	return NewTable(p.t, table)
 }
 
+// tableAsof handles table asof #date
+func (p *queryParser) tableAsof(table string) Query {
+	p.Next()
+	asof, ok := p.Const().(SuDate)
+	if !ok || asof == NilDate {
+		p.Error("asof requires a date")
+	}
+	if p.getView(table) != "" || isSystemTable(table) || table == "history" {
+		p.Error("asof is only supported for tables")
+	}
+	return NewTableAsof(p.t, table, asof)
+}
+
 func (p *queryParser) getView(name string) string {
 	def := ""
 	if p.sviews != nil { // should only be nil from tests
@@ -109,6 +145,12 @@ func (p *queryParser) operation(pq *Query) bool {
 		*pq = p.leftjoin(*pq)
 	case p.MatchIf(tok.Minus):
 		*pq = p.minus(*pq)
+	case p.MatchIf(tok.Outerjoin):
+		*pq = p.outerjoin(*pq)
+	case p.MatchIf(tok.Semijoin):
+		*pq = p.semijoin(*pq)
+	case p.MatchIf(tok.Antijoin):
+		*pq = p.antijoin(*pq)
 	case p.MatchIf(tok.Project):
 		*pq = p.project(*pq)
 	case p.MatchIf(tok.Remove):
@@ -123,6 +165,8 @@ func (p *queryParser) operation(pq *Query) bool {
 		*pq = p.union(*pq)
 	case p.MatchIf(tok.Where):
 		*pq = p.where(*pq)
+	case p.MatchIf(tok.Window):
+		*pq = p.window(*pq)
 	default:
 		return false
 	}
@@ -163,6 +207,24 @@ func (p *queryParser) leftjoin(q Query) Query {
 	return NewLeftJoin(q, q2, by, p.t)
 }
 
+func (p *queryParser) outerjoin(q Query) Query {
+	by := p.joinBy()
+	q2 := p.source()
+	return NewOuterJoin(q, q2, by, p.t)
+}
+
+func (p *queryParser) semijoin(q Query) Query {
+	by := p.joinBy()
+	q2 := p.source()
+	return NewSemiJoin(q, q2, by, p.t)
+}
+
+func (p *queryParser) antijoin(q Query) Query {
+	by := p.joinBy()
+	q2 := p.source()
+	return NewAntiJoin(q, q2, by, p.t)
+}
+
 func (p *queryParser) joinBy() []string {
 	if p.MatchIf(tok.By) {
 		by := p.parenList()
@@ -211,14 +273,14 @@ func (p *queryParser) summarize(q Query) Query {
 		hint = "large"
 	}
 	by := p.sumBy()
-	cols, ops, ons := p.sumOps()
-	return NewSummarize(q, hint, by, cols, ops, ons)
+	cols, ops, ons, params := p.sumOps()
+	return NewSummarize(q, hint, by, cols, ops, ons, params)
 }
 
 func (p *queryParser) sumBy() []string {
 	var by []string
 	for p.Token.IsIdent() &&
-		!isSumOp(p.Token) &&
+		!p.isSumOpStart() &&
 		p.Lxr.Ahead(1).Token != tok.Eq {
 		by = append(by, p.MatchIdent())
 		p.Match(tok.Comma)
@@ -226,7 +288,7 @@ func (p *queryParser) sumBy() []string {
 	return by
 }
 
-func (p *queryParser) sumOps() (cols, ops, ons []string) {
+func (p *queryParser) sumOps() (cols, ops, ons []string, params []sumParam) {
 	for {
 		var col, op, on string
 		if p.Lxr.Ahead(1).Token == tok.Eq {
@@ -234,15 +296,18 @@ func (p *queryParser) sumOps() (cols, ops, ons []string) {
 			p.Match(tok.Eq)
 		}
 		if !isSumOp(p.Token) {
-			p.Error("expected count, total, min, max, or list")
+			p.Error("expected count, countdistinct, total, average, min, max, " +
+				"median, percentile, stddev, variance, list, or concat")
 		}
 		op = str.ToLower(p.MatchIdent())
+		param := p.sumParam(op)
 		if op != "count" {
 			on = p.MatchIdent()
 		}
 		cols = append(cols, col)
 		ops = append(ops, op)
 		ons = append(ons, on)
+		params = append(params, param)
 		if !p.MatchIf(tok.Comma) {
 			break
 		}
@@ -250,6 +315,47 @@ func (p *queryParser) sumOps() (cols, ops, ons []string) {
 	return
 }
 
+// sumParam handles percentile(pct) and concat[(sep [, sort])]
+func (p *queryParser) sumParam(op string) sumParam {
+	var param sumParam
+	switch op {
+	case "percentile":
+		p.Match(tok.LParen)
+		pct, err := strconv.ParseFloat(p.Text, 64)
+		if err != nil || pct < 0 || pct > 100 {
+			p.Error("summarize: percentile must be from 0 to 100")
+		}
+		p.Match(tok.Number)
+		p.Match(tok.RParen)
+		param.pct = pct
+	case "concat":
+		if p.MatchIf(tok.LParen) {
+			param.sep = p.Text
+			p.Match(tok.String)
+			if p.MatchIf(tok.Comma) {
+				p.Match(tok.Sort)
+				param.sorted = true
+			}
+			p.Match(tok.RParen)
+		}
+	}
+	return param
+}
+
+// isSumOpStart returns whether the current token starts an operation.
+// The newer operations may also be existing column names
+// so they are only treated as operations when followed by a column or a (
+// e.g. "summarize median, count" treats median as a by column.
+func (p *queryParser) isSumOpStart() bool {
+	switch p.Token {
+	case tok.Concat, tok.Countdistinct, tok.Median, tok.Percentile,
+		tok.Stddev, tok.Variance:
+		next := p.Lxr.AheadSkip(0).Token
+		return next.IsIdent() || next == tok.LParen
+	}
+	return isSumOp(p.Token)
+}
+
 func isSumOp(t tok.Token) bool {
 	return tok.SummarizeStart < t && t < tok.SummarizeEnd
 }
@@ -271,6 +377,50 @@ func (p *queryParser) where(q Query) Query {
 	return NewWhere(q, expr, p.t)
 }
 
+// window is: window [by cols] sort [reverse] cols extend col = fn(...), ...
+func (p *queryParser) window(q Query) Query {
+	var by []string
+	if p.MatchIf(tok.By) {
+		by = p.commaList()
+	}
+	p.Match(tok.Sort)
+	reverse := p.MatchIf(tok.Reverse)
+	order := p.commaList()
+	p.Match(tok.Extend)
+	var cols, fns, ons []string
+	var offsets []int
+	for {
+		cols = append(cols, p.MatchIdent())
+		p.Match(tok.Eq)
+		fn := str.ToLower(p.MatchIdent())
+		p.Match(tok.LParen)
+		var on string
+		offset := 0
+		if p.Token != tok.RParen {
+			on = p.MatchIdent()
+		}
+		if fn == "lag" || fn == "lead" {
+			offset = 1
+		}
+		if p.MatchIf(tok.Comma) {
+			n, err := strconv.Atoi(p.Text)
+			if err != nil {
+				p.Error("window: offset must be an integer")
+			}
+			p.Match(tok.Number)
+			offset = n
+		}
+		p.Match(tok.RParen)
+		fns = append(fns, fn)
+		ons = append(ons, on)
+		offsets = append(offsets, offset)
+		if !p.MatchIf(tok.Comma) {
+			break
+		}
+	}
+	return NewWindow(q, by, reverse, order, cols, fns, ons, offsets)
+}
+
 func (p *queryParser) parenList() []string {
 	p.Match(tok.LParen)
 	if p.MatchIf(tok.RParen) {
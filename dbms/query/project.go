@@ -231,18 +231,21 @@ func (p *Project) Transform() Query {
 		cols := make([]string, 0, len(q.cols))
 		ops := make([]string, 0, len(q.ops))
 		ons := make([]string, 0, len(q.ons))
+		params := make([]sumParam, 0, len(q.params))
 		for i, col := range q.cols {
 			if slices.Contains(p.columns, col) {
 				cols = append(cols, col)
 				ops = append(ops, q.ops[i])
 				ons = append(ons, q.ons[i])
+				params = append(params, q.params[i])
 			}
 		}
 		if len(cols) == 0 { // no summaries left
 			return newProject(q.source, p.columns).Transform()
 		}
 		if set.Subset(p.columns, q.by) {
-			return NewSummarize(q.source, q.hint, q.by, cols, ops, ons).Transform()
+			return NewSummarize(q.source, q.hint, q.by, cols, ops, ons,
+				params).Transform()
 		}
 	case *Rename:
 		return p.transformRename(q)
@@ -260,6 +263,11 @@ func (p *Project) Transform() Query {
 			src1, src2 := p.splitOver(&q.Query2)
 			return q.With(src1, src2).Transform()
 		}
+	case *SemiJoin:
+		if set.Subset(p.columns, q.by) {
+			src1 := newProject(q.source1, p.columns)
+			return q.With(src1, q.source2).Transform()
+		}
 	case *Union:
 		if p.splitable(&q.Compatible) {
 			return NewUnion(p.splitOver(&q.Query2)).Transform()
@@ -14,12 +14,14 @@
 			Indexes
 		Query1
 			Extend
+			Limit
 			Project / Remove
 			Rename
 			Sort
 			Summarize
 			TempIndex
 			Where
+			Window
 			View
 		Query2
 			Compatible
@@ -32,6 +34,8 @@
 				joinBase
 					Join
 					LeftJoin
+					OuterJoin
+					SemiJoin (and antijoin)
 */
 package query
 
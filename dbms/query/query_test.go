@@ -486,3 +486,155 @@ func (q *TestQop) Select(cols, vals []string) {
 func (q *TestQop) fastSingle() bool { // override Nothing
 	return false
 }
+
+func TestTableAsof(t *testing.T) {
+	db, err := db19.CreateDb(stor.HeapStor(8192))
+	ck(err)
+	db.CheckerSync()
+	defer db.Close()
+	MakeSuTran = func(qt QueryTran) *SuTran { return nil }
+	act := func(act string) {
+		ut := db.NewUpdateTran()
+		assert.This(DoAction(nil, ut, act)).Is(1)
+		db.CommitMerge(ut)
+	}
+	query := func(query string) string {
+		tran := db.NewReadTran()
+		q := ParseQuery(query, tran, nil)
+		q, _, _ = Setup(q, ReadMode, tran)
+		return queryAll2(q)
+	}
+	doAdmin(db, "create tmp (a,b) key(a)")
+	act("insert { a: 1 } into tmp")
+	act("insert { a: 2 } into tmp")
+	db.PersistSync()
+	time.Sleep(5 * time.Millisecond)
+	asof := Now().String()
+	time.Sleep(5 * time.Millisecond)
+	act("delete tmp where a = 1")
+	db.PersistSync()
+
+	assert.T(t).This(query("tmp")).Is("a=2")
+	assert.T(t).This(query("tmp asof " + asof)).Is("a=1 | a=2")
+	assert.T(t).This(query("tmp asof " + asof + " minus tmp")).Is("a=1")
+	assert.T(t).This(query("tmp asof " + asof + " where a = 1")).Is("a=1")
+
+	tran := db.NewReadTran()
+	q := ParseQuery("tmp asof "+asof, tran, nil)
+	assert.T(t).This(q.String()).Is("tmp asof " + asof)
+	assert.T(t).This(q.Updateable()).Is("")
+	assert.T(t).This(func() { ParseQuery("tmp asof 123", tran, nil) }).
+		Panics("asof requires a date")
+	assert.T(t).This(func() { ParseQuery("tables asof "+asof, tran, nil) }).
+		Panics("only supported for tables")
+	assert.T(t).This(func() { ParseQuery("tmp asof #20000101", tran, nil) }).
+		Panics("asof: no state at or before #20000101")
+}
+
+func TestUpsert(t *testing.T) {
+	db := heapDb()
+	defer db.Close()
+	upsert := func(act string) Value {
+		ut := db.NewUpdateTran()
+		defer ut.Commit()
+		return DoActionResult(nil, ut, act)
+	}
+	query := func(query string) string {
+		tran := db.NewReadTran()
+		q := ParseQuery(query, tran, nil)
+		q, _, _ = Setup(q, ReadMode, tran)
+		return queryAll2(q)
+	}
+	result := func(ins, upd int) Value {
+		ob := &SuObject{}
+		ob.Set(SuStr("inserted"), IntVal(ins))
+		ob.Set(SuStr("updated"), IntVal(upd))
+		return ob
+	}
+	db.adm("create tmp (a,b,c) key(a)")
+	assert.T(t).This(upsert("upsert { a: 1, b: 2 } into tmp")).Is(result(1, 0))
+	assert.T(t).This(upsert("upsert { a: 1, c: 3 } into tmp")).Is(result(0, 1))
+	assert.T(t).This(query("tmp")).Is("a=1 b=2 c=3")
+
+	db.adm("create src (a,c) key(a)")
+	db.act("insert { a: 1, c: 4 } into src")
+	db.act("insert { a: 2, c: 5 } into src")
+	assert.T(t).This(upsert("upsert src into tmp")).Is(result(1, 1))
+	assert.T(t).This(query("tmp")).Is("a=1 b=2 c=4 | a=2 c=5")
+	ut := db.NewUpdateTran()
+	assert.T(t).This(DoAction(nil, ut, "upsert src into tmp")).Is(2)
+	ut.Abort()
+
+	db.adm("create tmp2 (a,b) key(a) key(b)")
+	assert.T(t).This(func() { upsert("upsert { a: 1, b: 1 } into tmp2") }).
+		Panics("multiple keys")
+	assert.T(t).This(func() { upsert("upsert { a: 1, b: 1 } into tmp2 key(c)") }).
+		Panics("does not have key(c)")
+	assert.T(t).This(upsert("upsert { a: 1, b: 1 } into tmp2 key(b)")).
+		Is(result(1, 0))
+	assert.T(t).This(upsert("upsert { a: 2, b: 1 } into tmp2 key(b)")).
+		Is(result(0, 1))
+	assert.T(t).This(query("tmp2")).Is("a=2 b=1")
+	assert.T(t).This(func() { upsert("upsert src into tmp2 key(b)") }).
+		Panics("must include key column b")
+
+	db.adm("create tmp3 (a, c, x_TS, y_TS) key(a)")
+	assert.T(t).This(func() { upsert("upsert src into tmp3") }).
+		Panics("multiple _TS fields not supported")
+}
+
+func TestRowHeap(t *testing.T) {
+	row := func(s string) heapRow {
+		var rb RecordBuilder
+		rb.Add(SuStr(s))
+		return heapRow{row: Row{DbRec{Record: rb.Build()}}}
+	}
+	h := &rowHeap{before: func(x, y heapRow) bool {
+		return x.row[0].Record.GetStr(0) < y.row[0].Record.GetStr(0)
+	}}
+	size := 0
+	for _, s := range []string{"mmm", "zz", "a", "bbbb", "y", "x"} {
+		size += h.add(row(s), 2)
+	}
+	// only the two kept rows count
+	assert.T(t).This(size).
+		Is(recordsSize(row("a").row) + recordsSize(row("bbbb").row))
+	assert.T(t).This(h.add(row("q"), 2)).Is(0)
+}
+
+func TestTopPaging(t *testing.T) {
+	db := heapDb()
+	defer db.Close()
+	MakeSuTran = func(qt QueryTran) *SuTran { return nil }
+	th := &Thread{}
+	db.adm("create tmp (k, v) key(k)")
+	const n = 20
+	for i := 0; i < n; i++ {
+		db.act(fmt.Sprintf("insert { k: %d, v: %d } into tmp", i, i%3))
+	}
+	get := func(query string) []string {
+		t.Helper()
+		tran := db.NewReadTran()
+		q := ParseQuery(query, tran, nil)
+		q, _, _ = Setup(q, ReadMode, tran)
+		assert.T(t).That(strings.Contains(q.String(), " TOP "))
+		hdr := q.Header()
+		var list []string
+		for row := q.Get(th, Next); row != nil; row = q.Get(th, Next) {
+			list = append(list, row.GetVal(hdr, "k", th, nil).String())
+		}
+		return list
+	}
+	for _, sort := range []string{"sort v", "sort reverse v"} {
+		all := get(fmt.Sprintf("tmp %s limit %d", sort, n))
+		assert.T(t).This(len(all)).Is(n)
+		for _, size := range []int{1, 3, 7} {
+			var pages []string
+			for off := 0; off < n; off += size {
+				pages = append(pages, get(fmt.Sprintf("tmp %s limit %d offset %d",
+					sort, size, off))...)
+			}
+			assert.T(t).This(pages).Is(all)
+		}
+	}
+}
@@ -77,6 +77,10 @@ func (q *Table) ValueGet(key Value) Value {
 		return SuStr(q.name)
 	case SuStr("strategy"):
 		return SuStr(q.String())
+	case SuStr("asof"):
+		if q.asof != NilDate {
+			return q.asof
+		}
 	}
 	return qryBase(q, key)
 }
@@ -257,6 +261,30 @@ func (q *Where) ValueGet(key Value) Value {
 	return query1(q, key)
 }
 
+func (q *Window) ValueGet(key Value) Value {
+	switch key {
+	case SuStr("type"):
+		return SuStr("window")
+	case SuStr("string"):
+		return SuStr(format1(q))
+	case SuStr("strategy"):
+		return SuStr(q.stringOp())
+	}
+	return query1(q, key)
+}
+
+func (q *Limit) ValueGet(key Value) Value {
+	switch key {
+	case SuStr("type"):
+		return SuStr("limit")
+	case SuStr("string"):
+		return SuStr(format1(q))
+	case SuStr("strategy"):
+		return SuStr(q.stringOp())
+	}
+	return query1(q, key)
+}
+
 func (q *View) ValueGet(key Value) Value {
 	switch key {
 	case SuStr("type"):
@@ -356,3 +384,30 @@ func (q *LeftJoin) ValueGet(key Value) Value {
 	}
 	return query2(q, key)
 }
+
+func (q *OuterJoin) ValueGet(key Value) Value {
+	switch key {
+	case SuStr("type"):
+		return SuStr("outerjoin")
+	case SuStr("string"):
+		return SuStr(format1(q))
+	case SuStr("strategy"):
+		return SuStr(q.stringOp())
+	}
+	return query2(q, key)
+}
+
+func (q *SemiJoin) ValueGet(key Value) Value {
+	switch key {
+	case SuStr("type"):
+		if q.anti {
+			return SuStr("antijoin")
+		}
+		return SuStr("semijoin")
+	case SuStr("string"):
+		return SuStr(format1(q))
+	case SuStr("strategy"):
+		return SuStr(q.stringOp())
+	}
+	return query2(q, key)
+}
@@ -0,0 +1,373 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"log"
+	"slices"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19/index/ixkey"
+	"github.com/apmckinlay/gsuneido/util/str"
+)
+
+// SemiJoin returns the rows from source1 that have a match in source2.
+// If anti is true (antijoin) it returns the rows that do not have a match.
+// Unlike Join, the result only has the columns from source1
+// and each source1 row is output at most once.
+type SemiJoin struct {
+	keys2 map[string]struct{} // for semiMap
+	joinBase
+	semiApproach
+	dir2    Dir // for semiMerge, the direction source2 is being read
+	anti    bool
+	rewound bool
+}
+
+type semiApproach struct {
+	index1 []string
+	index2 []string
+	// mergeCols are the by columns in the order of the merge indexes
+	mergeCols []string
+	frac2     float64
+	strategy  semiStrategy
+}
+
+type semiStrategy int
+
+const (
+	// semiLookup does a Select on source2 for each source1 row
+	semiLookup semiStrategy = iota + 1
+	// semiMap reads the by values from source2 into a map.
+	// It is not incremental, it must read all of source2 first.
+	semiMap
+	// semiMerge reads both sources in the same by order
+	semiMerge
+)
+
+func NewSemiJoin(src1, src2 Query, by []string, t QueryTran) *SemiJoin {
+	return newSemiJoin(src1, src2, by, t, false, nil, nil)
+}
+
+func NewAntiJoin(src1, src2 Query, by []string, t QueryTran) *SemiJoin {
+	return newSemiJoin(src1, src2, by, t, true, nil, nil)
+}
+
+func newSemiJoin(src1, src2 Query, by []string, t QueryTran, anti bool,
+	prevFixed1, prevFixed2 []Fixed) *SemiJoin {
+	sj := &SemiJoin{anti: anti, joinBase: newJoinBase(src1, src2, by, t,
+		prevFixed1, prevFixed2)}
+	sj.header = src1.Header()
+	sj.keys = src1.Keys()
+	sj.indexes = src1.Indexes()
+	sj.fixed = src1.Fixed()
+	sj.setNrows(sj.getNrows())
+	sj.rowSiz.Set(src1.rowSize())
+	sj.fast1.Set(src1.fastSingle())
+	sj.lookCost.Set(src1.lookupCost() + src2.lookupCost())
+	return sj
+}
+
+func (sj *SemiJoin) With(src1, src2 Query) *SemiJoin {
+	return newSemiJoin(src1, src2, sj.by, sj.qt, sj.anti,
+		sj.prevFixed1, sj.prevFixed2)
+}
+
+func (sj *SemiJoin) String() string {
+	return parenQ2(sj.source1) + " " + sj.stringOp() + " " + paren(sj.source2)
+}
+
+func (sj *SemiJoin) stringOp() string {
+	s := "SEMIJOIN"
+	if sj.anti {
+		s = "ANTIJOIN"
+	}
+	switch sj.strategy {
+	case semiLookup:
+		s += "-LOOKUP"
+	case semiMap:
+		s += "-MAP"
+	case semiMerge:
+		s += "-MERGE"
+	}
+	return s + " by" + str.Join("(,)", sj.by)
+}
+
+func (sj *SemiJoin) format() string {
+	if sj.anti {
+		return "antijoin by" + str.Join("(,)", sj.by)
+	}
+	return "semijoin by" + str.Join("(,)", sj.by)
+}
+
+func (sj *SemiJoin) SetTran(t QueryTran) {
+	sj.joinBase.SetTran(t)
+	sj.keys2 = nil
+}
+
+// Updateable is allowed since the rows are unchanged source1 rows
+func (sj *SemiJoin) Updateable() string {
+	return sj.source1.Updateable()
+}
+
+func (sj *SemiJoin) getNrows() (int, int) {
+	n1, p1 := sj.source1.Nrows()
+	return n1 / 2, p1 // ??? estimate half
+}
+
+func (sj *SemiJoin) Transform() Query {
+	src1 := sj.source1.Transform()
+	if _, ok := src1.(*Nothing); ok {
+		return NewNothing(sj)
+	}
+	src2 := sj.source2.Transform()
+	_, src2Nothing := src2.(*Nothing)
+	fix1, fix2 := src1.Fixed(), src2.Fixed()
+	if src2Nothing || fixedConflict(fix1, fix2) {
+		// nothing can match
+		if sj.anti {
+			return src1
+		}
+		return NewNothing(sj)
+	}
+	if !equalFixed(fix1, sj.prevFixed1) || !equalFixed(fix2, sj.prevFixed2) {
+		src2 = copyFixed(fix1, fix2, src2, sj.by, sj.qt)
+		if !sj.anti {
+			// only rows that match can be output
+			src1 = copyFixed(fix2, fix1, src1, sj.by, sj.qt)
+		}
+		sj.prevFixed1, sj.prevFixed2 = fix1, fix2
+	}
+	if src1 != sj.source1 || src2 != sj.source2 {
+		return sj.With(src1, src2).Transform()
+	}
+	return sj
+}
+
+func (sj *SemiJoin) optimize(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	lookup := sj.lookupJoinCost(mode, index, frac)
+	lookupApp := &semiApproach{strategy: semiLookup, index1: lookup.index1,
+		index2: lookup.index2, frac2: lookup.frac2}
+	mapFixCost, mapVarCost, mapApp := sj.mapCost(mode, index, frac)
+	mergeFixCost, mergeVarCost, mergeApp := sj.mergeCost(mode, index, frac)
+	fixcost, varcost, approach := min3(
+		lookup.fixcost, lookup.varcost, lookupApp,
+		mapFixCost, mapVarCost, mapApp,
+		mergeFixCost, mergeVarCost, mergeApp)
+	if fixcost >= impossible {
+		return impossible, impossible, nil
+	}
+	return fixcost, varcost, approach
+}
+
+func (sj *SemiJoin) lookupJoinCost(mode Mode, index []string, frac float64) joinCost {
+	// each lookup reads at most one row from source2
+	read2 := func() (int, int) {
+		n1, _ := sj.source1.Nrows()
+		n2, _ := sj.source2.Nrows()
+		return min(n1, n2), 0
+	}
+	return joinopt(sj.source1, sj.source2, read2,
+		mode, index, frac, sj.by, sj.fixed)
+}
+
+func (sj *SemiJoin) mapCost(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	nrows2, _ := sj.source2.Nrows()
+	if mode != ReadMode || nrows2 > mapThreshold {
+		return impossible, impossible, nil
+	}
+	fixcost1, varcost1, index1 := optOrdered(sj.source1, mode, index, frac,
+		sj.fixed)
+	fixcost2, varcost2 := Optimize(sj.source2, mode, nil, 1)
+	fixcost := fixcost2 + varcost2 + nrows2*20 // ???
+	return fixcost1 + fixcost, varcost1,
+		&semiApproach{strategy: semiMap, index1: index1, frac2: 1}
+}
+
+// mergeCost is the cost of reading both sources
+// by indexes with the by columns as a prefix, in the same order
+func (sj *SemiJoin) mergeCost(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	bestFixCost, bestVarCost := impossible, impossible
+	var approach semiApproach
+	mergeIndexes([][]string{sj.by}, sj.source1.Indexes(), sj.source2.Indexes(),
+		func(by []string, i1, i2 int) {
+			index1, index2 := by, by
+			if i1 != -1 {
+				index1 = sj.source1.Indexes()[i1]
+				index2 = sj.source2.Indexes()[i2]
+			}
+			if index != nil && !slices.Equal(index, index1) {
+				return
+			}
+			fixcost1, varcost1 := Optimize(sj.source1, mode, index1, frac)
+			fixcost2, varcost2 := Optimize(sj.source2, mode, index2, frac)
+			if fixcost1+varcost1+fixcost2+varcost2 < bestFixCost+bestVarCost {
+				bestFixCost = fixcost1 + fixcost2
+				bestVarCost = varcost1 + varcost2
+				approach = semiApproach{strategy: semiMerge, index1: index1,
+					index2: index2, mergeCols: index1[:len(by)], frac2: frac}
+			}
+		})
+	return bestFixCost, bestVarCost, &approach
+}
+
+func (sj *SemiJoin) setApproach(_ []string, frac float64, approach any, tran QueryTran) {
+	sj.semiApproach = *approach.(*semiApproach)
+	sj.source1 = SetApproach(sj.source1, sj.index1, frac, tran)
+	sj.source2 = SetApproach(sj.source2, sj.index2, sj.frac2, tran)
+	sj.header = sj.source1.Header()
+	sj.rewound = true
+}
+
+// execution --------------------------------------------------------
+
+func (sj *SemiJoin) Rewind() {
+	sj.source1.Rewind()
+	sj.rewound = true
+}
+
+func (sj *SemiJoin) Get(th *Thread, dir Dir) Row {
+	for {
+		row := sj.source1.Get(th, dir)
+		if row == nil || sj.matches(th, row, dir) {
+			return row
+		}
+	}
+}
+
+// matches returns whether a source1 row should be output
+func (sj *SemiJoin) matches(th *Thread, row1 Row, dir Dir) bool {
+	return sj.source2Has(th, row1, dir) != sj.anti
+}
+
+func (sj *SemiJoin) source2Has(th *Thread, row1 Row, dir Dir) bool {
+	switch sj.strategy {
+	case semiMap:
+		if sj.keys2 == nil {
+			sj.buildMap(th)
+		}
+		_, ok := sj.keys2[sj.byKey(sj.projectRow1(th, row1))]
+		return ok
+	case semiMerge:
+		return sj.mergeHas(th, row1, dir)
+	}
+	return sj.lookupHas(th, row1)
+}
+
+func (sj *SemiJoin) lookupHas(th *Thread, row1 Row) bool {
+	sj.source2.Select(sj.by, sj.projectRow1(th, row1))
+	return sj.source2.Get(th, Next) != nil
+}
+
+// mergeHas advances source2 (in dir) to the first row
+// that is not before row1 and returns whether it matches.
+// sj.row2 is left on that row since the next row1 may have the same by.
+// If the direction changes, the rows before sj.row2 in the new direction
+// are the ones that have not been passed over.
+func (sj *SemiJoin) mergeHas(th *Thread, row1 Row, dir Dir) bool {
+	if sj.rewound || (dir != sj.dir2 && sj.row2 == nil) {
+		sj.source2.Rewind()
+		sj.row2 = sj.source2.Get(th, dir)
+		sj.rewound = false
+	}
+	sj.dir2 = dir
+	key1 := sj.projectMerge(th, sj.source1, row1)
+	for sj.row2 != nil {
+		c := slices.Compare(sj.projectMerge(th, sj.source2, sj.row2), key1)
+		if dir == Prev {
+			c = -c
+		}
+		if c >= 0 {
+			return c == 0
+		}
+		sj.row2 = sj.source2.Get(th, dir)
+	}
+	return false
+}
+
+func (sj *SemiJoin) projectMerge(th *Thread, src Query, row Row) []string {
+	hdr := src.Header()
+	key := make([]string, len(sj.mergeCols))
+	for i, col := range sj.mergeCols {
+		key[i] = row.GetRawVal(hdr, col, th, sj.st)
+	}
+	return key
+}
+
+func (sj *SemiJoin) buildMap(th *Thread) {
+	sj.keys2 = make(map[string]struct{})
+	warned := false
+	sj.source2.Rewind()
+	for {
+		row := sj.source2.Get(th, Next)
+		if row == nil {
+			break
+		}
+		sj.keys2[sj.byKey(sj.projectRow2(th, row))] = struct{}{}
+		if !warned && len(sj.keys2) > mapWarn {
+			// log inside loop in case we run out of memory
+			warned = true
+			Warning("semijoin-map large >", mapWarn)
+		}
+	}
+	if len(sj.keys2) > 2*mapWarn {
+		log.Println("semijoin-map large =", len(sj.keys2))
+	}
+}
+
+func (sj *SemiJoin) byKey(vals []string) string {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	var enc ixkey.Encoder
+	for _, v := range vals {
+		enc.Add(v)
+	}
+	return enc.String()
+}
+
+func (sj *SemiJoin) Select(cols, vals []string) {
+	sj.source1.Select(cols, vals)
+	sj.rewound = true
+}
+
+func (sj *SemiJoin) Lookup(th *Thread, cols, vals []string) Row {
+	row := sj.source1.Lookup(th, cols, vals)
+	if row == nil {
+		return nil
+	}
+	var has bool
+	if sj.strategy == semiMerge {
+		// a single row is not in order, so look it up
+		has = sj.lookupHas(th, row)
+		sj.source2.Select(nil, nil)
+		sj.rewound = true
+	} else {
+		has = sj.source2Has(th, row, Next)
+	}
+	if has == sj.anti {
+		return nil
+	}
+	return row
+}
+
+func (sj *SemiJoin) Simple(th *Thread) []Row {
+	rows1 := sj.source1.Simple(th)
+	rows2 := sj.source2.Simple(th)
+	dst := 0
+	for _, row1 := range rows1 {
+		has := false
+		for _, row2 := range rows2 {
+			if sj.equalBy(th, sj.st, row1, row2) {
+				has = true
+				break
+			}
+		}
+		if has != sj.anti {
+			rows1[dst] = row1
+			dst++
+		}
+	}
+	return rows1[:dst]
+}
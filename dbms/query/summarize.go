@@ -6,11 +6,16 @@ package query
 import (
 	"fmt"
 	"log"
+	"math"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/core/types"
 	"github.com/apmckinlay/gsuneido/util/assert"
+	"github.com/apmckinlay/gsuneido/util/dnum"
 	"github.com/apmckinlay/gsuneido/util/generic/hmap"
 	"github.com/apmckinlay/gsuneido/util/generic/set"
 	"github.com/apmckinlay/gsuneido/util/generic/slc"
@@ -23,10 +28,11 @@ type Summarize struct {
 	get func(th *Thread, su *Summarize, dir Dir) Row
 	st  *SuTran
 	by  []string
-	// cols, ops, and ons are parallel
-	cols []string
-	ops  []string
-	ons  []string
+	// cols, ops, ons, and params are parallel
+	cols   []string
+	ops    []string
+	ons    []string
+	params []sumParam
 	summarizeApproach
 	wholeRow bool
 	rewound  bool
@@ -43,6 +49,13 @@ type summarizeApproach struct {
 
 type sumStrategy int
 
+// sumParam holds the arguments for percentile(pct) and concat(sep, sort)
+type sumParam struct {
+	pct    float64
+	sep    string
+	sorted bool
+}
+
 type sumHint string
 
 const (
@@ -62,7 +75,8 @@ const (
 	sumTbl
 )
 
-func NewSummarize(src Query, hint sumHint, by, cols, ops, ons []string) *Summarize {
+func NewSummarize(src Query, hint sumHint, by, cols, ops, ons []string,
+	params []sumParam) *Summarize {
 	if !set.Subset(src.Columns(), by) {
 		panic("summarize: nonexistent columns: " +
 			str.Join(", ", set.Difference(by, src.Columns())))
@@ -71,10 +85,14 @@ func NewSummarize(src Query, hint sumHint, by, cols, ops, ons []string) *Summari
 	check(ons)
 	for i := 0; i < len(cols); i++ {
 		if cols[i] == "" {
-			cols[i] = defaultColName(ops[i], ons[i])
+			cols[i] = defaultColName(ops[i], ons[i], params[i])
 		}
 	}
-	su := &Summarize{hint: hint, by: by, cols: cols, ops: ops, ons: ons}
+	if len(set.Unique(cols)) != len(cols) {
+		panic("summarize: duplicate result columns, use name = op to rename")
+	}
+	su := &Summarize{hint: hint, by: by, cols: cols, ops: ops, ons: ons,
+		params: params}
 	su.source = src
 	sort.Stable(su)
 	su.unique = hasKey(cols, src.Keys(), src.Fixed())
@@ -91,10 +109,15 @@ func NewSummarize(src Query, hint sumHint, by, cols, ops, ons []string) *Summari
 	return su
 }
 
-func defaultColName(op, on string) string {
+// defaultColName returns e.g. total_cost or percentile90_cost
+func defaultColName(op, on string, param sumParam) string {
 	if op == "count" {
 		return "count"
 	}
+	if op == "percentile" {
+		pct := strconv.FormatFloat(param.pct, 'f', -1, 64)
+		op += strings.ReplaceAll(pct, ".", "_")
+	}
 	return op + "_" + on
 }
 
@@ -109,6 +132,7 @@ func (su *Summarize) Swap(i, j int) {
 	su.ons[i], su.ons[j] = su.ons[j], su.ons[i]
 	su.cols[i], su.cols[j] = su.cols[j], su.cols[i]
 	su.ops[i], su.ops[j] = su.ops[j], su.ops[i]
+	su.params[i], su.params[j] = su.params[j], su.params[i]
 }
 
 func check(cols []string) {
@@ -161,10 +185,10 @@ func (su *Summarize) string2() string {
 	for i := range su.cols {
 		s += sep
 		sep = ", "
-		if su.cols[i] != defaultColName(su.ops[i], su.ons[i]) {
+		if su.cols[i] != defaultColName(su.ops[i], su.ons[i], su.params[i]) {
 			s += su.cols[i] + " = "
 		}
-		s += su.ops[i]
+		s += su.ops[i] + su.params[i].string(su.ops[i])
 		if su.ops[i] != "count" {
 			s += " " + su.ons[i]
 		}
@@ -172,6 +196,23 @@ func (su *Summarize) string2() string {
 	return s
 }
 
+func (sp sumParam) string(op string) string {
+	switch op {
+	case "percentile":
+		return "(" + strconv.FormatFloat(sp.pct, 'g', -1, 64) + ")"
+	case "concat":
+		if sp.sep == "" && !sp.sorted {
+			return ""
+		}
+		s := "(" + SuStr(sp.sep).String()
+		if sp.sorted {
+			s += ", sort"
+		}
+		return s + ")"
+	}
+	return ""
+}
+
 func (su *Summarize) format() string {
 	return "summarize" + str.Opt("/*", string(su.hint), "*/") + su.string2()
 }
@@ -205,10 +246,12 @@ func (su *Summarize) Transform() Query {
 	}
 	if p, ok := src.(*Project); ok && p.unique {
 		// remove project-copy
-		return NewSummarize(p.source, su.hint, su.by, su.cols, su.ops, su.ons)
+		return NewSummarize(p.source, su.hint, su.by, su.cols, su.ops, su.ons,
+			su.params)
 	}
 	if src != su.source {
-		return NewSummarize(src, su.hint, su.by, su.cols, su.ops, su.ons)
+		return NewSummarize(src, su.hint, su.by, su.cols, su.ops, su.ons,
+			su.params)
 	}
 	return su
 }
@@ -267,7 +310,8 @@ func (su *Summarize) mapCost(mode Mode, index []string, _ float64) (Cost, Cost,
 	// WARNING technically, map should only be allowed in ReadMode
 	nrows, _ := su.Nrows()
 	if index != nil || su.hint == sumLarge ||
-		(nrows > mapThreshold && su.hint != sumSmall) {
+		(nrows > mapThreshold && su.hint != sumSmall) ||
+		(su.keepsValues() && su.hint != sumSmall) {
 		return impossible, impossible, nil
 	}
 	fixcost, varcost := Optimize(su.source, mode, nil, 1)
@@ -275,6 +319,18 @@ func (su *Summarize) mapCost(mode Mode, index []string, _ float64) (Cost, Cost,
 	return fixcost + varcost, 0, &summarizeApproach{strategy: sumMap, frac: 1}
 }
 
+// keepsValues returns whether any of the ops keep the values for each group.
+// sumMap would keep them for all the groups at once.
+func (su *Summarize) keepsValues() bool {
+	for _, op := range su.ops {
+		switch op {
+		case "countdistinct", "median", "percentile", "concat":
+			return true
+		}
+	}
+	return false
+}
+
 func (su *Summarize) setApproach(_ []string, frac float64, approach any, tran QueryTran) {
 	su.summarizeApproach = *approach.(*summarizeApproach)
 	switch su.strategy {
@@ -505,6 +561,7 @@ func (t *sumSeqT) getSeq(th *Thread, su *Summarize, dir Dir) Row {
 }
 
 func (su *Summarize) addToSums(sums []sumOp, row Row, th *Thread, st *SuTran) {
+	th.LimitTime()
 	for i := 0; i < len(su.ons); {
 		raw := "*uninit*"
 		var val Value
@@ -512,12 +569,12 @@ func (su *Summarize) addToSums(sums []sumOp, row Row, th *Thread, st *SuTran) {
 			switch su.ops[i] {
 			case "count":
 				sums[i].add("", nil, row)
-			case "list", "min", "max":
+			case "list", "min", "max", "countdistinct", "concat":
 				if raw == "*uninit*" {
 					raw = row.GetRawVal(su.source.Header(), col, th, st)
 				}
 				sums[i].add(raw, nil, row)
-			default: // total, average
+			default: // total, average, median, percentile, stddev, variance
 				if val == nil {
 					val = row.GetVal(su.source.Header(), col, th, st)
 				}
@@ -570,12 +627,12 @@ func (*Summarize) Simple(*Thread) []Row {
 func (su *Summarize) newSums() []sumOp {
 	sums := make([]sumOp, len(su.ops))
 	for i, op := range su.ops {
-		sums[i] = newSumOp(op)
+		sums[i] = newSumOp(op, su.params[i])
 	}
 	return sums
 }
 
-func newSumOp(op string) sumOp {
+func newSumOp(op string, param sumParam) sumOp {
 	switch op {
 	case "count":
 		return &sumCount{}
@@ -589,6 +646,18 @@ func newSumOp(op string) sumOp {
 		return &sumMax{}
 	case "list":
 		return sumList(make(map[string]struct{}))
+	case "countdistinct":
+		return sumCountDistinct(make(map[string]struct{}))
+	case "median":
+		return &sumPercentile{pct: 50}
+	case "percentile":
+		return &sumPercentile{pct: param.pct}
+	case "stddev":
+		return &sumVariance{stddev: true}
+	case "variance":
+		return &sumVariance{}
+	case "concat":
+		return &sumConcat{sep: param.sep, sorted: param.sorted}
 	}
 	panic(assert.ShouldNotReachHere())
 }
@@ -710,3 +779,145 @@ func (sum sumList) reset() {
 		delete(sum, k)
 	}
 }
+
+type sumCountDistinct map[string]struct{}
+
+func (sum sumCountDistinct) add(raw string, _ Value, _ Row) {
+	sum[raw] = struct{}{}
+}
+func (sum sumCountDistinct) result() (Value, Row) {
+	return IntVal(len(sum)), nil
+}
+func (sum sumCountDistinct) reset() {
+	clear(sum)
+}
+
+// sumPercentile is used for median and percentile.
+// It ignores non-numeric values.
+// It interpolates between the closest values.
+type sumPercentile struct {
+	vals []Value
+	pct  float64
+}
+
+func (sum *sumPercentile) add(_ string, val Value, _ Row) {
+	if val.Type() == types.Number {
+		sum.vals = append(sum.vals, val)
+	}
+}
+func (sum *sumPercentile) result() (Value, Row) {
+	n := len(sum.vals)
+	if n == 0 {
+		return EmptyStr, nil
+	}
+	slices.SortFunc(sum.vals, func(x, y Value) int { return x.Compare(y) })
+	rank := sum.pct / 100 * float64(n-1)
+	i := int(rank)
+	x := sum.vals[i]
+	f := rank - float64(i)
+	if f == 0 || i+1 >= n {
+		return x, nil
+	}
+	y := sum.vals[i+1]
+	return OpAdd(x, OpMul(OpSub(y, x), SuDnum{Dnum: dnum.FromFloat(f)})), nil
+}
+func (sum *sumPercentile) reset() {
+	sum.vals = sum.vals[:0]
+}
+
+// sumVariance is used for stddev and variance (of a sample).
+// It ignores non-numeric values.
+// It does not need to keep the values.
+// It uses Dnum like the other ops, accumulating the differences
+// from the first value to avoid losing precision.
+type sumVariance struct {
+	n      int
+	first  dnum.Dnum
+	sum    dnum.Dnum // of differences from first
+	sumsq  dnum.Dnum // of squared differences from first
+	stddev bool
+}
+
+func (sum *sumVariance) add(_ string, val Value, _ Row) {
+	if val.Type() != types.Number {
+		return
+	}
+	x := ToDnum(val)
+	if sum.n == 0 {
+		sum.first = x
+	}
+	sum.n++
+	d := dnum.Sub(x, sum.first)
+	sum.sum = dnum.Add(sum.sum, d)
+	sum.sumsq = dnum.Add(sum.sumsq, dnum.Mul(d, d))
+}
+func (sum *sumVariance) result() (Value, Row) {
+	if sum.n < 2 {
+		return Zero, nil
+	}
+	n := dnum.FromInt(int64(sum.n))
+	v := dnum.Div(
+		dnum.Sub(sum.sumsq, dnum.Div(dnum.Mul(sum.sum, sum.sum), n)),
+		dnum.FromInt(int64(sum.n-1)))
+	if sum.stddev {
+		v = dnumSqrt(v)
+	}
+	return SuDnum{Dnum: v}, nil
+}
+func (sum *sumVariance) reset() {
+	*sum = sumVariance{stddev: sum.stddev}
+}
+
+// dnumSqrt starts from the float square root
+// and refines it with Newton's method to the full Dnum precision
+func dnumSqrt(x dnum.Dnum) dnum.Dnum {
+	if x.Sign() <= 0 {
+		return dnum.Zero
+	}
+	y := dnum.FromFloat(math.Sqrt(x.ToFloat()))
+	two := dnum.FromInt(2)
+	for range 3 {
+		y2 := dnum.Div(dnum.Add(y, dnum.Div(x, y)), two)
+		if dnum.Equal(y2, y) {
+			break
+		}
+		y = y2
+	}
+	return y
+}
+
+// sumConcat joins the values (including duplicates) with a separator.
+// If not sorted, the values are in the order they were read.
+type sumConcat struct {
+	sep    string
+	raws   []string
+	size   int
+	sorted bool
+}
+
+const sumConcatLimit = 1_000_000 // ???
+
+func (sum *sumConcat) add(raw string, _ Value, _ Row) {
+	sum.raws = append(sum.raws, raw)
+	sum.size += len(raw) + len(sum.sep)
+	if sum.size > sumConcatLimit {
+		panic(fmt.Sprintf("summarize concat too large (> %d)", sumConcatLimit))
+	}
+}
+func (sum *sumConcat) result() (Value, Row) {
+	if sum.sorted {
+		slices.Sort(sum.raws) // packed values sort the same as the values
+	}
+	var sb strings.Builder
+	for i, raw := range sum.raws {
+		if i > 0 {
+			sb.WriteString(sum.sep)
+		}
+		sb.WriteString(ToStrOrString(Unpack(raw)))
+	}
+	return SuStr(sb.String()), nil
+}
+func (sum *sumConcat) reset() {
+	sum.raws = sum.raws[:0]
+	sum.size = 0
+}
@@ -8,6 +8,7 @@ import (
 
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/core/trace"
+	"github.com/apmckinlay/gsuneido/db19"
 	"github.com/apmckinlay/gsuneido/db19/index"
 	"github.com/apmckinlay/gsuneido/db19/index/iterator"
 	"github.com/apmckinlay/gsuneido/db19/index/ixkey"
@@ -40,6 +41,7 @@ func NewTable(t QueryTran, name string) Query {
 
 type Table struct {
 	tran    QueryTran
+	asof    SuDate // for table asof, otherwise NilDate
 	iter    *index.OverIter
 	info    *meta.Info
 	schema  *Schema
@@ -55,18 +57,34 @@ type Table struct {
 	indexEncode bool
 }
 
+// NewTableAsof returns a Table that reads the table as of a past date,
+// regardless of the transaction used by the rest of the query.
+// It is not updateable.
+func NewTableAsof(t QueryTran, name string, asof SuDate) Query {
+	tbl := &Table{name: name, asof: asof}
+	tbl.SetTran(t)
+	return tbl
+}
+
 type tableApproach struct {
 	index []string
 }
 
 func (tbl *Table) String() string {
+	s := tbl.name
+	if tbl.asof != NilDate {
+		s += " asof " + tbl.asof.String()
+	}
 	if tbl.index == nil {
-		return tbl.name
+		return s
 	}
-	return tbl.name + "^" + str.Join("(,)", tbl.index)
+	return s + "^" + str.Join("(,)", tbl.index)
 }
 
 func (tbl *Table) SetTran(t QueryTran) {
+	if tbl.asof != NilDate {
+		t = asofTran(t, tbl.asof)
+	}
 	tbl.tran = t
 	tbl.schema = t.GetSchema(tbl.name)
 	if tbl.schema == nil {
@@ -103,6 +121,21 @@ func (tbl *Table) SetTran(t QueryTran) {
 	tbl.fast1.Set(len(tbl.keys) == 1 && len(tbl.keys[0]) == 0)
 }
 
+// asofTran returns a read transaction as of a date, for table asof.
+// It panics if the date is before the first persisted state
+// rather than silently reading a later state.
+func asofTran(t QueryTran, asof SuDate) QueryTran {
+	at, ok := t.(interface{ AsofTran(int64) *db19.ReadTran })
+	if !ok {
+		panic("query: table asof is not supported")
+	}
+	rt := at.AsofTran(asof.UnixMilli())
+	if rt.Asof(0) > asof.UnixMilli() {
+		panic("asof: no state at or before " + asof.String())
+	}
+	return rt
+}
+
 func (tbl *Table) Nrows() (int, int) {
 	return tbl.info.Nrows, tbl.info.Nrows
 }
@@ -123,6 +156,9 @@ func (tbl *Table) Fixed() []Fixed {
 }
 
 func (tbl *Table) Updateable() string {
+	if tbl.asof != NilDate {
+		return ""
+	}
 	return tbl.name
 }
 
@@ -190,11 +226,11 @@ func (tbl *Table) lookupCost() Cost {
 
 // execution --------------------------------------------------------
 
-func (tbl *Table) Lookup(_ *Thread, cols, vals []string) Row {
+func (tbl *Table) Lookup(th *Thread, cols, vals []string) Row {
 	assert.That(tbl.hasKey(cols))
 	assert.That(!selConflict(tbl.header.Columns, cols, vals))
 	key := selOrg(tbl.indexEncode, tbl.index, cols, vals, true)
-	return tbl.lookup(key)
+	return tbl.lookup(th, key)
 }
 
 func (tbl *Table) hasKey(cols []string) bool {
@@ -206,7 +242,8 @@ func (tbl *Table) hasKey(cols []string) bool {
 	return false
 }
 
-func (tbl *Table) lookup(key string) Row {
+func (tbl *Table) lookup(th *Thread, key string) Row {
+	th.LimitRead()
 	rec := tbl.tran.Lookup(tbl.name, tbl.iIndex, key)
 	if rec == nil {
 		return nil
@@ -215,6 +252,9 @@ func (tbl *Table) lookup(key string) Row {
 }
 
 func (tbl *Table) Output(th *Thread, rec Record) {
+	if tbl.asof != NilDate {
+		panic("query: can't output to table asof")
+	}
 	tbl.tran.Output(th, tbl.name, rec)
 }
 
@@ -224,7 +264,8 @@ func (tbl *Table) Rewind() {
 	}
 }
 
-func (tbl *Table) Get(_ *Thread, dir Dir) Row {
+func (tbl *Table) Get(th *Thread, dir Dir) Row {
+	th.LimitRead()
 	tbl.ensureIter()
 	if dir == Prev {
 		tbl.iter.Prev(tbl.tran)
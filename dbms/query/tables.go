@@ -0,0 +1,86 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"slices"
+
+	. "github.com/apmckinlay/gsuneido/core"
+)
+
+// QueryTables returns the names of the tables used by a query,
+// including system tables e.g. tables or columns.
+// Views are expanded to the tables they use.
+// It is used to check permissions.
+func QueryTables(src string, t QueryTran, sv *Sviews) []string {
+	return tables(ParseQuery(src, t, sv), nil)
+}
+
+// ActionTables returns the tables an action reads and the tables it writes.
+// It is used to check permissions.
+func ActionTables(src string, t QueryTran, sv *Sviews) (read, write []string) {
+	switch a := ParseAction(src, t, sv).(type) {
+	case *insertRecordAction:
+		return nil, tables(a.query, nil)
+	case *insertQueryAction:
+		return tables(a.query, nil), []string{a.table}
+	case *updateAction:
+		return nil, tables(a.query, nil)
+	case *deleteAction:
+		return nil, tables(a.query, nil)
+	case *upsertAction:
+		if a.query != nil {
+			return tables(a.query, nil), []string{a.table}
+		}
+		return nil, []string{a.table}
+	}
+	panic("ActionTables: unknown action")
+}
+
+func tables(q Query, list []string) []string {
+	add := func(table string) []string {
+		if table != "" && !slices.Contains(list, table) {
+			list = append(list, table)
+		}
+		return list
+	}
+	switch q := q.(type) {
+	case *Table:
+		return add(q.name)
+	case *Nothing:
+		return add(q.table)
+	case *Tables, *TablesLookup, *Columns, *Indexes, *Views, *History:
+		return add(q.String())
+	case q2i:
+		return tables(q.Source2(), tables(q.Source(), list))
+	case q1i:
+		return tables(q.Source(), list)
+	}
+	return list
+}
+
+// AdminTables returns the tables that an admin request modifies.
+// Views are in the views table, session views (sview) are not included.
+// It is used to check permissions.
+func AdminTables(src string) []string {
+	switch a := ParseAdmin(src).(type) {
+	case *createAdmin:
+		return []string{a.Table}
+	case *ensureAdmin:
+		return []string{a.Table}
+	case *alterCreateAdmin:
+		return []string{a.Table}
+	case *alterDropAdmin:
+		return []string{a.Table}
+	case *alterRenameAdmin:
+		return []string{a.table}
+	case *renameAdmin:
+		return []string{a.from, a.to}
+	case *dropAdmin:
+		return []string{a.table}
+	case *viewAdmin:
+		return []string{"views"}
+	}
+	return nil
+}
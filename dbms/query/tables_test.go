@@ -0,0 +1,56 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"testing"
+
+	. "github.com/apmckinlay/gsuneido/core"
+
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestQueryTables(t *testing.T) {
+	MakeSuTran = func(qt QueryTran) *SuTran { return nil }
+	test := func(query string, expected ...string) {
+		t.Helper()
+		assert.T(t).This(QueryTables(query, testTran{}, nil)).Is(expected)
+	}
+	test("table", "table")
+	test("table where a > 1 sort b", "table")
+	test("table join table2 extend x = 1", "table", "table2")
+	test("(customer union supplier) times table", "customer", "supplier", "table")
+	test("columns where table = 'table'", "columns")
+	test("tables leftjoin by(table) indexes", "tables", "indexes")
+}
+
+func TestActionTables(t *testing.T) {
+	MakeSuTran = func(qt QueryTran) *SuTran { return nil }
+	test := func(action string, read, write []string) {
+		t.Helper()
+		r, w := ActionTables(action, testTran{}, nil)
+		assert.T(t).This(r).Is(read)
+		assert.T(t).This(w).Is(write)
+	}
+	test("insert { a: 1 } into table", nil, []string{"table"})
+	test("insert table2 join table into table",
+		[]string{"table2", "table"}, []string{"table"})
+	test("update table where a = 1 set b = 2", nil, []string{"table"})
+	test("delete table2", nil, []string{"table2"})
+	test("upsert { a: 1 } into table", nil, []string{"table"})
+	test("upsert table2 into table", []string{"table2"}, []string{"table"})
+}
+
+func TestAdminTables(t *testing.T) {
+	test := func(admin string, expected ...string) {
+		t.Helper()
+		assert.T(t).This(AdminTables(admin)).Is(expected)
+	}
+	test("create tmp (a) key(a)", "tmp")
+	test("alter tmp drop (a)", "tmp")
+	test("rename tmp to tmp2", "tmp", "tmp2")
+	test("drop tmp", "tmp")
+	test("view v = tmp", "views")
+	test("sview v = tmp")
+}
@@ -4,8 +4,11 @@
 package query
 
 import (
+	"container/heap"
 	"log"
 	"slices"
+	"sort"
+	"strconv"
 
 	. "github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/db19/index/ixkey"
@@ -18,6 +21,9 @@ import (
 // It builds a sortlist of either DbRec or Row.
 // Keys are not constructed for the index or Lookup/Select
 // so there are no size limits.
+//
+// If top is set (by Limit) it only keeps the first top rows
+// (or the last if topLast) using a heap.
 type TempIndex struct {
 	tran   QueryTran
 	iter   rowIter
@@ -27,6 +33,8 @@ type TempIndex struct {
 	selOrg []string
 	selEnd []string
 	Query1
+	top     int
+	topLast bool
 	rewound bool
 }
 
@@ -58,7 +66,11 @@ func (ti *TempIndex) String() string {
 }
 
 func (ti *TempIndex) stringOp() string {
-	return "TEMPINDEX" + str.Join("(,)", ti.order)
+	s := "TEMPINDEX" + str.Join("(,)", ti.order)
+	if ti.top > 0 {
+		s += " TOP " + strconv.Itoa(ti.top)
+	}
+	return s
 }
 
 func (*TempIndex) Indexes() [][]string {
@@ -190,6 +202,9 @@ func (ti *TempIndex) makeIndex() rowIter {
 	ti.st = MakeSuTran(ti.tran)
 	// need to copy header to avoid data race from concurrent sortlist
 	ti.header = ti.source.Header().Dup()
+	if ti.top > 0 {
+		return ti.topRows()
+	}
 	if ti.source.SingleTable() {
 		return ti.single()
 	}
@@ -241,6 +256,7 @@ func (ti *TempIndex) single() rowIter {
 		if row == nil {
 			break
 		}
+		ti.th.LimitTempIndex(len(row[0].Record))
 		b.Add(row[0])
 		nrows++
 		if nrows > tempindexWarn && !warned {
@@ -255,7 +271,9 @@ func (ti *TempIndex) single() rowIter {
 	lt := func(rec DbRec, key []string) bool {
 		return ti.less2(ti.th, Row{rec}, key)
 	}
-	return singleIter{b.Finish().Iter(lt)}
+	list := b.Finish()
+	ti.th.LimitTime()
+	return singleIter{list.Iter(lt)}
 }
 
 func (ti *TempIndex) less(th *Thread, xrow, yrow Row) bool {
@@ -342,6 +360,7 @@ func (ti *TempIndex) multi() rowIter {
 			Warning("temp index large >", tempindexWarn)
 			warned = true
 		}
+		ti.th.LimitTempIndex(recordsSize(row))
 		derived += row.Derived()
 		if derived > derivedWarn && !derivedWarned {
 			Warning("temp index derived large >", derivedWarn,
@@ -361,7 +380,18 @@ func (ti *TempIndex) multi() rowIter {
 	lt := func(row Row, key []string) bool {
 		return ti.less2(ti.th, row, key)
 	}
-	return multiIter{b.Finish().Iter(lt)}
+	list := b.Finish()
+	ti.th.LimitTime()
+	return multiIter{list.Iter(lt)}
+}
+
+// recordsSize returns the total size of the records in a row
+func recordsSize(row Row) int {
+	n := 0
+	for _, dbrec := range row {
+		n += len(dbrec.Record)
+	}
+	return n
 }
 
 func (it multiIter) Seek(key []string) Row {
@@ -388,3 +418,125 @@ func (it multiIter) get() Row {
 	}
 	return it.iter.Cur()
 }
+
+//-------------------------------------------------------------------
+// topRows is used when a Limit only needs the first top rows.
+// It keeps them in a heap (with the last one at the root)
+// and then sorts them into a slice.
+// Ties are broken by source sequence so the rows kept (and their order)
+// are the same as a stable sort of all the rows,
+// regardless of top, so paging with limit/offset is consistent.
+
+func (ti *TempIndex) topRows() rowIter {
+	cmp := func(x, y heapRow) int {
+		if ti.less(ti.th, x.row, y.row) {
+			return -1
+		} else if ti.less(ti.th, y.row, x.row) {
+			return +1
+		}
+		return x.seq - y.seq
+	}
+	h := &rowHeap{before: func(x, y heapRow) bool { return cmp(x, y) < 0 }}
+	if ti.topLast {
+		h.before = func(x, y heapRow) bool { return cmp(y, x) < 0 }
+	}
+	for seq := 0; ; seq++ {
+		row := ti.source.Get(ti.th, Next)
+		if row == nil {
+			break
+		}
+		// only the rows kept in the heap count towards the limit
+		ti.th.LimitTempIndex(h.add(heapRow{row: row, seq: seq}, ti.top))
+	}
+	slices.SortStableFunc(h.rows, cmp)
+	rows := make([]Row, len(h.rows))
+	for i, hr := range h.rows {
+		rows[i] = hr.row
+	}
+	ti.th.LimitTime()
+	// NOTE: the closure captures ti not ti.th
+	lt := func(row Row, key []string) bool {
+		return ti.less2(ti.th, row, key)
+	}
+	return &sliceIter{rows: rows, lt: lt, pos: -1, rewound: true}
+}
+
+// heapRow is a row and its position in the source
+type heapRow struct {
+	row Row
+	seq int
+}
+
+type rowHeap struct {
+	rows   []heapRow
+	before func(x, y heapRow) bool
+}
+
+// add keeps row if it is one of the first keep rows.
+// It returns the change in the size of the kept rows.
+func (h *rowHeap) add(hr heapRow, keep int) int {
+	if len(h.rows) < keep {
+		heap.Push(h, hr)
+		return recordsSize(hr.row)
+	} else if h.before(hr, h.rows[0]) {
+		old := h.rows[0]
+		h.rows[0] = hr
+		heap.Fix(h, 0)
+		return recordsSize(hr.row) - recordsSize(old.row)
+	}
+	return 0
+}
+
+func (h *rowHeap) Len() int           { return len(h.rows) }
+func (h *rowHeap) Less(i, j int) bool { return h.before(h.rows[j], h.rows[i]) }
+func (h *rowHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+
+func (h *rowHeap) Push(x any) {
+	h.rows = append(h.rows, x.(heapRow))
+}
+
+func (h *rowHeap) Pop() any {
+	panic(assert.ShouldNotReachHere())
+}
+
+type sliceIter struct {
+	rows    []Row
+	lt      func(row Row, key []string) bool
+	pos     int
+	rewound bool
+}
+
+func (it *sliceIter) Seek(key []string) Row {
+	it.rewound = false
+	it.pos = sort.Search(len(it.rows), func(i int) bool {
+		return !it.lt(it.rows[i], key)
+	})
+	return it.get()
+}
+
+func (it *sliceIter) Rewind() {
+	it.rewound = true
+}
+
+func (it *sliceIter) Get(dir Dir) Row {
+	if it.rewound {
+		it.rewound = false
+		if dir == Next {
+			it.pos = 0
+		} else {
+			it.pos = len(it.rows) - 1
+		}
+	} else if dir == Next {
+		it.pos = min(it.pos+1, len(it.rows))
+	} else {
+		it.pos = max(it.pos-1, -1)
+	}
+	return it.get()
+}
+
+func (it *sliceIter) get() Row {
+	if it.pos < 0 || it.pos >= len(it.rows) {
+		return nil
+	}
+	return it.rows[it.pos]
+}
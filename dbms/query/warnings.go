@@ -63,6 +63,10 @@ func warnings(query string, q Query) int { // recursive
 		if q.joinType == n_n {
 			w |= joinManyToMany
 		}
+	case *OuterJoin:
+		if q.joinType == n_n {
+			w |= joinManyToMany
+		}
 	case *Where:
 		if _, ok := q.source.(*Where); ok {
 			log.Print("ERROR: transform did not merge where\n", query)
@@ -8,6 +8,7 @@ import (
 	"math"
 
 	"slices"
+	"sync/atomic"
 
 	"github.com/apmckinlay/gsuneido/compile/ast"
 	tok "github.com/apmckinlay/gsuneido/compile/tokens"
@@ -342,7 +343,29 @@ func (w *Where) Transform() Query {
 		}
 		src := NewWhere(q.source,
 			&ast.Nary{Tok: tok.And, Exprs: before}, w.t)
-		q = NewSummarize(src, q.hint, q.by, q.cols, q.ops, q.ons)
+		q = NewSummarize(src, q.hint, q.by, q.cols, q.ops, q.ons, q.params)
+		if after == nil {
+			return q.Transform()
+		}
+		e := &ast.Nary{Tok: tok.And, Exprs: after}
+		return NewWhere(q, e, w.t).Transform()
+	case *Window:
+		// move where on the partition columns before window
+		var before, after []ast.Expr
+		for _, e := range w.expr.Exprs {
+			if set.Subset(q.by, e.Columns()) {
+				before = append(before, e)
+			} else {
+				after = append(after, e)
+			}
+		}
+		if before == nil { // no split
+			return w.transform(src)
+		}
+		src := NewWhere(q.source,
+			&ast.Nary{Tok: tok.And, Exprs: before}, w.t)
+		q = NewWindow(src, q.by, q.reverse, q.order,
+			q.cols, q.fns, q.ons, q.offsets)
 		if after == nil {
 			return q.Transform()
 		}
@@ -376,6 +399,10 @@ func (w *Where) Transform() Query {
 		return w.split(q, func(src1, src2 Query) Query {
 			return q.With(src1, src2).Transform()
 		})
+	case *SemiJoin:
+		// all the columns are from source1
+		src1 := NewWhere(q.source1, w.expr, w.t)
+		return q.With(src1, q.source2).Transform()
 	case *LeftJoin:
 		if w.leftJoinToJoin(q) {
 			return w.split(q, func(src1, src2 Query) Query {
@@ -667,7 +694,7 @@ func (w *Where) get(th *Thread, dir Dir) Row {
 		if w.curPtrng.isRange() {
 			w.tbl.SelectRaw(w.curPtrng.org, w.curPtrng.end)
 		} else { // point
-			if row := w.tbl.lookup(w.curPtrng.org); row != nil {
+			if row := w.tbl.lookup(th, w.curPtrng.org); row != nil {
 				w.nIn++
 				return row
 			}
@@ -813,8 +840,15 @@ func singletonFilter(
 	return true
 }
 
+// SlowQueries is the number of slow where's, used for metrics
+var SlowQueries atomic.Int64
+
 func (w *Where) slowQueries() {
-	if w.slow() && trace.SlowQuery.On() {
+	if !w.slow() {
+		return
+	}
+	SlowQueries.Add(1)
+	if trace.SlowQuery.On() {
 		trace.SlowQuery.Println(w.nIn, "->", w.nOut)
 		trace.Println(strategy(w, 1))
 		w.nIn = 0
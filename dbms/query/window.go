@@ -0,0 +1,488 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package query
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/util/generic/set"
+	"github.com/apmckinlay/gsuneido/util/str"
+)
+
+// Window is like Summarize except that it keeps every row.
+// It adds columns calculated over the rows in the same partition (by)
+// in the specified order (sort). For example:
+//
+//	window by customer sort date extend running = total(amount)
+//
+// count, total, average, min, and max are cumulative
+// i.e. they are over the partition rows up to and including the current row.
+// row_number, rank, and dense_rank number the rows in the partition,
+// rank and dense_rank give rows with equal sort values the same number.
+// lag(col [,n]) and lead(col [,n]) give the value of col
+// from n rows before or after in the partition, or "" if there is none.
+//
+// Window reads a partition at a time so it can calculate lead.
+type Window struct {
+	Query1
+	t       QueryTran
+	st      *SuTran
+	by      []string
+	order   []string
+	reverse bool
+	// cols, fns, ons, and offsets are parallel
+	cols    []string
+	fns     []string
+	ons     []string
+	offsets []int
+	windowApproach
+	part    []Row // the current partition, in window order
+	pos     int
+	partDir Dir
+	nextRow Row // the row after the partition, in partDir
+	selCols []string
+	selVals []string
+	rewound bool
+}
+
+type windowApproach struct {
+	index []string
+}
+
+func NewWindow(src Query, by []string, reverse bool, order []string,
+	cols, fns, ons []string, offsets []int) *Window {
+	srcCols := src.Columns()
+	if !set.Subset(srcCols, by) {
+		panic("window: nonexistent columns: " +
+			str.Join(", ", set.Difference(by, srcCols)))
+	}
+	if !set.Subset(srcCols, order) {
+		panic("window: nonexistent columns: " +
+			str.Join(", ", set.Difference(order, srcCols)))
+	}
+	if !set.Disjoint(by, order) {
+		panic("window: sort columns can't be in by")
+	}
+	if !set.Disjoint(cols, srcCols) {
+		panic("window: column(s) already exist")
+	}
+	if len(set.Unique(cols)) != len(cols) {
+		panic("window: duplicate columns")
+	}
+	check(by)
+	check(order)
+	for i, fn := range fns {
+		checkWindowFn(fn, ons[i], offsets[i], srcCols)
+	}
+	w := &Window{by: by, reverse: reverse, order: order,
+		cols: cols, fns: fns, ons: ons, offsets: offsets}
+	w.source = src
+	w.header = w.getHeader()
+	w.keys = src.Keys()
+	if !reverse {
+		for _, ix := range src.Indexes() {
+			if w.windowed(ix) {
+				w.indexes = append(w.indexes, ix)
+			}
+		}
+	}
+	w.fixed = src.Fixed()
+	w.setNrows(src.Nrows())
+	w.rowSiz.Set(src.rowSize() + len(cols)*8) // ???
+	w.fast1.Set(src.fastSingle())
+	w.singleTbl.Set(false)
+	w.lookCost.Set(10 * src.lookupCost()) // ??? (like Summarize)
+	return w
+}
+
+func checkWindowFn(fn, on string, offset int, srcCols []string) {
+	switch fn {
+	case "count", "row_number", "rank", "dense_rank":
+		if on != "" {
+			panic("window: " + fn + " does not take a column")
+		}
+	case "total", "average", "min", "max", "lag", "lead":
+		if on == "" {
+			panic("window: " + fn + " requires a column")
+		}
+		if !slices.Contains(srcCols, on) {
+			panic("window: nonexistent column: " + on)
+		}
+	default:
+		panic("window: invalid function: " + fn)
+	}
+	if fn == "lag" || fn == "lead" {
+		if offset < 1 {
+			panic("window: " + fn + " offset must be greater than zero")
+		}
+	} else if offset != 0 {
+		panic("window: " + fn + " does not take an offset")
+	}
+}
+
+// windowed returns whether an index supplies the partition grouping
+// followed by the order, taking fixed into consideration
+func (w *Window) windowed(index []string) bool {
+	fixed := w.source.Fixed()
+	nByUnfixed := countUnfixed(w.by, fixed)
+	i, n := 0, 0
+	for ; i < len(index) && n < nByUnfixed; i++ {
+		if isSingleFixed(fixed, index[i]) {
+			continue
+		}
+		if !slices.Contains(w.by, index[i]) {
+			return false
+		}
+		n++
+	}
+	return n == nByUnfixed && ordered(index[i:], w.order, fixed)
+}
+
+func (w *Window) getHeader() *Header {
+	srchdr := w.source.Header()
+	cols := append(slices.Clip(srchdr.Columns), w.cols...)
+	flds := append(slices.Clip(srchdr.Fields), w.cols)
+	return NewHeader(flds, cols)
+}
+
+func (w *Window) SetTran(t QueryTran) {
+	w.t = t
+	w.st = MakeSuTran(t)
+	w.source.SetTran(t)
+}
+
+func (w *Window) String() string {
+	return parenQ2(w.source) + " " + w.stringOp()
+}
+
+func (w *Window) stringOp() string {
+	return "WINDOW" + w.string2()
+}
+
+func (w *Window) format() string {
+	return "window" + w.string2()
+}
+
+func (w *Window) string2() string {
+	s := ""
+	if len(w.by) > 0 {
+		s += " by " + str.Join(", ", w.by)
+	}
+	r := ""
+	if w.reverse {
+		r = "reverse"
+	}
+	s += " sort " + str.Opt(r, " ") + str.Join(", ", w.order)
+	sep := " extend "
+	for i, col := range w.cols {
+		s += sep + col + " = " + w.fns[i] + "(" + w.ons[i]
+		if w.offsets[i] > 1 {
+			s += ", " + strconv.Itoa(w.offsets[i])
+		}
+		s += ")"
+		sep = ", "
+	}
+	return s
+}
+
+func (w *Window) Updateable() string {
+	return ""
+}
+
+func (*Window) Output(*Thread, Record) {
+	panic("can't output to this query")
+}
+
+func (w *Window) Transform() Query {
+	src := w.source.Transform()
+	if _, ok := src.(*Nothing); ok {
+		return NewNothing(w)
+	}
+	if src != w.source {
+		return NewWindow(src, w.by, w.reverse, w.order,
+			w.cols, w.fns, w.ons, w.offsets)
+	}
+	return w
+}
+
+func (w *Window) optimize(mode Mode, index []string, frac float64) (Cost, Cost, any) {
+	if index != nil && (w.reverse || !w.windowed(index)) {
+		return impossible, impossible, nil
+	}
+	best := bestWindowed(w, mode, index, frac)
+	if best.index == nil {
+		return impossible, impossible, nil
+	}
+	return best.fixcost, best.varcost, &windowApproach{index: best.index}
+}
+
+// bestWindowed finds the best index with the by columns (in any order)
+// followed by the order columns, taking fixed into consideration.
+// Like bestGrouped, if there isn't a suitable index
+// it falls back to by + order which will require a temp index.
+func bestWindowed(w *Window, mode Mode, index []string, frac float64) bestIndex {
+	var indexes [][]string
+	if index == nil {
+		indexes = w.source.Indexes()
+	} else {
+		indexes = [][]string{index}
+	}
+	best := newBestIndex()
+	for _, idx := range indexes {
+		if w.windowed(idx) {
+			fixcost, varcost := Optimize(w.source, mode, idx, frac)
+			best.update(idx, fixcost, varcost)
+		}
+	}
+	if index == nil {
+		idx := slices.Concat(w.by, w.order)
+		fixcost, varcost := Optimize(w.source, mode, idx, frac)
+		best.update(idx, fixcost, varcost)
+	}
+	return best
+}
+
+func (w *Window) setApproach(_ []string, frac float64, approach any, tran QueryTran) {
+	w.windowApproach = *approach.(*windowApproach)
+	w.source = SetApproach(w.source, w.index, frac, tran)
+	w.header = w.getHeader()
+	w.rewound = true
+}
+
+// execution --------------------------------------------------------
+
+func (w *Window) Rewind() {
+	w.source.Rewind()
+	w.rewound = true
+}
+
+func (w *Window) Get(th *Thread, dir Dir) Row {
+	for {
+		row := w.get(th, dir)
+		if row == nil || w.filter(th, row) {
+			return row
+		}
+	}
+}
+
+func (w *Window) get(th *Thread, dir Dir) Row {
+	if w.rewound || w.part == nil {
+		if !w.rewound { // source was empty
+			w.source.Rewind()
+		}
+		w.rewound = false
+		w.part = nil
+		w.nextRow = w.source.Get(th, w.srcDir(dir))
+		w.partDir = dir
+	} else {
+		if dir == Next {
+			w.pos++
+		} else {
+			w.pos--
+		}
+		if 0 <= w.pos && w.pos < len(w.part) {
+			return w.part[w.pos]
+		}
+		if dir != w.partDir {
+			w.skipPartition(th, dir)
+		}
+	}
+	if w.nextRow == nil {
+		// stay at the end so changing direction gets the last row
+		if dir == Next {
+			w.pos = len(w.part)
+		} else {
+			w.pos = -1
+		}
+		return nil
+	}
+	w.readPartition(th, dir)
+	if dir == Next {
+		w.pos = 0
+	} else {
+		w.pos = len(w.part) - 1
+	}
+	return w.part[w.pos]
+}
+
+// srcDir handles reverse
+func (w *Window) srcDir(dir Dir) Dir {
+	if w.reverse {
+		return dir.Reverse()
+	}
+	return dir
+}
+
+// skipPartition handles changing direction.
+// It skips back over the current partition (like Summarize sumSeqT)
+// and sets nextRow to the first row of the following partition in dir.
+func (w *Window) skipPartition(th *Thread, dir Dir) {
+	if w.nextRow == nil {
+		w.source.Rewind()
+	}
+	cur := w.part[0]
+	for {
+		w.nextRow = w.source.Get(th, w.srcDir(dir))
+		if w.nextRow == nil || !w.samePartition(th, cur, w.nextRow) {
+			break
+		}
+	}
+	w.partDir = dir
+}
+
+// readPartition reads the partition starting with nextRow
+// and calculates the window columns
+func (w *Window) readPartition(th *Thread, dir Dir) {
+	first := w.nextRow
+	rows := []Row{first}
+	for {
+		w.nextRow = w.source.Get(th, w.srcDir(dir))
+		if w.nextRow == nil || !w.samePartition(th, first, w.nextRow) {
+			break
+		}
+		rows = append(rows, w.nextRow)
+		if len(rows) == mapWarn {
+			Warning("window partition large >", mapWarn)
+		}
+	}
+	if dir == Prev {
+		slices.Reverse(rows)
+	}
+	w.part = w.calc(th, rows)
+}
+
+func (w *Window) samePartition(th *Thread, row1, row2 Row) bool {
+	return equalCols(row1, row2, w.source.Header(), w.by, th, w.st)
+}
+
+func (w *Window) sameOrder(th *Thread, row1, row2 Row) bool {
+	return equalCols(row1, row2, w.source.Header(), w.order, th, w.st)
+}
+
+// calc adds the window columns to the rows of a partition (in window order)
+func (w *Window) calc(th *Thread, rows []Row) []Row {
+	hdr := w.source.Header()
+	sums := make([]sumOp, len(w.fns))
+	for i, fn := range w.fns {
+		switch fn {
+		case "count", "total", "average", "min", "max":
+			sums[i] = newSumOp(fn, sumParam{})
+		}
+	}
+	result := make([]Row, len(rows))
+	rank, denseRank := 0, 0
+	for r, row := range rows {
+		if r == 0 || !w.sameOrder(th, rows[r-1], row) {
+			rank = r + 1
+			denseRank++
+		}
+		var rb RecordBuilder
+		for i, fn := range w.fns {
+			switch fn {
+			case "count":
+				sums[i].add("", nil, row)
+			case "min", "max":
+				sums[i].add(row.GetRawVal(hdr, w.ons[i], th, w.st), nil, row)
+			case "total", "average":
+				sums[i].add("", row.GetVal(hdr, w.ons[i], th, w.st), row)
+			}
+			switch fn {
+			case "row_number":
+				rb.Add(IntVal(r + 1))
+			case "rank":
+				rb.Add(IntVal(rank))
+			case "dense_rank":
+				rb.Add(IntVal(denseRank))
+			case "lag", "lead":
+				j := r - w.offsets[i]
+				if fn == "lead" {
+					j = r + w.offsets[i]
+				}
+				if 0 <= j && j < len(rows) {
+					rb.AddRaw(rows[j].GetRawVal(hdr, w.ons[i], th, w.st))
+				} else {
+					rb.AddRaw("")
+				}
+			default:
+				val, _ := sums[i].result()
+				rb.Add(val.(Packable))
+			}
+		}
+		result[r] = append(row, DbRec{Record: rb.Trim().Build()})
+	}
+	return result
+}
+
+// Select on the by columns is passed to the source
+// since it selects whole partitions.
+// Other columns are filtered after calculating the window columns.
+func (w *Window) Select(cols, vals []string) {
+	w.selCols, w.selVals = nil, nil
+	var srccols, srcvals []string
+	for i, col := range cols {
+		if slices.Contains(w.by, col) {
+			srccols = append(srccols, col)
+			srcvals = append(srcvals, vals[i])
+		} else {
+			w.selCols = append(w.selCols, col)
+			w.selVals = append(w.selVals, vals[i])
+		}
+	}
+	w.source.Select(srccols, srcvals)
+	w.rewound = true
+}
+
+func (w *Window) filter(th *Thread, row Row) bool {
+	for i, col := range w.selCols {
+		if row.GetRawVal(w.header, col, th, w.st) != w.selVals[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *Window) Lookup(th *Thread, cols, vals []string) Row {
+	w.Select(cols, vals)
+	defer w.Select(nil, nil) // clear
+	return w.Get(th, Next)
+}
+
+func (w *Window) Simple(th *Thread) []Row {
+	w.header = w.getHeader()
+	hdr := w.source.Header()
+	rows := w.source.Simple(th)
+	rev := 1
+	if w.reverse {
+		rev = -1
+	}
+	cmp := func(cols []string, xrow, yrow Row) int {
+		for _, col := range cols {
+			x := xrow.GetRawVal(hdr, col, th, nil)
+			y := yrow.GetRawVal(hdr, col, th, nil)
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	slices.SortStableFunc(rows, func(x, y Row) int {
+		if c := cmp(w.by, x, y); c != 0 {
+			return c
+		}
+		return rev * cmp(w.order, x, y)
+	})
+	result := make([]Row, 0, len(rows))
+	for len(rows) > 0 {
+		n := 1
+		for n < len(rows) && cmp(w.by, rows[0], rows[n]) == 0 {
+			n++
+		}
+		result = append(result, w.calc(th, rows[:n])...)
+		rows = rows[n:]
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	"github.com/apmckinlay/gsuneido/options"
+)
+
+// The slow request log records server requests that take longer than
+// options.SlowRequest (milliseconds). Each is written as a JSON Lines record
+// to the slow log (if any) and the most recent are kept for the /slow page.
+// Query and Strategy are given for requests that involve a query.
+
+type SlowRequest struct {
+	Time     time.Time `json:"timestamp"`
+	Session  string    `json:"session"`
+	Command  string    `json:"command"`
+	Query    string    `json:"query,omitempty"`
+	Strategy string    `json:"strategy,omitempty"`
+	Read     int       `json:"rows_read"`
+	Written  int       `json:"rows_written"`
+	Elapsed  float64   `json:"elapsed_ms"`
+}
+
+// nslow is the number of recent slow requests to keep
+const nslow = 100
+
+var slow struct {
+	lock   sync.Mutex
+	out    io.Writer
+	recent [nslow]SlowRequest
+	n      int // total number recorded
+}
+
+// SlowLog sets the output for the slow request log
+func SlowLog(w io.Writer) {
+	slow.lock.Lock()
+	defer slow.lock.Unlock()
+	slow.out = w
+}
+
+// SlowRequests returns the recent slow requests, most recent first
+func SlowRequests() []SlowRequest {
+	slow.lock.Lock()
+	defer slow.lock.Unlock()
+	n := min(slow.n, nslow)
+	list := make([]SlowRequest, n)
+	for i := range list {
+		list[i] = slow.recent[(slow.n-1-i)%nslow]
+	}
+	return list
+}
+
+func addSlow(sr *SlowRequest) {
+	buf, err := json.Marshal(sr)
+	if err != nil {
+		return
+	}
+	buf = append(buf, '\n')
+	slow.lock.Lock()
+	defer slow.lock.Unlock()
+	slow.recent[slow.n%nslow] = *sr
+	slow.n++
+	if slow.out != nil {
+		slow.out.Write(buf)
+	}
+}
+
+// checkSlow is deferred by command.
+// It must be called before the response is sent
+// since it may need the query to get the strategy.
+// The strategy is from the query that ran, it is not rebuilt.
+func (ss *serverSession) checkSlow(icmd commands.Command, t time.Time) {
+	elapsed := time.Since(t)
+	cmdTimes[icmd].add(elapsed)
+	if options.SlowRequest <= 0 ||
+		elapsed < time.Duration(options.SlowRequest)*time.Millisecond {
+		return
+	}
+	sr := &SlowRequest{Time: t, Session: ss.sessionId.Load(),
+		Command: icmd.String(), Query: ss.slowQuery,
+		Read: ss.thread.RowsRead(), Written: ss.written,
+		Elapsed: float64(elapsed.Microseconds()) / 1000}
+	sr.Strategy = ss.slowStrategy()
+	addSlow(sr)
+}
+
+// slowStrategy returns the strategy for the query of the request (if any)
+func (ss *serverSession) slowStrategy() (strategy string) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Println("ERROR: slow request strategy:", e)
+			strategy = ""
+		}
+	}()
+	if ss.slowQc != nil {
+		return ss.slowQc.Strategy(false)
+	}
+	if ss.slowQuery == "" || ss.slowAction {
+		return ""
+	}
+	// e.g. GetOne doesn't keep the query so it records its strategy
+	return ss.thread.Strategy()
+}
+
+// slowReset is called by command at the start of each request
+func (ss *serverSession) slowReset() {
+	ss.slowQuery, ss.slowQc, ss.slowAction, ss.written = "", nil, false, 0
+}
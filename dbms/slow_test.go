@@ -0,0 +1,88 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/db19/stor"
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestSlow(t *testing.T) {
+	db, _ := db19.CreateDb(stor.HeapStor(8192))
+	db.CheckerSync()
+	qry.DoAdmin(db, "create tmp (a, b) key(a)", nil)
+	dbms := NewDbmsLocal(db)
+	th := &Thread{}
+	th.SetLimits(&Limits{})
+	ss := &serverSession{sc: &serverConn{dbms: dbms}, thread: th}
+	ss.sessionId.Store("test")
+	var sb strings.Builder
+	SlowLog(&sb)
+	defer SlowLog(nil)
+	defer func(n int) { options.SlowRequest = n }(options.SlowRequest)
+	count := func() int { return len(SlowRequests()) }
+	before := count()
+
+	options.SlowRequest = 0 // disabled
+	ss.checkSlow(commands.GetOne, time.Now().Add(-time.Second))
+	assert.T(t).This(count()).Is(before)
+
+	options.SlowRequest = 500
+	ss.slowQuery = "tmp where b = 1"
+	dbms.Get(th, ss.slowQuery, Only) // records the strategy
+	ss.checkSlow(commands.GetOne, time.Now())
+	assert.T(t).This(count()).Is(before)
+	ss.checkSlow(commands.GetOne, time.Now().Add(-time.Second))
+	assert.T(t).This(count()).Is(before + 1)
+
+	ss.slowReset()
+	ss.slowQuery, ss.slowAction, ss.written = "delete tmp", true, 3
+	ss.checkSlow(commands.Action, time.Now().Add(-time.Second))
+	list := SlowRequests()
+	assert.T(t).This(list[0].Command).Is("Action")
+	assert.T(t).This(list[0].Written).Is(3)
+	assert.T(t).This(list[0].Strategy).Is("")
+	assert.T(t).This(list[1].Command).Is("GetOne")
+	assert.T(t).This(list[1].Session).Is("test")
+	assert.T(t).That(strings.HasPrefix(list[1].Strategy, "tmp^(a) WHERE b is 1"))
+	assert.T(t).That(list[1].Elapsed >= 1000)
+
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.T(t).This(len(lines)).Is(2)
+	var sr SlowRequest
+	assert.T(t).This(json.Unmarshal([]byte(lines[0]), &sr)).Is(nil)
+	assert.T(t).This(sr.Query).Is("tmp where b = 1")
+
+	// ring buffer
+	for range nslow + 5 {
+		ss.checkSlow(commands.Action, time.Now().Add(-time.Second))
+	}
+	assert.T(t).This(count()).Is(nslow)
+}
+
+func TestLatency(t *testing.T) {
+	var lat latency
+	lat.add(500 * time.Microsecond)
+	lat.add(3 * time.Millisecond)
+	lat.add(time.Minute)
+	count, _ := lat.Load()
+	assert.T(t).This(count).Is(3)
+	assert.T(t).This(lat.buckets[0].Load()).Is(1)
+	assert.T(t).This(lat.buckets[1].Load()).Is(1)
+	n := int64(0)
+	for i := range lat.buckets {
+		n += lat.buckets[i].Load()
+	}
+	assert.T(t).This(n).Is(2) // time.Minute is over the largest bucket
+}
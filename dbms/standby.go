@@ -0,0 +1,146 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/apmckinlay/gsuneido/core"
+	"github.com/apmckinlay/gsuneido/dbms/commands"
+	"github.com/apmckinlay/gsuneido/dbms/mux"
+	"github.com/apmckinlay/gsuneido/util/generic/atomics"
+)
+
+// A standby server replicates the database from a primary server
+// using the Replicate command, and serves read-only requests.
+// If the primary has users, the standby authenticates as the
+// "replication" user, using the password hash from its own copy
+// of the users table.
+
+// replicateMax is the maximum data per Replicate response.
+// It must be less than the mux message size limit.
+const replicateMax = 512 * 1024
+
+const replicatePoll = time.Second // when caught up
+const replicateRetry = 10 * time.Second
+
+const replicationUser = "replication"
+
+// replicaLag is how far a standby is behind the primary
+type replicaLag struct {
+	bytes uint64
+	ms    int64
+}
+
+func (lag *replicaLag) String() string {
+	return fmt.Sprintf("%d bytes, %d seconds", lag.bytes, (lag.ms+500)/1000)
+}
+
+var standby struct {
+	primary atomics.String
+	status  atomics.String
+	lag     atomic.Pointer[replicaLag]
+}
+
+// StartStandby starts replicating from the primary server in the background.
+// primary is address[:port] with the port defaulting to 3147.
+// It reconnects after errors so it does not stop.
+func StartStandby(dbms *DbmsLocal, primary string) {
+	addr, port, ok := strings.Cut(primary, ":")
+	if !ok {
+		port = "3147"
+	}
+	standby.primary.Store(addr + ":" + port)
+	go func() {
+		for {
+			err := replicate(dbms, addr, port)
+			standby.status.Store(err.Error())
+			log.Println("ERROR standby:", err)
+			time.Sleep(replicateRetry)
+		}
+	}()
+}
+
+// replicate connects to the primary and appends to the local database
+// until there is an error
+func replicate(dbms *DbmsLocal, addr, port string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	conn, err := dialServer(addr, port)
+	if err != nil {
+		return err
+	}
+	dc := &dbmsClient{cc: mux.NewRecoverableClientConn(conn)}
+	defer dc.cc.Close()
+	ms := dc.NewSession()
+	if dbms.db.HaveUsers() && !ms.auth(replicationAuth(dbms, ms.Nonce(nil))) {
+		return errors.New("replication user authorization failed")
+	}
+	log.Println("standby: replicating from", addr+":"+port)
+	standby.status.Store("connected")
+	db := dbms.db
+	for {
+		size, end, ck, asof := db.ReplicaPos()
+		data, pend, pasof := ms.replicate(size, end, ck, asof)
+		if err := db.ReplicaAppend(data, pend); err != nil {
+			// not recoverable by reconnecting
+			Fatal("standby:", err)
+		}
+		size += uint64(len(data))
+		standby.lag.Store(&replicaLag{bytes: pend - size,
+			ms: max(0, pasof-db.GetState().Asof)})
+		if len(data) == 0 {
+			time.Sleep(replicatePoll)
+		}
+	}
+}
+
+// replicationAuth returns the Auth string for the replication user
+func replicationAuth(dbms *DbmsLocal, nonce string) string {
+	var th Thread
+	query := "users where user = " + SuStr(replicationUser).String()
+	row, hdr, _ := dbms.Get(&th, query, Next)
+	if row == nil {
+		panic("standby requires a " + replicationUser + " user")
+	}
+	passhash := ToStr(Unpack(row.GetRaw(hdr, "passhash")))
+	hash := sha1.New()
+	io.WriteString(hash, nonce+passhash)
+	return replicationUser + "\x00" + string(hash.Sum(nil))
+}
+
+func (ms *muxSession) replicate(from, end uint64, ck uint32, asof int64) (
+	data []byte, pend uint64, pasof int64) {
+	ms.PutCmd(commands.Replicate).PutInt64(int64(from)).PutInt64(int64(end)).
+		PutInt64(int64(ck)).PutInt64(asof)
+	ms.Request()
+	pend = uint64(ms.GetInt64())
+	pasof = ms.GetInt64()
+	data = []byte(ms.GetStr_())
+	return data, pend, pasof
+}
+
+// standbyStatus returns the replication status for the monitor
+// or "" if this is not a standby
+func standbyStatus() string {
+	primary := standby.primary.Load()
+	if primary == "" {
+		return ""
+	}
+	s := "<p>Standby of " + primary + ": " + standby.status.Load()
+	if lag := standby.lag.Load(); lag != nil {
+		s += ", lag: " + lag.String()
+	}
+	return s + "</p>\r\n"
+}
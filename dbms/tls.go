@@ -0,0 +1,110 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/options"
+)
+
+// TLS is optional for client/server connections.
+// It is enabled with the -tls options and wraps the connection
+// before the hello exchange.
+// On the server, -tls-cert and -tls-key are required.
+// If -tls-ca is given, clients must have a certificate signed by it.
+// On the client, -tls-ca is used to verify the server
+// (otherwise the system certificate authorities are used)
+// and -tls-cert and -tls-key supply a client certificate.
+
+const tlsTimeout = 10 * time.Second
+
+// tlsServerConfig returns the server TLS config, or nil if TLS is not enabled
+func tlsServerConfig() (*tls.Config, error) {
+	if !options.Tls {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(options.TlsCert, options.TlsKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert},
+		MinVersion: tls.VersionTLS12}
+	if options.TlsCA != "" {
+		pool, err := tlsCertPool(options.TlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// tlsClientConfig returns the client TLS config, or nil if TLS is not enabled
+func tlsClientConfig(addr string) (*tls.Config, error) {
+	if !options.Tls {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: addr, MinVersion: tls.VersionTLS12}
+	if options.TlsCA != "" {
+		pool, err := tlsCertPool(options.TlsCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if options.TlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(options.TlsCert, options.TlsKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func tlsCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return pool, nil
+}
+
+// tlsClient wraps a client connection in TLS (if enabled)
+// and does the handshake.
+func tlsClient(conn net.Conn, addr string) (net.Conn, error) {
+	config, err := tlsClientConfig(addr)
+	if err != nil || config == nil {
+		return conn, err
+	}
+	tc := tls.Client(conn, config)
+	return tc, tlsHandshake(tc)
+}
+
+// tlsHandshake does the handshake for a TLS connection with a timeout
+// so a client can't tie up a server connection.
+// It does nothing if the connection is not TLS.
+func tlsHandshake(conn net.Conn) error {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	tc.SetDeadline(time.Now().Add(tlsTimeout))
+	defer tc.SetDeadline(time.Time{})
+	if err := tc.Handshake(); err != nil {
+		return errors.New("tls handshake: " + err.Error())
+	}
+	return nil
+}
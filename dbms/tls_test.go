@@ -0,0 +1,114 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package dbms
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestTls(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+	ca, caKey := makeCert(t, dir, "ca", nil, nil)
+	makeCert(t, dir, "server", ca, caKey)
+	makeCert(t, dir, "client", ca, caKey)
+	defer func() {
+		options.Tls = false
+		options.TlsCert, options.TlsKey, options.TlsCA = "", "", ""
+	}()
+
+	// connect returns the client and server errors
+	connect := func(cert, key, ca string) (error, error) {
+		options.Tls = true
+		options.TlsCert, options.TlsKey, options.TlsCA =
+			file("server.pem"), file("server.key"), file("ca.pem")
+		config, err := tlsServerConfig()
+		ck(err)
+		options.TlsCert, options.TlsKey, options.TlsCA = cert, key, ca
+		p1, p2 := net.Pipe()
+		defer p1.Close()
+		defer p2.Close()
+		errc := make(chan error)
+		go func() {
+			errc <- tlsHandshake(tls.Server(p1, config))
+			p1.Close()
+		}()
+		_, err = tlsClient(p2, "localhost")
+		p2.Close()
+		return err, <-errc
+	}
+	cerr, serr := connect(file("client.pem"), file("client.key"), file("ca.pem"))
+	assert.T(t).This(cerr).Is(nil)
+	assert.T(t).This(serr).Is(nil)
+
+	// client without a certificate
+	_, serr = connect("", "", file("ca.pem"))
+	assert.T(t).That(serr != nil)
+
+	// client that doesn't trust the server's certificate authority
+	cerr, _ = connect(file("client.pem"), file("client.key"), "")
+	assert.T(t).That(strings.Contains(cerr.Error(), "unknown authority"))
+
+	options.TlsCA = file("nonexistent.pem")
+	_, err := tlsClientConfig("localhost")
+	assert.T(t).That(err != nil)
+}
+
+// makeCert creates name.pem and name.key in dir.
+// If parent is nil it creates a self signed certificate authority.
+func makeCert(t *testing.T, dir, name string, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ck(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent,
+		&key.PublicKey, parentKey)
+	ck(err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	ck(err)
+	ck(os.WriteFile(filepath.Join(dir, name+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	ck(os.WriteFile(filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		0600))
+	cert, err := x509.ParseCertificate(der)
+	ck(err)
+	return cert, key
+}
+
+func ck(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -11,9 +11,11 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/apmckinlay/gsuneido/builtin"
@@ -25,6 +27,7 @@ import (
 	"github.com/apmckinlay/gsuneido/options"
 	"github.com/apmckinlay/gsuneido/util/exit"
 	"github.com/apmckinlay/gsuneido/util/generic/slc"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"github.com/apmckinlay/gsuneido/util/regex"
 	"github.com/apmckinlay/gsuneido/util/system"
 	// sync "github.com/sasha-s/go-deadlock"
@@ -34,16 +37,29 @@ var builtDate = "Jan 23 2023 12:34" // set by: go build -ldflags "-X main.builtD
 var mode = ""                       // set by: go build -ldflags "-X main.mode=gui"
 
 var help = `options:
+	-b[ackup][=filename] (default backup.db) [-port=# to use a running server]
+	-b[ackup-]i[ncremental]=base,filename [-port=#]
 	-check
 	-c[lient][=ipaddress] (default 127.0.0.1)
 	-compact
 	-d[ump] [table]
+	-export=table[,csv|jsonl[,filename]] (default csv, table.csv)
 	-h[elp] or -?
-	-l[oad] [table] (or @filename)
+	-import=table[,csv|jsonl[,filename]] (adds to an existing table)
+	-l[oad] [table] (or @filename) (rerun to resume an interrupted load)
+	-log-json (with -server, write error.log as JSON Lines records)
+	-log-size=mb -log-keep=# (with -server, rotate error.log, default keep 5)
 	-p[ass]p[hrase]=string (for -load)
+	-slow=ms (with -server, log requests slower than this to slow.log)
 	-p[ort][=#] (default 3147)
 	-repair
+	-r[estore-]a[sof]=date[,filename] (default restored.db)
+	-r[estore-]i[ncremental]=full,increment,... (to suneido.db)
 	-s[erver]
+	-standby=address[:port] (with -server, read-only replica of a primary)
+	-tls (with -client, encrypt the connection to the server)
+	-tls-cert=file -tls-key=file (required for -server -tls, optional client)
+	-tls-ca=file (server requires client certificates, client verifies server)
 	-v[ersion]
 	-w[eb][=#] (default -port + 1)`
 
@@ -86,6 +102,46 @@ func main() {
 			Fatal("Please use gsport for server mode")
 		}
 		runServer()
+	case "backup":
+		t := time.Now()
+		to := options.Arg
+		if to == "" {
+			to = "backup.db"
+		}
+		size := backup(to, "")
+		Alert("backed up", size/(1024*1024), "mb to", to,
+			"in", time.Since(t).Round(time.Millisecond))
+		os.Exit(0)
+	case "backup-incremental":
+		t := time.Now()
+		base, to, _ := strings.Cut(options.Arg, ",")
+		size := backup(to, base)
+		Alert("backed up increment to", to, "database size",
+			size/(1024*1024), "mb in", time.Since(t).Round(time.Millisecond))
+		os.Exit(0)
+	case "restore-incremental":
+		t := time.Now()
+		files := strings.Split(options.Arg, ",")
+		size, err := tools.RestoreIncremental(files, "suneido.db")
+		ck(err)
+		Alert("restored", len(files), "backups to suneido.db",
+			size/(1024*1024), "mb in", time.Since(t).Round(time.Millisecond))
+		os.Exit(0)
+	case "restore-asof":
+		t := time.Now()
+		date, to, _ := strings.Cut(options.Arg, ",")
+		if to == "" {
+			to = "restored.db"
+		}
+		d := ParseDate(date, "yMd")
+		if d == NilDate {
+			Fatal("restore-asof: invalid date:", date)
+		}
+		asof, size, err := tools.RestoreAsof("suneido.db", d.UnixMilli(), to)
+		ck(err)
+		Alert("restored as of", SuDateFromUnixMilli(asof), "to", to,
+			size/(1024*1024), "mb in", time.Since(t).Round(time.Millisecond))
+		os.Exit(0)
 	case "dump":
 		t := time.Now()
 		if options.Arg == "" {
@@ -101,6 +157,21 @@ func main() {
 				"in", time.Since(t).Round(time.Millisecond))
 		}
 		os.Exit(0)
+	case "export", "import":
+		t := time.Now()
+		table, format, file := exportArgs(options.Arg)
+		if options.Action == "export" {
+			n, err := tools.ExportTable("suneido.db", table, format, file)
+			ck(err)
+			Alert("exported", n, "records from", table, "to", file,
+				"in", time.Since(t).Round(time.Millisecond))
+		} else {
+			n, err := tools.ImportTable("suneido.db", table, format, file)
+			ck(err)
+			Alert("imported", n, "records to", table, "from", file,
+				"in", time.Since(t).Round(time.Millisecond))
+		}
+		os.Exit(0)
 	case "load":
 		t := time.Now()
 		privateKey := ""
@@ -186,8 +257,7 @@ func main() {
 	}()
 	// dependency injection of GetDbms
 	if options.Action == "client" {
-		conn := dbms.ConnectClient(options.Arg, options.Port)
-		client := dbms.NewDbmsClient(conn)
+		client := dbms.ConnectDbmsClient(options.Arg, options.Port)
 		GetDbms = func() IDbms {
 			return client.NewSession()
 		}
@@ -258,6 +328,24 @@ func run(src string) {
 	compile.EvalString(&mainThread, src)
 }
 
+// backup uses the running server if a port was specified,
+// otherwise it opens the database file directly.
+// If base is not "" it makes an incremental backup.
+func backup(to, base string) uint64 {
+	if options.Port == "" {
+		size, err := tools.BackupDatabase("suneido.db", to, base)
+		ck(err)
+		return size
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			Fatal("backup:", e)
+		}
+	}()
+	conn := dbms.ConnectClient("127.0.0.1", options.Port)
+	return dbms.NewDbmsClient(conn).NewSession().Backup(to, base)
+}
+
 func ck(err error) {
 	if err != nil {
 		Fatal(err)
@@ -303,16 +391,62 @@ func clientErrorLog() {
 
 // runServer does not return
 func runServer() {
+	serverLog()
 	log.Println("starting server")
 	openDbms()
 	startHttpStatus()
 	run("Init()")
 	options.DbStatus.Store("")
 	exit.Add("stop server", stopServer)
+	drainOnSignal()
 	dbms.Server(dbmsLocal)
 	log.Fatalln("FATAL server should not return")
 }
 
+// serverLog sets up the -log-json, -log-size, and -slow options.
+// Go stack traces are written to the log output so they are JSON records,
+// but a fatal Go runtime error is written directly to stderr.
+// If stderr is redirected to error.log (on Windows)
+// it follows the rotated file, so the file can be renamed.
+func serverLog() {
+	if options.SlowRequest > 0 {
+		size := options.LogSize
+		if size == 0 {
+			size = 10
+		}
+		rf, err := logging.OpenRotating("slow.log",
+			int64(size)*1024*1024, options.LogKeep)
+		ck(err)
+		dbms.SlowLog(rf)
+	}
+	var w io.Writer = os.Stderr
+	if options.LogSize > 0 {
+		rf, err := logging.OpenRotating(errlog,
+			int64(options.LogSize)*1024*1024, options.LogKeep)
+		ck(err)
+		rf.OnOpen(func(f *os.File) {
+			system.RedirectTo(f) // can't log errors, we are the log
+		})
+		w = rf
+	}
+	if options.LogJson {
+		logging.JSON(w)
+	} else {
+		log.SetOutput(w)
+	}
+}
+
+// drainOnSignal starts a drain (with the default timeout) on SIGTERM
+func drainOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM)
+	go func() {
+		<-ch
+		log.Println("dbms server: received SIGTERM")
+		dbmsLocal.Drain(dbms.DefaultDrainTimeout)
+	}()
+}
+
 func stopServer() {
 	exit.Progress("server stopping")
 	defer exit.Progress("server stopped")
@@ -326,8 +460,12 @@ func stopServer() {
 var db *db19.Database
 
 func openDbms() {
+	open := db19.OpenDatabase
+	if options.Standby != "" {
+		open = db19.OpenStandby
+	}
 	var err error
-	db, err = db19.OpenDatabase("suneido.db")
+	db, err = open("suneido.db")
 	if errors.Is(err, fs.ErrNotExist) {
 		runCommandLine()
 		exit.Exit(0)
@@ -345,15 +483,19 @@ func openDbms() {
 			Fatal("repair:", err)
 		}
 		Alert(msg)
-		db, err = db19.OpenDatabase("suneido.db")
+		db, err = open("suneido.db")
 		if err != nil {
 			Fatal("open:", err)
 		}
 		options.DbStatus.Store("starting")
 	}
 	db19.StartTimestamps()
-	db19.StartConcur(db, persistInterval())
 	dbmsLocal = dbms.NewDbmsLocal(db)
+	if options.Standby != "" {
+		dbms.StartStandby(dbmsLocal, options.Standby)
+	} else {
+		db19.StartConcur(db, persistInterval())
+	}
 	DbmsAuth = options.Action == "server" || mode != "gui" || !db.HaveUsers()
 	GetDbms = getDbms
 	exit.Add("close database", func() {
@@ -506,6 +648,19 @@ func eval(src string) {
 
 //-------------------------------------------------------------------
 
+// exportArgs splits table[,format[,filename]] for -export and -import
+func exportArgs(arg string) (table, format, file string) {
+	table, format, _ = strings.Cut(arg, ",")
+	format, file, _ = strings.Cut(format, ",")
+	if format == "" {
+		format = "csv"
+	}
+	if file == "" {
+		file = table + "." + format
+	}
+	return
+}
+
 // libload loads a name from the dbms
 func libload(th *Thread, name string) (result Value, e any) {
 	defer func() {
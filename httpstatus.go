@@ -5,8 +5,9 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"runtime"
@@ -14,11 +15,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/apmckinlay/gsuneido/builtin"
 	"github.com/apmckinlay/gsuneido/core"
 	"github.com/apmckinlay/gsuneido/dbms"
 	"github.com/apmckinlay/gsuneido/options"
+	"github.com/apmckinlay/gsuneido/util/logging"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
@@ -30,8 +33,13 @@ func startHttpStatus() {
 		return // already started
 	}
 	http.HandleFunc("/", httpStatus)
+	http.HandleFunc("/metrics", httpOpenMetrics)
 	http.HandleFunc("/metrics/", httpMetrics)
 	http.HandleFunc("/info/", httpInfo)
+	http.HandleFunc("/slow", httpSlow)
+	http.HandleFunc("/drain", httpDrain)
+	http.HandleFunc("/maintenance", httpMaintenance)
+	adminHandlers()
 	port := "3148"
 	if options.WebPort != "" {
 		port = options.WebPort
@@ -44,7 +52,7 @@ func startHttpStatus() {
 		httpServer = &http.Server{Addr: addr}
 		err := httpServer.ListenAndServe()
 		if err != http.ErrServerClosed {
-			log.Println("Server Monitor:", err)
+			logging.Println("web", "", "Server Monitor:", err)
 		}
 	}()
 }
@@ -76,6 +84,13 @@ func body() string {
 	case "repairing":
 		return `<h2 style="color: red;">Repairing database ...<h2>`
 	}
+	switch dbms.ServerMode() {
+	case "draining":
+		extra += `<h2 style="color: red;">Draining - shutting down</h2>`
+	case "maintenance":
+		extra += `<h2 style="color: blue;">Maintenance mode - ` +
+			`only admin connections</h2>`
+	}
 	s := extra + `
 		<p>Built: ` + options.BuiltStr() + `</p>
 		<p>Heap: ` + heap() + `</p>` +
@@ -87,6 +102,9 @@ func body() string {
 	}
 	return s + `<p><a href="info/">Suneido Info</a> &nbsp;&nbsp;
 			<a href="metrics/">Go metrics</a> &nbsp;&nbsp;
+			<a href="metrics">OpenMetrics</a> &nbsp;&nbsp;
+			<a href="slow">Slow requests</a> &nbsp;&nbsp;
+			<a href="admin">Admin</a> &nbsp;&nbsp;
 			<a href="debug/pprof/">Go pprof</a>	</p>`
 }
 
@@ -135,7 +153,7 @@ func httpMetrics(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if req.URL.Path == "/metrics" || req.URL.Path == "/metrics/" {
+	if req.URL.Path == "/metrics/" {
 		io.WriteString(w,
 			`<html>
 			<head><title>Go metrics</title></head>
@@ -190,3 +208,111 @@ func httpInfo(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprint(w, req.URL.Path, " = ", s)
 	}
 }
+
+// httpSlow shows the recent slow requests (see -slow)
+// and the request latency histograms
+func httpSlow(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	esc := html.EscapeString
+	io.WriteString(w, `<html>
+		<head><title>Slow Requests</title></head>
+		<body>
+		<h1>Slow Requests</h1>
+		`)
+	if options.SlowRequest <= 0 {
+		io.WriteString(w, "<p>Not enabled, use -slow=ms</p>\n")
+	} else {
+		fmt.Fprintf(w, "<p>Requests over %d ms, most recent first</p>\n",
+			options.SlowRequest)
+	}
+	io.WriteString(w, `<table border="1" cellpadding="3">
+		<tr><th>Time</th><th>Session</th><th>Command</th><th>ms</th>
+		<th>Read</th><th>Written</th><th>Query</th><th>Strategy</th></tr>
+		`)
+	for _, sr := range dbms.SlowRequests() {
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%.1f</td>"+
+			"<td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>\n",
+			sr.Time.Format("2006-01-02 15:04:05.000"), esc(sr.Session),
+			sr.Command, sr.Elapsed, sr.Read, sr.Written,
+			esc(sr.Query), esc(sr.Strategy))
+	}
+	io.WriteString(w, `</table>
+		<h2>Request Latency</h2>
+		<table border="1" cellpadding="3">
+		<tr><th>Command</th><th>Count</th><th>Average ms</th>`)
+	for _, le := range dbms.LatencyBuckets {
+		fmt.Fprintf(w, "<th>&le; %v</th>", le)
+	}
+	io.WriteString(w, "<th>&gt; "+
+		dbms.LatencyBuckets[len(dbms.LatencyBuckets)-1].String()+"</th></tr>\n")
+	dbms.CommandTimes(func(cmd string, count int64, total time.Duration,
+		buckets []int64) {
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%d</td><td>%.1f</td>",
+			cmd, count, float64(total.Microseconds())/1000/float64(count))
+		prev := int64(0)
+		for _, n := range buckets {
+			fmt.Fprintf(w, "<td>%d</td>", n-prev)
+			prev = n
+		}
+		fmt.Fprintf(w, "<td>%d</td></tr>\n", count-prev)
+	})
+	io.WriteString(w, "</table></body></html>")
+}
+
+// httpDrain handles POST /drain?timeout=seconds
+func httpDrain(w http.ResponseWriter, req *http.Request) {
+	if !httpControl(w, req) {
+		return
+	}
+	timeout := dbms.DefaultDrainTimeout
+	if t := req.URL.Query().Get("timeout"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = n
+	}
+	dbmsLocal.Drain(timeout)
+	io.WriteString(w, "draining\n")
+}
+
+// httpMaintenance handles POST /maintenance?on=true|false
+func httpMaintenance(w http.ResponseWriter, req *http.Request) {
+	if !httpControl(w, req) {
+		return
+	}
+	on := true
+	if s := req.URL.Query().Get("on"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "invalid on", http.StatusBadRequest)
+			return
+		}
+		on = b
+	}
+	dbmsLocal.Maintenance(on)
+	fmt.Fprintln(w, "maintenance", on)
+}
+
+// httpControl checks that a control request is a POST from the local machine
+// to a server
+func httpControl(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	host, _, _ := net.SplitHostPort(req.RemoteAddr)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	if options.Action != "server" || dbmsLocal == nil {
+		http.Error(w, "Not a server", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
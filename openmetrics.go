@@ -0,0 +1,130 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/apmckinlay/gsuneido/builtin"
+	"github.com/apmckinlay/gsuneido/db19"
+	"github.com/apmckinlay/gsuneido/dbms"
+	qry "github.com/apmckinlay/gsuneido/dbms/query"
+	"github.com/apmckinlay/gsuneido/options"
+)
+
+// httpOpenMetrics serves /metrics in OpenMetrics text format
+// for monitoring systems e.g. Prometheus
+func httpOpenMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type",
+		"application/openmetrics-text; version=1.0.0; charset=utf-8")
+	writeMetrics(w)
+}
+
+var dbStatuses = []string{"ok", "starting", "checking", "repairing", "corrupted"}
+
+func writeMetrics(w io.Writer) {
+	m := &metricsWriter{w: w}
+	status := options.DbStatus.Load()
+	if status == "" {
+		status = "ok"
+	}
+	m.family("gsuneido_db_status", "stateset", "Database status")
+	for _, s := range dbStatuses {
+		m.sample("gsuneido_db_status", `{gsuneido_db_status="`+s+`"}`,
+			bool01(s == status))
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m.gauge("gsuneido_heap_bytes", "Heap memory in use", ms.HeapInuse)
+	m.gauge("gsuneido_threads", "Number of Suneido threads",
+		len(builtin.ThreadList()))
+	if dbmsLocal != nil {
+		m.gauge("gsuneido_db_size_bytes", "Database size", dbmsLocal.Size())
+		m.gauge("gsuneido_transactions", "Number of outstanding transactions",
+			dbmsLocal.Transactions().Size())
+		m.gauge("gsuneido_transactions_final",
+			"Number of transactions waiting to finalize", dbmsLocal.Final())
+		conns, sessions, cursors := dbms.ConnStats()
+		m.gauge("gsuneido_connections", "Number of client connections", conns)
+		m.gauge("gsuneido_sessions", "Number of client sessions", sessions)
+		m.gauge("gsuneido_cursors", "Number of client cursors", cursors)
+		m.summary("gsuneido_merge_seconds", "Database merges",
+			db19.MergeTimes.Load)
+		m.summary("gsuneido_persist_seconds", "Database persists",
+			db19.PersistTimes.Load)
+	}
+	m.counter("gsuneido_slow_queries",
+		"Number of slow queries (where reads > 100 times results)",
+		qry.SlowQueries.Load())
+	m.family("gsuneido_request_seconds", "histogram",
+		"Client requests by dbms command")
+	dbms.CommandTimes(func(cmd string, count int64, total time.Duration,
+		buckets []int64) {
+		for i, le := range dbms.LatencyBuckets {
+			m.sample("gsuneido_request_seconds_bucket",
+				`{command="`+cmd+`",le="`+
+					strconv.FormatFloat(le.Seconds(), 'g', -1, 64)+`"}`,
+				buckets[i])
+		}
+		m.sample("gsuneido_request_seconds_bucket",
+			`{command="`+cmd+`",le="+Inf"}`, count)
+		labels := `{command="` + cmd + `"}`
+		m.sample("gsuneido_request_seconds_count", labels, count)
+		m.sample("gsuneido_request_seconds_sum", labels, total.Seconds())
+	})
+	io.WriteString(w, "# EOF\n")
+}
+
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(m.w, "# TYPE %s %s\n# HELP %s %s\n", name, typ, name, help)
+}
+
+func (m *metricsWriter) sample(name, labels string, value any) {
+	var s string
+	switch v := value.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	fmt.Fprintf(m.w, "%s%s %s\n", name, labels, s)
+}
+
+func (m *metricsWriter) gauge(name, help string, value any) {
+	m.family(name, "gauge", help)
+	m.sample(name, "", value)
+}
+
+func (m *metricsWriter) counter(name, help string, value any) {
+	m.family(name, "counter", help)
+	m.sample(name+"_total", "", value)
+}
+
+func (m *metricsWriter) summary(name, help string,
+	load func() (int64, time.Duration)) {
+	m.family(name, "summary", help)
+	count, total := load()
+	m.sample(name+"_count", "", count)
+	m.sample(name+"_sum", "", total.Seconds())
+}
+
+func bool01(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
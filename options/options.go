@@ -29,6 +29,15 @@ var (
 	WebPort        string
 	TimeoutMinutes = 2 * 60 // 2 hours
 	Passphrase     string   // used with -load
+	Standby        string   // primary address[:port] for -server -standby
+	Tls            bool     // use TLS for the client/server connection
+	TlsCert        string   // certificate file for -tls
+	TlsKey         string   // private key file for -tls
+	TlsCA          string   // certificate authority file for -tls
+	LogJson        bool     // write the server log as JSON Lines records
+	LogSize        int      // rotate the server log at this many mb
+	LogKeep        = 5      // the number of rotated logs to keep
+	SlowRequest    int      // log server requests slower than this many ms
 )
 
 // StrictCompare determines whether comparisons between different types
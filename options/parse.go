@@ -21,6 +21,15 @@ loop:
 		switch {
 		case match(&args, "-help"), match(&args, "-h"), match(&args, "-?"):
 			setAction("help")
+		case match(&args, "-backup"), match(&args, "-b"):
+			setAction("backup")
+			args = optionalArg(args, &Arg)
+		case match(&args, "-backup-incremental"), match(&args, "-bi"):
+			setAction("backup-incremental")
+			args = optionalArg(args, &Arg)
+			if strings.Count(Arg, ",") != 1 {
+				error("backup-incremental requires base,destination")
+			}
 		case match(&args, "-check"):
 			setAction("check")
 		case match(&args, "-client"), match(&args, "-c"):
@@ -32,6 +41,18 @@ loop:
 		case match(&args, "-dump"), match(&args, "-d"):
 			setAction("dump")
 			args = optionalArg(args, &Arg)
+		case match(&args, "-export"):
+			setAction("export")
+			args = optionalArg(args, &Arg)
+			if Arg == "" {
+				error("export requires table[,format[,filename]]")
+			}
+		case match(&args, "-import"):
+			setAction("import")
+			args = optionalArg(args, &Arg)
+			if Arg == "" {
+				error("import requires table[,format[,filename]]")
+			}
 		case match(&args, "-load"), match(&args, "-l"):
 			setAction("load")
 			args = optionalArg(args, &Arg)
@@ -43,6 +64,14 @@ loop:
 			if Passphrase == "" {
 				error("passphrase required")
 			}
+		case match(&args, "-log-json"):
+			LogJson = true
+		case match(&args, "-log-size"):
+			LogSize = optEqualNum(&args, "log-size")
+		case match(&args, "-log-keep"):
+			LogKeep = optEqualNum(&args, "log-keep")
+		case match(&args, "-slow"):
+			SlowRequest = optEqualNum(&args, "slow")
 		case match(&args, "-port"), match(&args, "-p"):
 			args = optionalArg(args, &Port)
 			if Port == "" {
@@ -50,10 +79,47 @@ loop:
 			} else if _, ok := atoui(Port); !ok {
 				error("invalid port number")
 			}
+		case match(&args, "-restore-incremental"), match(&args, "-ri"):
+			setAction("restore-incremental")
+			args = optionalArg(args, &Arg)
+			if Arg == "" {
+				error("restore-incremental requires full,increment,...")
+			}
+		case match(&args, "-restore-asof"), match(&args, "-ra"):
+			setAction("restore-asof")
+			args = optionalArg(args, &Arg)
+			if Arg == "" {
+				error("restore-asof requires date[,destination]")
+			}
 		case match(&args, "-repair"):
 			setAction("repair")
 		case match(&args, "-server"), match(&args, "-s"):
 			setAction("server")
+		case match(&args, "-standby"):
+			args = optionalArg(args, &Standby)
+			if Standby == "" {
+				error("standby requires the primary address")
+			}
+		case match(&args, "-tls"):
+			Tls = true
+		case match(&args, "-tls-cert"):
+			Tls = true
+			args = optEqualArg(args, &TlsCert)
+			if TlsCert == "" {
+				error("tls-cert requires a filename")
+			}
+		case match(&args, "-tls-key"):
+			Tls = true
+			args = optEqualArg(args, &TlsKey)
+			if TlsKey == "" {
+				error("tls-key requires a filename")
+			}
+		case match(&args, "-tls-ca"):
+			Tls = true
+			args = optEqualArg(args, &TlsCA)
+			if TlsCA == "" {
+				error("tls-ca requires a filename")
+			}
 		case match(&args, "-unattended"), match(&args, "-u"):
 			//TEMP for backward compatibility
 		case match(&args, "-version"), match(&args, "-v"):
@@ -87,9 +153,27 @@ loop:
 			return
 		}
 	}
-	if Port != "" && Action != "client" && Action != "server" {
-		error("port should only be specified with -server or -client, not " +
-			Action)
+	if Port != "" && Action != "client" && Action != "server" &&
+		Action != "backup" && Action != "backup-incremental" {
+		error("port should only be specified with -server or -client " +
+			"or -backup, not " + Action)
+	}
+	if Standby != "" && Action != "server" {
+		error("standby is only valid with -server")
+	}
+	if Tls && Action != "client" && Action != "server" &&
+		Action != "backup" && Action != "backup-incremental" {
+		error("tls should only be specified with -server or -client " +
+			"or -backup, not " + Action)
+	}
+	if (TlsCert == "") != (TlsKey == "") {
+		error("tls-cert and tls-key must be used together")
+	}
+	if Tls && Action == "server" && TlsCert == "" {
+		error("tls with -server requires -tls-cert and -tls-key")
+	}
+	if (LogJson || LogSize != 0 || SlowRequest != 0) && Action != "server" {
+		error("log options should only be specified with -server")
 	}
 	if Port == "" && (Action == "client" || Action == "server") {
 		Port = "3147"
@@ -145,6 +229,16 @@ func optEqualArg(args []string, parg *string) []string {
 	return args
 }
 
+func optEqualNum(pargs *[]string, name string) int {
+	s := ""
+	*pargs = optEqualArg(*pargs, &s)
+	n, ok := atoui(s)
+	if !ok {
+		error(name + " requires a number")
+	}
+	return n
+}
+
 func error(err string) {
 	Action = "error"
 	Error = err
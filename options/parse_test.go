@@ -18,6 +18,10 @@ func TestParse(t *testing.T) {
 		Action, Arg, Port, CmdLine, Error = "", "", "", "", ""
 		TimeoutMinutes = 0
 		WebServer, WebPort = false, ""
+		Standby = ""
+		Tls, TlsCert, TlsKey, TlsCA = false, "", "", ""
+		LogJson, LogSize, LogKeep = false, 0, 5
+		SlowRequest = 0
 		Parse(args)
 		s := Action
 		if Arg != "" {
@@ -29,6 +33,27 @@ func TestParse(t *testing.T) {
 		if TimeoutMinutes != 0 {
 			s += " timeout=" + strconv.Itoa(TimeoutMinutes)
 		}
+		if Standby != "" {
+			s += " standby=" + Standby
+		}
+		if Tls {
+			s += " tls"
+			for _, f := range []string{TlsCert, TlsKey, TlsCA} {
+				if f != "" {
+					s += " " + f
+				}
+			}
+		}
+		if LogJson {
+			s += " log-json"
+		}
+		if LogSize != 0 {
+			s += " log-size=" + strconv.Itoa(LogSize) +
+				" keep=" + strconv.Itoa(LogKeep)
+		}
+		if SlowRequest != 0 {
+			s += " slow=" + strconv.Itoa(SlowRequest)
+		}
 		if WebServer {
 			s += " web"
 			if WebPort != "" {
@@ -72,6 +97,15 @@ func TestParse(t *testing.T) {
 	test("-h", "help")
 	test("-?", "help")
 
+	test("-backup", "backup")
+	test("-backup=bak.db", "backup bak.db")
+	test("-b=bak.db -p=1234", "backup bak.db port 1234")
+	test("-backup-incremental=bak.db,bak1.db", "backup-incremental bak.db,bak1.db")
+	test("-bi=bak.db", "error backup-incremental requires base,destination")
+	test("-restore-incremental=bak.db,bak1.db,bak2.db",
+		"restore-incremental bak.db,bak1.db,bak2.db")
+	test("-ri", "error restore-incremental requires")
+
 	test("-check", "check")
 	test("-compact", "compact")
 
@@ -90,8 +124,39 @@ func TestParse(t *testing.T) {
 	test("-dump", "dump")
 	test("-dump stdlib", "dump stdlib")
 
+	test("-export=customers", "export customers")
+	test("-export=customers,jsonl,cust.txt", "export customers,jsonl,cust.txt")
+	test("-export", "error export requires table")
+	test("-import=customers,csv", "import customers,csv")
+	test("-import", "error import requires table")
+
 	test("-server", "server")
+	test("-s -standby=1.2.3.4", "server standby=1.2.3.4")
+	test("-standby=1.2.3.4:3000 -server", "server standby=1.2.3.4:3000")
+	test("-s -standby", "error standby requires the primary address")
+	test("-c -standby=1.2.3.4", "error standby is only valid with -server")
+
+	test("-c -tls", "client 127.0.0.1 tls")
+	test("-c -tls-ca=ca.pem", "client 127.0.0.1 tls ca.pem")
+	test("-c -tls-cert=c.pem -tls-key=k.pem", "client 127.0.0.1 tls c.pem k.pem")
+	test("-s -tls-cert=c.pem -tls-key=k.pem -tls-ca=ca.pem",
+		"server tls c.pem k.pem ca.pem")
+	test("-s -tls", "error tls with -server requires")
+	test("-s -log-json", "server log-json")
+	test("-s -log-size=10", "server log-size=10 keep=5")
+	test("-s -log-json -log-size=10 -log-keep=3",
+		"server log-json log-size=10 keep=3")
+	test("-s -log-size", "error log-size requires a number")
+	test("-c -log-json", "error log options should only be specified")
+	test("-s -slow=500", "server slow=500")
+	test("-c -slow=500", "error log options should only be specified")
+	test("-s -tls-cert=c.pem", "error tls-cert and tls-key")
+	test("-c -tls-ca", "error tls-ca requires a filename")
+	test("-dump -tls", "error tls should only be specified")
 	test("-repair", "repair")
+	test("-ra=2026-10-01", "restore-asof 2026-10-01")
+	test("-restore-asof=2026-10-01,old.db", "restore-asof 2026-10-01,old.db")
+	test("-restore-asof", "error restore-asof requires date")
 
 	test("-to=44", "timeout=44")
 	test("-to", "error timeout value required")
@@ -5,12 +5,12 @@ package dbg
 
 import (
 	"bytes"
-	"os"
+	"log"
 	"runtime"
 )
 
-// PrintStack prints the Go call stack to stderr, similar to debug.PrintStack,
-// except it limits the size.
+// PrintStack prints the Go call stack to the log output (stderr by default)
+// similar to debug.PrintStack, except it limits the size.
 func PrintStack() {
 	buf := make([]byte, 4096)
 	n := runtime.Stack(buf, false)
@@ -19,5 +19,5 @@ func PrintStack() {
 	}
 	buf = buf[:n]
 	buf = bytes.ReplaceAll(buf, []byte("github.com/apmckinlay/"), nil)
-	os.Stderr.Write(buf)
+	log.Writer().Write(buf)
 }
@@ -3,7 +3,10 @@
 
 package atomics
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type String struct {
 	v atomic.Value
@@ -41,3 +44,23 @@ func (a *Value[T]) Load() T {
 func (a *Value[T]) Swap(new T) T {
 	return a.v.Swap(new).(T)
 }
+
+// Durations accumulates a count and a total duration e.g. for metrics
+type Durations struct {
+	count atomic.Int64
+	nanos atomic.Int64
+}
+
+func (d *Durations) Add(dur time.Duration) {
+	d.count.Add(1)
+	d.nanos.Add(int64(dur))
+}
+
+// Since adds the time since t. It can be used with defer.
+func (d *Durations) Since(t time.Time) {
+	d.Add(time.Since(t))
+}
+
+func (d *Durations) Load() (count int64, total time.Duration) {
+	return d.count.Load(), time.Duration(d.nanos.Load())
+}
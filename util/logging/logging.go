@@ -0,0 +1,101 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+// Package logging optionally writes the log as JSON Lines records
+// with timestamp, level, component, session, and message.
+//
+// Most logging uses the standard log package.
+// When JSON is enabled those messages are converted to records,
+// with the level taken from the start of the message (e.g. ERROR).
+// Println can be used to also supply the component and session.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// out is the JSON output, nil if JSON is not enabled
+var out *jsonWriter
+
+type jsonWriter struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+// JSON switches the standard log output to JSON records written to w
+func JSON(w io.Writer) {
+	out = &jsonWriter{w: w}
+	log.SetFlags(0)
+	log.SetOutput(out)
+}
+
+type record struct {
+	Time      string `json:"timestamp"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Session   string `json:"session,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Println logs a message with a component (e.g. dbms) and session.
+// If JSON is not enabled, it is the same as log.Println(args...)
+func Println(component, session string, args ...any) {
+	if out == nil {
+		log.Println(args...)
+		return
+	}
+	msg := strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	out.write(component, session, msg)
+}
+
+// Write is called by the standard log package with one message
+func (jw *jsonWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	session := ""
+	if prefix := log.Prefix(); prefix != "" && strings.HasPrefix(msg, prefix) {
+		session = strings.TrimSpace(prefix)
+		msg = msg[len(prefix):]
+	}
+	jw.write("", session, msg)
+	return len(p), nil
+}
+
+func (jw *jsonWriter) write(component, session, msg string) {
+	if session != "" {
+		msg = strings.TrimPrefix(msg, session+" ")
+	}
+	rec := record{Time: time.Now().Format(time.RFC3339Nano), Level: Level(msg),
+		Component: component, Session: session, Message: msg}
+	buf, err := json.Marshal(&rec)
+	if err != nil {
+		return
+	}
+	buf = append(buf, '\n')
+	jw.lock.Lock()
+	defer jw.lock.Unlock()
+	jw.w.Write(buf)
+}
+
+// Level returns the level of a message (fatal, error, warn, or info)
+// based on how it starts e.g. "ERROR ...", "WARNING: ..."
+// or "goroutine ..." for a Go stack trace
+func Level(msg string) string {
+	msg = strings.TrimPrefix(msg, "PREV: ") // from clientErrorLog
+	switch {
+	case strings.HasPrefix(msg, "FATAL"):
+		return "fatal"
+	case strings.HasPrefix(msg, "ERROR"),
+		strings.HasPrefix(msg, "ASSERT FAILED"),
+		strings.HasPrefix(msg, "goroutine "): // stack trace
+		return "error"
+	case strings.HasPrefix(msg, "WARN"):
+		return "warn"
+	}
+	return "info"
+}
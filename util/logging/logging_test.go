@@ -0,0 +1,89 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package logging
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apmckinlay/gsuneido/util/assert"
+)
+
+func TestJSON(t *testing.T) {
+	flags, prefix := log.Flags(), log.Prefix()
+	defer func() {
+		out = nil
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}()
+	var sb strings.Builder
+	JSON(&sb)
+	log.Println("ERROR something failed")
+	Println("dbms", "1.2.3.4", "dbms server:", "1.2.3.4:", "closing")
+	Println("client", "sid", "sid PREV: WARNING old")
+	log.SetPrefix("abc ")
+	log.Println("hello")
+	log.Writer().Write([]byte("goroutine 1 [running]:\nmain.main()\n"))
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.T(t).This(len(lines)).Is(5)
+	get := func(line string) record {
+		var rec record
+		assert.T(t).This(json.Unmarshal([]byte(line), &rec)).Is(nil)
+		assert.T(t).That(rec.Time != "")
+		rec.Time = ""
+		return rec
+	}
+	assert.T(t).This(get(lines[0])).
+		Is(record{Level: "error", Message: "ERROR something failed"})
+	assert.T(t).This(get(lines[1])).Is(record{Level: "info",
+		Component: "dbms", Session: "1.2.3.4",
+		Message: "dbms server: 1.2.3.4: closing"})
+	assert.T(t).This(get(lines[2])).Is(record{Level: "warn",
+		Component: "client", Session: "sid", Message: "PREV: WARNING old"})
+	assert.T(t).This(get(lines[3])).
+		Is(record{Level: "info", Session: "abc", Message: "hello"})
+	assert.T(t).This(get(lines[4])).Is(record{Level: "error",
+		Message: "goroutine 1 [running]:\nmain.main()"})
+}
+
+func TestRotating(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "error.log")
+	rf, err := OpenRotating(name, 10, 2)
+	assert.T(t).This(err).Is(nil)
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		rf.Write([]byte(s))
+	}
+	rf.Close()
+	read := func(name string) string {
+		buf, _ := os.ReadFile(name)
+		return string(buf)
+	}
+	assert.T(t).This(read(name)).Is("dddddd\n")
+	assert.T(t).This(read(name + ".1")).Is("cccccc\n")
+	assert.T(t).This(read(name + ".2")).Is("bbbbbb\n")
+	_, err = os.Stat(name + ".3")
+	assert.T(t).That(os.IsNotExist(err))
+
+	// appends to existing
+	rf, _ = OpenRotating(name, 20, 2)
+	rf.Write([]byte("eeeeee\n"))
+	rf.Close()
+	assert.T(t).This(read(name)).Is("dddddd\neeeeee\n")
+
+	// OnOpen is called with the current file and after each rotation
+	var opened []*os.File
+	rf, _ = OpenRotating(name, 20, 2)
+	rf.OnOpen(func(f *os.File) { opened = append(opened, f) })
+	assert.T(t).This(len(opened)).Is(1)
+	rf.Write([]byte("ffffff\n"))
+	assert.T(t).This(len(opened)).Is(2)
+	assert.T(t).That(opened[1] == rf.file)
+	rf.Close()
+}
@@ -0,0 +1,101 @@
+// Copyright Suneido Software Corp. All rights reserved.
+// Governed by the MIT license found in the LICENSE file.
+
+package logging
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Rotating is a log file that is rotated when it reaches a maximum size.
+// The current file is renamed to name.1, name.1 to name.2 etc.
+// and files beyond keep are removed.
+type Rotating struct {
+	file    *os.File
+	name    string
+	maxSize int64
+	size    int64
+	keep    int
+	lock    sync.Mutex
+	onOpen  func(*os.File)
+}
+
+// OpenRotating opens (appends to) or creates a rotating log file
+func OpenRotating(name string, maxSize int64, keep int) (*Rotating, error) {
+	rf := &Rotating{name: name, maxSize: maxSize, keep: keep}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *Rotating) open() error {
+	f, err := os.OpenFile(rf.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	if rf.onOpen != nil {
+		rf.onOpen(f)
+	}
+	return nil
+}
+
+// OnOpen calls fn with the current file, and with each new file
+// after rotation. It is used to redirect stderr to the log file.
+func (rf *Rotating) OnOpen(fn func(*os.File)) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	rf.onOpen = fn
+	fn(rf.file)
+}
+
+func (rf *Rotating) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		rf.rotate()
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the log files and opens a new one.
+// If renaming fails (e.g. the file is open elsewhere on Windows)
+// it continues to append to the current file.
+func (rf *Rotating) rotate() {
+	rf.file.Close()
+	os.Remove(rf.backup(rf.keep))
+	for i := rf.keep - 1; i >= 1; i-- {
+		os.Rename(rf.backup(i), rf.backup(i+1))
+	}
+	if rf.keep == 0 {
+		os.Remove(rf.name)
+	} else {
+		os.Rename(rf.name, rf.backup(1))
+	}
+	if err := rf.open(); err != nil {
+		// can't log this since we are the log
+		rf.file, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		rf.size = 0
+	}
+}
+
+func (rf *Rotating) backup(i int) string {
+	return rf.name + "." + strconv.Itoa(i)
+}
+
+func (rf *Rotating) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.file.Close()
+}
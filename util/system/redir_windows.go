@@ -22,8 +22,37 @@ func Redirect(filename string) error {
 	if err != nil {
 		return err
 	}
+	if err := setStd(f); err != nil {
+		return err
+	}
+	log.SetOutput(f)
+	redirFile = f
+	return nil
+}
+
+// redirFile is the file that stderr and stdout are redirected to,
+// nil if they were not redirected by Redirect
+var redirFile *os.File
+
+// RedirectTo switches stderr and stdout to another file
+// and closes the file opened by Redirect
+// so that it can be renamed e.g. by log rotation.
+// It does nothing if Redirect did not redirect.
+func RedirectTo(f *os.File) error {
+	if redirFile == nil || redirFile == f {
+		return nil
+	}
+	if err := setStd(f); err != nil {
+		return err
+	}
+	redirFile.Close()
+	redirFile = f
+	return nil
+}
+
+func setStd(f *os.File) error {
 	wh := windows.Handle(f.Fd())
-	err = windows.SetStdHandle(windows.STD_ERROR_HANDLE, wh)
+	err := windows.SetStdHandle(windows.STD_ERROR_HANDLE, wh)
 	if err != nil {
 		return err
 	}
@@ -34,7 +63,6 @@ func Redirect(filename string) error {
 	// redo initialization
 	os.Stdout = f
 	os.Stderr = f
-	log.SetOutput(f)
 	syscall.Stdout = syscall.Handle(wh)
 	syscall.Stderr = syscall.Handle(wh)
 	return nil